@@ -0,0 +1,458 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// "ghpm audit" matches the libraries resolved by each package's build (see
+// resolvedLibraries) against advisories in the OSV format
+// (https://ossf.github.io/osv-schema/) kept in ~/.ghpm/advisories. The
+// database is never fetched by ghpm; it is imported from OSV exports such
+// as https://osv-vulnerabilities.storage.googleapis.com/Go/all.zip, so
+// audits work offline and give the same answer until the next import.
+
+func advisoriesDir() string {
+	return filepath.Join(baseDir, "advisories")
+}
+
+// osvAdvisory holds the parts of an OSV entry the audit uses.
+type osvAdvisory struct {
+	ID        string   `json:"id"`
+	Summary   string   `json:"summary"`
+	Aliases   []string `json:"aliases"`
+	Withdrawn string   `json:"withdrawn"`
+	Severity  []struct {
+		Type  string `json:"type"`
+		Score string `json:"score"`
+	} `json:"severity"`
+	Affected []struct {
+		Package struct {
+			Ecosystem string `json:"ecosystem"`
+			Name      string `json:"name"`
+		} `json:"package"`
+		Ranges []struct {
+			Type   string              `json:"type"`
+			Events []map[string]string `json:"events"`
+		} `json:"ranges"`
+		Versions          []string `json:"versions"`
+		EcosystemSpecific struct {
+			Severity string `json:"severity"`
+		} `json:"ecosystem_specific"`
+	} `json:"affected"`
+	DatabaseSpecific struct {
+		Severity string `json:"severity"`
+	} `json:"database_specific"`
+}
+
+// severityLevels ranks the severity names used by OSV databases.
+var severityLevels = map[string]int{"unknown": 0, "low": 1, "moderate": 2, "medium": 2, "high": 3, "critical": 4}
+
+// severity returns the advisory's severity as LOW, MODERATE, HIGH or
+// CRITICAL, with the CVSS v3 base score when the entry has a vector.
+func (a osvAdvisory) severity() (string, float64) {
+	var score float64
+	for _, s := range a.Severity {
+		if s.Type == "CVSS_V3" {
+			score = cvss3Score(s.Score)
+		}
+	}
+	label := a.DatabaseSpecific.Severity
+	for _, af := range a.Affected {
+		if label == "" {
+			label = af.EcosystemSpecific.Severity
+		}
+	}
+	switch {
+	case label != "":
+	case score >= 9:
+		label = "critical"
+	case score >= 7:
+		label = "high"
+	case score >= 4:
+		label = "moderate"
+	case score > 0:
+		label = "low"
+	default:
+		label = "unknown"
+	}
+	if strings.EqualFold(label, "medium") {
+		label = "moderate"
+	}
+	return strings.ToUpper(label), score
+}
+
+// cvss3Score computes the base score of a CVSS v3.x vector such as
+// "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H", or 0 if it is invalid.
+func cvss3Score(vector string) float64 {
+	weights := map[string]map[string]float64{
+		"AV": {"N": 0.85, "A": 0.62, "L": 0.55, "P": 0.2},
+		"AC": {"L": 0.77, "H": 0.44},
+		"PR": {"N": 0.85, "L": 0.62, "H": 0.27},
+		"UI": {"N": 0.85, "R": 0.62},
+		"C":  {"H": 0.56, "L": 0.22, "N": 0},
+		"I":  {"H": 0.56, "L": 0.22, "N": 0},
+		"A":  {"H": 0.56, "L": 0.22, "N": 0},
+	}
+	metrics := map[string]string{}
+	for _, part := range strings.Split(vector, "/") {
+		if k, v, ok := strings.Cut(part, ":"); ok {
+			metrics[k] = v
+		}
+	}
+	changed := metrics["S"] == "C"
+	if !changed && metrics["S"] != "U" {
+		return 0
+	}
+	w := map[string]float64{}
+	for k, values := range weights {
+		v, ok := values[metrics[k]]
+		if !ok {
+			return 0
+		}
+		w[k] = v
+	}
+	if changed && metrics["PR"] == "L" {
+		w["PR"] = 0.68
+	} else if changed && metrics["PR"] == "H" {
+		w["PR"] = 0.5
+	}
+
+	iss := 1 - (1-w["C"])*(1-w["I"])*(1-w["A"])
+	impact := 6.42 * iss
+	if changed {
+		impact = 7.52*(iss-0.029) - 3.25*math.Pow(iss-0.02, 15)
+	}
+	if impact <= 0 {
+		return 0
+	}
+	exploitability := 8.22 * w["AV"] * w["AC"] * w["PR"] * w["UI"]
+	if changed {
+		return roundUp(math.Min(1.08*(impact+exploitability), 10))
+	}
+	return roundUp(math.Min(impact+exploitability, 10))
+}
+
+// roundUp rounds up to one decimal as the CVSS specification defines it.
+func roundUp(x float64) float64 {
+	i := int(math.Round(x * 100000))
+	if i%10000 == 0 {
+		return float64(i) / 100000
+	}
+	return float64(i/10000+1) / 10
+}
+
+// affects reports whether the advisory covers version of the named package,
+// and returns the versions that fix it.
+func (a osvAdvisory) affects(ecosystem, name, version string) (bool, []string) {
+	affected := false
+	var fixed []string
+	for _, af := range a.Affected {
+		if af.Package.Ecosystem != ecosystem || !samePackage(ecosystem, af.Package.Name, name) {
+			continue
+		}
+		for _, v := range af.Versions {
+			if strings.TrimPrefix(v, "v") == strings.TrimPrefix(version, "v") {
+				affected = true
+			}
+		}
+		for _, r := range af.Ranges {
+			if r.Type != "SEMVER" && r.Type != "ECOSYSTEM" {
+				continue
+			}
+			// Events are in order: each "introduced" opens a range that the
+			// next "fixed" or "last_affected" closes.
+			in := false
+			for _, e := range r.Events {
+				switch {
+				case e["introduced"] != "":
+					in = e["introduced"] == "0" || compareVersions(version, e["introduced"]) >= 0
+				case e["fixed"] != "":
+					if !contains(fixed, e["fixed"]) {
+						fixed = append(fixed, e["fixed"])
+					}
+					if in && compareVersions(version, e["fixed"]) < 0 {
+						affected = true
+					}
+					in = false
+				case e["last_affected"] != "":
+					if in && compareVersions(version, e["last_affected"]) <= 0 {
+						affected = true
+					}
+					in = false
+				}
+			}
+			if in {
+				affected = true
+			}
+		}
+	}
+	return affected, fixed
+}
+
+func samePackage(ecosystem, a, b string) bool {
+	if ecosystem == "PyPI" {
+		return pypiName(a) == pypiName(b)
+	}
+	return a == b
+}
+
+// advisoryIndex maps "ecosystem/name" to the advisories that mention it.
+type advisoryIndex map[string][]osvAdvisory
+
+func loadAdvisories() (advisoryIndex, int, error) {
+	entries, err := os.ReadDir(advisoriesDir())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, 0, err
+	}
+	index := advisoryIndex{}
+	count := 0
+	for _, e := range entries {
+		if e.IsDir() || filepath.Ext(e.Name()) != ".json" {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(advisoriesDir(), e.Name()))
+		if err != nil {
+			continue
+		}
+		var a osvAdvisory
+		if err := json.Unmarshal(data, &a); err != nil || a.Withdrawn != "" {
+			continue
+		}
+		count++
+		seen := map[string]bool{}
+		for _, af := range a.Affected {
+			key := advisoryKey(af.Package.Ecosystem, af.Package.Name)
+			if !seen[key] {
+				seen[key] = true
+				index[key] = append(index[key], a)
+			}
+		}
+	}
+	return index, count, nil
+}
+
+func advisoryKey(ecosystem, name string) string {
+	if ecosystem == "PyPI" {
+		name = pypiName(name)
+	}
+	return ecosystem + "/" + name
+}
+
+// importAdvisories copies OSV entries from a .json file, a .zip export or
+// a directory of .json files into the database, replacing entries with the
+// same ID. Other JSON files in a directory or export are skipped. It
+// returns how many were imported.
+func importAdvisories(path string) (int, error) {
+	if err := os.MkdirAll(advisoriesDir(), 0755); err != nil {
+		return 0, err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, notFoundError("advisory source not found: %s", path)
+	}
+
+	count := 0
+	store := func(name string, r io.Reader, strict bool) error {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		var a osvAdvisory
+		if err := json.Unmarshal(data, &a); err != nil || a.ID == "" {
+			if strict {
+				return usageError("%s is not an OSV advisory", name)
+			}
+			return nil
+		}
+		id := strings.Map(func(r rune) rune {
+			if r == '/' || r == '\\' || r == os.PathSeparator {
+				return '_'
+			}
+			return r
+		}, a.ID)
+		if err := writeFileAtomic(filepath.Join(advisoriesDir(), id+".json"), data, 0644); err != nil {
+			return err
+		}
+		count++
+		return nil
+	}
+
+	switch {
+	case info.IsDir():
+		err = filepath.WalkDir(path, func(p string, d os.DirEntry, err error) error {
+			if err != nil || d.IsDir() || filepath.Ext(p) != ".json" {
+				return err
+			}
+			f, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+			return store(p, f, false)
+		})
+	case strings.EqualFold(filepath.Ext(path), ".zip"):
+		var zr *zip.ReadCloser
+		zr, err = zip.OpenReader(path)
+		if err != nil {
+			return 0, usageError("cannot read %s: %v", path, err)
+		}
+		defer zr.Close()
+		for _, zf := range zr.File {
+			if zf.FileInfo().IsDir() || filepath.Ext(zf.Name) != ".json" {
+				continue
+			}
+			f, ferr := zf.Open()
+			if ferr != nil {
+				return count, ferr
+			}
+			err = store(zf.Name, f, false)
+			f.Close()
+			if err != nil {
+				break
+			}
+		}
+	default:
+		var f *os.File
+		f, err = os.Open(path)
+		if err != nil {
+			return 0, err
+		}
+		defer f.Close()
+		err = store(path, f, true)
+	}
+	return count, err
+}
+
+// auditRecord is the schema of a vulnerable library in "ghpm audit".
+type auditRecord struct {
+	Package   string   `json:"package"`
+	Repo      string   `json:"repo"`
+	Ecosystem string   `json:"ecosystem"`
+	Library   string   `json:"library"`
+	Version   string   `json:"version"`
+	ID        string   `json:"id"`
+	Aliases   []string `json:"aliases"`
+	Summary   string   `json:"summary"`
+	Severity  string   `json:"severity"`
+	Score     float64  `json:"score"`
+	Fixed     []string `json:"fixed"`
+}
+
+// auditCommand implements "ghpm audit": it reports the vulnerable libraries
+// in the named packages, or in all of them, at or above minSeverity, and
+// fails when there are any. Advisories without a severity, such as most of
+// the Go database, are always reported: they may be of any severity.
+func auditCommand(names []string, minSeverity string, out outputMode) error {
+	min, ok := severityLevels[strings.ToLower(minSeverity)]
+	if !ok {
+		return usageError("unknown severity %s (severities: low, moderate, high, critical)", minSeverity)
+	}
+	var manifests []Manifest
+	if len(names) == 0 {
+		manifests = loadAllManifests()
+	} else {
+		for _, name := range names {
+			m, err := loadManifest(name)
+			if err != nil {
+				return notFoundError("package not found: %s", name)
+			}
+			manifests = append(manifests, m)
+		}
+	}
+
+	index, count, err := loadAdvisories()
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return notFoundError("no advisories in %s; import an OSV export with ghpm audit --import <file.zip|dir>", advisoriesDir())
+	}
+
+	records := []auditRecord{}
+	scanned := 0
+	for _, m := range manifests {
+		for _, lib := range resolvedLibraries(filepath.Join(packagesDir, m.Name)) {
+			scanned++
+			for _, a := range index[advisoryKey(lib.Ecosystem, lib.Name)] {
+				hit, fixed := a.affects(lib.Ecosystem, lib.Name, lib.Version)
+				if !hit {
+					continue
+				}
+				severity, score := a.severity()
+				if level := severityLevels[strings.ToLower(severity)]; level > 0 && level < min {
+					continue
+				}
+				records = append(records, auditRecord{
+					Package:   m.Name,
+					Repo:      m.Repo,
+					Ecosystem: lib.Ecosystem,
+					Library:   lib.Name,
+					Version:   lib.Version,
+					ID:        a.ID,
+					Aliases:   nonNil(a.Aliases),
+					Summary:   a.Summary,
+					Severity:  severity,
+					Score:     score,
+					Fixed:     nonNil(fixed),
+				})
+			}
+		}
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		if records[i].Package != records[j].Package {
+			return records[i].Package < records[j].Package
+		}
+		return severityLevels[strings.ToLower(records[i].Severity)] > severityLevels[strings.ToLower(records[j].Severity)]
+	})
+
+	var affected []string
+	for _, r := range records {
+		if !contains(affected, r.Package) {
+			affected = append(affected, r.Package)
+		}
+	}
+	if len(records) > 0 {
+		err = verifyError("known vulnerabilities in %s", strings.Join(affected, ", "))
+	}
+	if out.machine() {
+		if werr := out.write(records); werr != nil {
+			return werr
+		}
+		return err
+	}
+
+	fmt.Printf("Checked %d libraries in %d packages against %d advisories.\n", scanned, len(manifests), count)
+	if len(records) == 0 {
+		fmt.Println("No known vulnerabilities.")
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for i, r := range records {
+		if i == 0 || r.Package != records[i-1].Package {
+			if i > 0 {
+				fmt.Fprintln(tw)
+			}
+			fmt.Fprintf(tw, "%s (%s)\n", r.Package, r.Repo)
+		}
+		severity := r.Severity
+		if r.Score > 0 {
+			severity += fmt.Sprintf(" %.1f", r.Score)
+		}
+		fix := "no fix"
+		if len(r.Fixed) > 0 {
+			fix = "fixed in " + strings.Join(r.Fixed, ", ")
+		}
+		fmt.Fprintf(tw, "  %s %s\t%s\t%s\t%s\t%s\n", r.Library, r.Version, r.ID, severity, fix, r.Summary)
+	}
+	tw.Flush()
+	return err
+}
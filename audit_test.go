@@ -0,0 +1,118 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestCVSS3Score(t *testing.T) {
+	tests := []struct {
+		vector string
+		want   float64
+	}{
+		{"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H", 9.8},
+		{"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:C/C:H/I:H/A:H", 10.0},
+		{"CVSS:3.1/AV:N/AC:L/PR:L/UI:N/S:C/C:H/I:H/A:H", 9.9},
+		{"CVSS:3.1/AV:N/AC:L/PR:N/UI:R/S:C/C:L/I:L/A:N", 6.1},
+		{"CVSS:3.1/AV:L/AC:L/PR:L/UI:N/S:U/C:H/I:H/A:H", 7.8},
+		{"CVSS:3.0/AV:N/AC:H/PR:N/UI:N/S:U/C:H/I:N/A:N", 5.9},
+		{"CVSS:3.1/AV:P/AC:H/PR:H/UI:R/S:U/C:L/I:N/A:N", 1.6},
+		{"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:N/I:N/A:N", 0},
+		{"CVSS:3.1/AV:N/AC:L/PR:N/UI:N/C:H/I:H/A:H", 0}, // no scope
+		{"CVSS:3.1/AV:X/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H", 0},
+		{"", 0},
+	}
+	for _, tt := range tests {
+		if got := cvss3Score(tt.vector); got != tt.want {
+			t.Errorf("cvss3Score(%q) = %v, want %v", tt.vector, got, tt.want)
+		}
+	}
+}
+
+func parseAdvisory(t *testing.T, data string) osvAdvisory {
+	t.Helper()
+	var a osvAdvisory
+	if err := json.Unmarshal([]byte(data), &a); err != nil {
+		t.Fatal(err)
+	}
+	return a
+}
+
+func TestAdvisorySeverity(t *testing.T) {
+	tests := []struct {
+		name, data string
+		label      string
+		score      float64
+	}{
+		{"none", `{"id": "GO-1"}`, "UNKNOWN", 0},
+		{"database specific", `{"database_specific": {"severity": "HIGH"}}`, "HIGH", 0},
+		{"medium is moderate", `{"database_specific": {"severity": "medium"}}`, "MODERATE", 0},
+		{"ecosystem specific", `{"affected": [{"ecosystem_specific": {"severity": "low"}}]}`, "LOW", 0},
+		{
+			"rated from CVSS",
+			`{"severity": [{"type": "CVSS_V3", "score": "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H"}]}`,
+			"CRITICAL", 9.8,
+		},
+		{
+			"database label wins over CVSS",
+			`{"severity": [{"type": "CVSS_V3", "score": "CVSS:3.1/AV:N/AC:L/PR:N/UI:N/S:U/C:H/I:H/A:H"}], "database_specific": {"severity": "MODERATE"}}`,
+			"MODERATE", 9.8,
+		},
+	}
+	for _, tt := range tests {
+		label, score := parseAdvisory(t, tt.data).severity()
+		if label != tt.label || score != tt.score {
+			t.Errorf("%s: got %s %v, want %s %v", tt.name, label, score, tt.label, tt.score)
+		}
+	}
+}
+
+func TestAdvisoryAffects(t *testing.T) {
+	a := parseAdvisory(t, `{
+  "id": "GO-2099-0001",
+  "affected": [
+    {
+      "package": {"ecosystem": "Go", "name": "golang.org/x/net"},
+      "ranges": [{"type": "SEMVER", "events": [
+        {"introduced": "0"}, {"fixed": "0.7.0"},
+        {"introduced": "0.8.0"}, {"fixed": "0.8.3"},
+        {"introduced": "0.10.0"}
+      ]}]
+    },
+    {
+      "package": {"ecosystem": "Go", "name": "golang.org/x/net"},
+      "ranges": [{"type": "GIT", "events": [{"introduced": "0"}, {"fixed": "abcdef"}]}]
+    },
+    {
+      "package": {"ecosystem": "PyPI", "name": "Some_Package"},
+      "ranges": [{"type": "ECOSYSTEM", "events": [{"introduced": "1.0"}, {"last_affected": "1.4"}]}],
+      "versions": ["0.9"]
+    }
+  ]
+}`)
+	fixedGo := []string{"0.7.0", "0.8.3"}
+	tests := []struct {
+		ecosystem, name, version string
+		want                     bool
+		fixed                    []string
+	}{
+		{"Go", "golang.org/x/net", "v0.1.0", true, fixedGo},
+		{"Go", "golang.org/x/net", "v0.7.0", false, fixedGo},
+		{"Go", "golang.org/x/net", "v0.8.1", true, fixedGo},
+		{"Go", "golang.org/x/net", "v0.8.3", false, fixedGo},
+		{"Go", "golang.org/x/net", "v0.12.0", true, fixedGo}, // no fix yet
+		{"Go", "golang.org/x/text", "v0.1.0", false, nil},
+		{"npm", "golang.org/x/net", "0.1.0", false, nil},
+		{"PyPI", "some-package", "1.4", true, nil},
+		{"PyPI", "some-package", "1.4.1", false, nil},
+		{"PyPI", "some-package", "0.9", true, nil},
+		{"PyPI", "some-package", "0.8", false, nil},
+	}
+	for _, tt := range tests {
+		got, fixed := a.affects(tt.ecosystem, tt.name, tt.version)
+		if got != tt.want || !reflect.DeepEqual(fixed, tt.fixed) {
+			t.Errorf("affects(%s, %s, %s) = %v %v, want %v %v", tt.ecosystem, tt.name, tt.version, got, fixed, tt.want, tt.fixed)
+		}
+	}
+}
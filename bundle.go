@@ -0,0 +1,344 @@
+package main
+
+import (
+	"archive/tar"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// A bundle carries installed packages to machines without network access.
+// It is a tar file holding ghpm-bundle.json, the manifests in install
+// order (dependencies first), and each package's git repository as
+// repos/<name>/.git. The repository is copied as it is rather than with
+// git bundle, which cannot bundle a shallow clone, but only its objects
+// and refs are installed from it. ghpm builds from source
+// and downloads no release assets, so there are none to include.
+//
+// Installing from a bundle is always offline. The bundle does not carry
+// the language dependencies (Go modules, crates, npm or pip packages), so
+// a package that has any builds only if they are vendored in its
+// repository or already in the machine's module caches.
+
+const bundleIndex = "ghpm-bundle.json"
+
+type bundleManifest struct {
+	Format    int        `json:"format"`
+	CreatedAt time.Time  `json:"created_at"`
+	Ghpm      string     `json:"ghpm"`
+	Packages  []Manifest `json:"packages"`
+}
+
+// bundleCommand implements "ghpm bundle create <name>... -o file". The
+// named packages' dependencies are included.
+func bundleCommand(args []string, output string) error {
+	if len(args) < 2 || args[0] != "create" {
+		return findCommand("bundle").usageError()
+	}
+	var order []Manifest
+	seen := map[string]bool{}
+	var add func(m Manifest) error
+	add = func(m Manifest) error {
+		if seen[m.Name] {
+			return nil
+		}
+		if m.Source != "" {
+			return usageError("%s was installed from %s; only packages from GitHub can be bundled", m.Name, m.Source)
+		}
+		seen[m.Name] = true
+		for _, raw := range m.Depends {
+			d, err := parseDependency(raw)
+			if err != nil {
+				continue
+			}
+			dep, ok := findManifestByRepo(d.Repo)
+			if !ok {
+				return notFoundError("%s depends on %s, which is not installed", m.Name, d.Repo)
+			}
+			if err := add(dep); err != nil {
+				return err
+			}
+		}
+		order = append(order, m)
+		return nil
+	}
+	for _, name := range args[1:] {
+		m, err := loadManifest(name)
+		if err != nil {
+			return notFoundError("package not found: %s", name)
+		}
+		if err := add(m); err != nil {
+			return err
+		}
+	}
+
+	f, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(f)
+	err = writeBundle(tw, order)
+	if cerr := tw.Close(); err == nil {
+		err = cerr
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(output)
+		return fmt.Errorf("failed to write %s: %v", output, err)
+	}
+
+	var names []string
+	for _, m := range order {
+		names = append(names, m.Name)
+	}
+	fmt.Printf("Bundled %s into %s (%s)\n", strings.Join(names, ", "), output, formatSize(diskUsage(output)))
+	return nil
+}
+
+func writeBundle(tw *tar.Writer, packages []Manifest) error {
+	index := bundleManifest{Format: 1, CreatedAt: time.Now().UTC(), Ghpm: ghpmVersion(), Packages: packages}
+	data, err := json.MarshalIndent(index, "", "  ")
+	if err != nil {
+		return err
+	}
+	hdr := &tar.Header{Name: bundleIndex, Mode: 0644, Size: int64(len(data)), ModTime: index.CreatedAt}
+	if err := tw.WriteHeader(hdr); err != nil {
+		return err
+	}
+	if _, err := tw.Write(data); err != nil {
+		return err
+	}
+
+	for _, m := range packages {
+		gitDir := filepath.Join(packagesDir, m.Name, ".git")
+		err := filepath.WalkDir(gitDir, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			info, err := d.Info()
+			if err != nil || !(info.Mode().IsRegular() || info.IsDir()) {
+				return err
+			}
+			rel, _ := filepath.Rel(gitDir, p)
+			hdr, err := tar.FileInfoHeader(info, "")
+			if err != nil {
+				return err
+			}
+			hdr.Name = path.Join("repos", m.Name, ".git", filepath.ToSlash(rel))
+			if info.IsDir() {
+				hdr.Name += "/"
+			}
+			if err := tw.WriteHeader(hdr); err != nil {
+				return err
+			}
+			if info.IsDir() {
+				return nil
+			}
+			src, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			defer src.Close()
+			_, err = io.Copy(tw, src)
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %v", m.Name, err)
+		}
+	}
+	return nil
+}
+
+// bundle is an unpacked bundle file.
+type bundle struct {
+	dir      string
+	packages []Manifest
+}
+
+// openBundle unpacks a bundle file into a temporary directory under
+// ~/.ghpm, so its repositories can be moved into place.
+func openBundle(file string) (*bundle, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, notFoundError("cannot open bundle: %v", err)
+	}
+	defer f.Close()
+	dir, err := os.MkdirTemp(baseDir, ".bundle-")
+	if err != nil {
+		return nil, err
+	}
+	b := &bundle{dir: dir}
+
+	tr := tar.NewReader(f)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			b.close()
+			return nil, usageError("%s is not a ghpm bundle: %v", file, err)
+		}
+		name := path.Clean(hdr.Name)
+		if path.IsAbs(name) || name == ".." || strings.HasPrefix(name, "../") {
+			b.close()
+			return nil, verifyError("%s contains an unsafe path: %s", file, hdr.Name)
+		}
+		target := filepath.Join(dir, filepath.FromSlash(name))
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0755)
+		case tar.TypeReg:
+			err = extractFile(target, tr, os.FileMode(hdr.Mode).Perm())
+		}
+		if err != nil {
+			b.close()
+			return nil, err
+		}
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, bundleIndex))
+	if err == nil {
+		var index bundleManifest
+		if err = json.Unmarshal(data, &index); err == nil {
+			b.packages = index.Packages
+		}
+	}
+	if err != nil {
+		b.close()
+		return nil, usageError("%s is not a ghpm bundle: missing or invalid %s", file, bundleIndex)
+	}
+	return b, nil
+}
+
+func extractFile(target string, r io.Reader, perm os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, r); err != nil {
+		out.Close()
+		return err
+	}
+	return out.Close()
+}
+
+func (b *bundle) close() {
+	os.RemoveAll(b.dir)
+}
+
+func (b *bundle) manifest(repo string) (Manifest, bool) {
+	for _, m := range b.packages {
+		if strings.EqualFold(m.Repo, repo) || m.Name == repo {
+			return m, true
+		}
+	}
+	return Manifest{}, false
+}
+
+// bundledGitFiles are the parts of a bundled repository that are used.
+// Its config and hooks could make git run commands (core.fsmonitor,
+// core.hooksPath, filters), so the repository gets fresh ones from git
+// init instead.
+var bundledGitFiles = []string{"objects", "refs", "packed-refs", "shallow", "HEAD"}
+
+// checkout sets up a repository at dest from the bundled one of m, with
+// url as its origin, and checks out its files.
+func (b *bundle) checkout(m Manifest, url, dest string) error {
+	if m.Name == "" || m.Name != filepath.Base(m.Name) || strings.HasPrefix(m.Name, ".") {
+		return verifyError("invalid package name in the bundle: %q", m.Name)
+	}
+	src := filepath.Join(b.dir, "repos", m.Name, ".git")
+	if _, err := os.Stat(filepath.Join(src, "HEAD")); err != nil {
+		return notFoundError("the bundle has no repository for %s", m.Name)
+	}
+	if err := runGit("", "init", "--quiet", dest); err != nil {
+		return err
+	}
+	gitDir := filepath.Join(dest, ".git")
+	for _, name := range bundledGitFiles {
+		from := filepath.Join(src, name)
+		if _, err := os.Lstat(from); os.IsNotExist(err) {
+			continue
+		}
+		to := filepath.Join(gitDir, name)
+		if err := os.RemoveAll(to); err != nil {
+			return err
+		}
+		if err := os.Rename(from, to); err != nil {
+			return err
+		}
+	}
+	// Objects borrowed from elsewhere are not in the bundle.
+	for _, name := range []string{"alternates", "http-alternates"} {
+		os.Remove(filepath.Join(gitDir, "objects", "info", name))
+	}
+
+	if err := runGit(dest, "remote", "add", "origin", url); err != nil {
+		return err
+	}
+	if branch, err := gitOutput(dest, "symbolic-ref", "--quiet", "--short", "HEAD"); err == nil {
+		runGit(dest, "config", "branch."+branch+".remote", "origin")
+		runGit(dest, "config", "branch."+branch+".merge", "refs/heads/"+branch)
+	}
+	return runGit(dest, "reset", "--quiet", "--hard", "HEAD")
+}
+
+// installBundle implements "ghpm install --from-bundle file [name...]": it
+// installs the named packages, or all of them, through the usual pipeline
+// with the bundled repositories in place of clones.
+func installBundle(file string, names []string, opts installOptions) error {
+	b, err := openBundle(file)
+	if err != nil {
+		return err
+	}
+	defer b.close()
+
+	targets := b.packages
+	if len(names) > 0 {
+		targets = nil
+		for _, name := range names {
+			m, ok := b.manifest(name)
+			if !ok {
+				return notFoundError("%s is not in %s", name, file)
+			}
+			m.AsDependency = false
+			targets = append(targets, m)
+		}
+	}
+
+	// Everything comes from the bundle, so nothing may reach the network,
+	// as if --offline were given.
+	setOffline()
+	opts.Bundle = b
+	var failed []string
+	code := exitOK
+	for _, m := range targets {
+		o := opts
+		o.AsDependency = m.AsDependency
+		if err := installRepo(m.Repo, o); err != nil {
+			fmt.Fprintf(errOut, "%s: %v\n", m.Name, err)
+			failed = append(failed, m.Name)
+			if c := exitCode(err); code == exitOK || code == c {
+				code = c
+			} else {
+				code = exitFailure
+			}
+		}
+	}
+	if len(failed) > 0 {
+		return withCode(code, "%d of %d failed: %s", len(failed), len(targets), strings.Join(failed, ", "))
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBundleInstall(t *testing.T) {
+	urls := testCachedPackages(t, "own/up")
+	m := installForTest(t, "own/up", urls[0], nil)
+	pkgPath := filepath.Join(packagesDir, m.Name)
+	head, _ := gitOutput(pkgPath, "rev-parse", "HEAD")
+	branch, _ := gitOutput(pkgPath, "symbolic-ref", "--short", "HEAD")
+
+	// Config and hooks that would run commands on checkout.
+	marker := filepath.Join(t.TempDir(), "ran")
+	hook := "#!/bin/sh\ntouch " + marker + "\n"
+	os.WriteFile(filepath.Join(pkgPath, ".git", "hooks", "post-checkout"), []byte(hook), 0755)
+	runGit(pkgPath, "config", "core.fsmonitor", "touch "+marker)
+	runGit(pkgPath, "config", "core.hooksPath", filepath.Join(pkgPath, ".git", "hooks"))
+
+	file := filepath.Join(t.TempDir(), "up.tar")
+	if err := bundleCommand([]string{"create", m.Name}, file); err != nil {
+		t.Fatal(err)
+	}
+	os.RemoveAll(pkgPath)
+	os.Remove(filepath.Join(manifestsDir, m.Name+".json"))
+
+	// Installing from a bundle turns on offline mode for good.
+	for k := range offlineEnv {
+		t.Setenv(k, os.Getenv(k))
+	}
+	transport, download := http.DefaultTransport, downloadClient.Transport
+	defer func() {
+		offline = false
+		http.DefaultTransport, downloadClient.Transport = transport, download
+	}()
+	if err := installBundle(file, nil, installOptions{NoBuild: true}); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := gitOutput(pkgPath, "rev-parse", "HEAD"); got != head {
+		t.Errorf("HEAD %s, want %s", got, head)
+	}
+	if _, err := os.Stat(marker); err == nil {
+		t.Error("the bundled config or hooks ran a command")
+	}
+	if got, _ := gitOutput(pkgPath, "config", "--get", "core.fsmonitor"); got != "" {
+		t.Errorf("core.fsmonitor %q came from the bundle", got)
+	}
+	if got, _ := gitOutput(pkgPath, "config", "--get", "remote.origin.url"); got != urls[0] {
+		t.Errorf("origin %s", got)
+	}
+	if got, _ := gitOutput(pkgPath, "rev-parse", "--abbrev-ref", "@{u}"); got != "origin/"+branch {
+		t.Errorf("upstream %q, want origin/%s", got, branch)
+	}
+	if _, err := loadManifest(m.Name); err != nil {
+		t.Error(err)
+	}
+
+	if err := bundleCommand([]string{"create", "missing"}, file); exitCode(err) != exitNotFound {
+		t.Errorf("bundling a missing package: %v", err)
+	}
+}
+
+func TestOpenBundlePaths(t *testing.T) {
+	testHome(t)
+	os.MkdirAll(baseDir, 0755)
+	index := `{"format": 1, "packages": [{"name": "../up", "repo": "own/up"}]}`
+	tests := []struct {
+		name    string
+		entries []string
+		wantErr bool
+	}{
+		{"plain", []string{bundleIndex, "repos/up/.git/HEAD"}, false},
+		{"dot dot", []string{bundleIndex, "repos/../../evil"}, true},
+		{"absolute", []string{bundleIndex, "/tmp/evil"}, true},
+		{"no index", []string{"repos/up/.git/HEAD"}, true},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		tw := tar.NewWriter(&buf)
+		for _, name := range tt.entries {
+			data := "ref: refs/heads/main\n"
+			if name == bundleIndex {
+				data = index
+			}
+			tw.WriteHeader(&tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(data))})
+			tw.Write([]byte(data))
+		}
+		tw.Close()
+		file := filepath.Join(t.TempDir(), "b.tar")
+		os.WriteFile(file, buf.Bytes(), 0644)
+
+		b, err := openBundle(file)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%s: %v", tt.name, err)
+		}
+		if err != nil {
+			continue
+		}
+		m, _ := b.manifest("own/up")
+		if err := b.checkout(m, "https://github.com/own/up.git", filepath.Join(packagesDir, "up")); exitCode(err) != exitVerify {
+			t.Errorf("%s: checked out a package named %q: %v", tt.name, m.Name, err)
+		}
+		b.close()
+	}
+	if left, _ := filepath.Glob(filepath.Join(baseDir, ".bundle-*")); len(left) != 0 {
+		t.Errorf("left unpacked bundles behind: %v", left)
+	}
+}
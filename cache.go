@@ -0,0 +1,304 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Git objects are cached in bare repositories under
+// ~/.ghpm/cache/git/<host>/<owner>/<repo>.git, one per repository, with a
+// ref refs/ghpm/<owner>/<repo> for the revision each package last had
+// checked out. A fork's entry is a symlink to its parent's repository when
+// that is cached, so a fork shares the objects it has in common.
+//
+// A clone borrows objects from the cache while it is checked out and then
+// copies what it used (git's --dissociate), so packages never depend on
+// the cache and "ghpm cache prune" cannot break them. Only the objects the
+// clone lacks, usually the file contents of changed files, are downloaded.
+// Offline, a package is cloned from the cache alone, at the revision and on
+// the branch (kept as the mirror's ghpm.<owner>/<repo>.branch setting) it
+// last had.
+
+func cacheDir() string {
+	return filepath.Join(baseDir, "cache", "git")
+}
+
+// mirrorPath returns the cache repository for a clone URL.
+func mirrorPath(cloneURL string) string {
+	u, err := url.Parse(cloneURL)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	path := strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git")
+	return filepath.Join(cacheDir(), u.Host, filepath.FromSlash(strings.ToLower(path))+".git")
+}
+
+func cacheRef(repo string) string {
+	return "refs/ghpm/" + strings.ToLower(repo)
+}
+
+// cachedMirror returns the cache repository to borrow objects from when
+// cloning repo: its own, or its parent's for a fork. It returns "" when
+// neither is cached.
+func cachedMirror(cloneURL string, health *repoHealth) string {
+	candidates := []string{mirrorPath(cloneURL)}
+	if health != nil && health.Parent != "" {
+		candidates = append(candidates, mirrorPath("https://github.com/"+health.Parent+".git"))
+	}
+	for _, path := range candidates {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(path, "objects")); err == nil {
+			return path
+		}
+	}
+	return ""
+}
+
+// cacheRevision stores the objects of a package's checked out revision in
+// the cache. The cache only saves downloads, so failures are reported and
+// otherwise ignored.
+func cacheRevision(m Manifest, health *repoHealth) {
+	mirror := mirrorPath(m.URL)
+	if mirror == "" {
+		return
+	}
+	if err := ensureMirror(mirror, m.URL, health); err != nil {
+		fmt.Println("Warning: could not cache", m.Repo+":", err)
+		return
+	}
+	// Without its whole history locally, a partial or shallow clone
+	// would fetch what it lacks from GitHub just to hand it on.
+	pkgPath := filepath.Join(packagesDir, m.Name)
+	args := []string{"fetch", "--quiet", "--update-shallow"}
+	if promisor, _ := gitOutput(pkgPath, "config", "remote.origin.promisor"); promisor == "true" || isShallow(pkgPath) {
+		args = append(args, "--depth", "1")
+	}
+	args = append(args, pkgPath, "+HEAD:"+cacheRef(m.Repo))
+	if _, err := gitOutput(mirror, args...); err != nil {
+		fmt.Println("Warning: could not cache", m.Repo+":", err)
+		return
+	}
+	key := "ghpm." + strings.ToLower(m.Repo) + ".branch"
+	if branch, err := gitOutput(pkgPath, "symbolic-ref", "--quiet", "--short", "HEAD"); err == nil {
+		gitOutput(mirror, "config", key, branch)
+	} else {
+		gitOutput(mirror, "config", "--unset", key)
+	}
+}
+
+// ensureMirror creates the cache repository at path: a symlink to the
+// parent's one for a fork whose parent is cached, or else a new bare
+// repository.
+func ensureMirror(path, cloneURL string, health *repoHealth) error {
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if parent := cachedMirror(cloneURL, health); parent != "" && parent != path {
+		return os.Symlink(parent, path)
+	}
+	cmd := exec.Command("git", "init", "--quiet", "--bare", path)
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// cloneFromCache clones cloneURL to dest like cloneRepo, borrowing the
+// objects mirror already has.
+func cloneFromCache(cloneURL, dest, mirror string, full bool) error {
+	if offline {
+		return cloneOffline(cloneURL, dest, mirror, full)
+	}
+	if full {
+		// git refuses a shallow repository as a reference, in which case
+		// this is a plain clone.
+		return runGit("", "clone", "--reference-if-able", mirror, "--dissociate", cloneURL, dest)
+	}
+	if err := runGit("", "clone", "--depth", "1", "--filter=blob:none", "--no-checkout", cloneURL, dest); err != nil {
+		return err
+	}
+	alternates := filepath.Join(dest, ".git", "objects", "info", "alternates")
+	if err := os.WriteFile(alternates, []byte(filepath.Join(mirror, "objects")+"\n"), 0644); err != nil {
+		return err
+	}
+	// The checkout finds cached file contents through the alternate and
+	// fetches only the rest; repacking then copies what it used.
+	if err := runGit(dest, "reset", "--quiet", "--hard", "HEAD"); err != nil {
+		return err
+	}
+	if err := runGit(dest, "repack", "-a", "-d", "--quiet"); err != nil {
+		return err
+	}
+	return os.Remove(alternates)
+}
+
+// cloneOffline clones the revision mirror holds for cloneURL's repository
+// without the network. origin still points at cloneURL, so the package
+// updates from GitHub later like any other.
+func cloneOffline(cloneURL, dest, mirror string, full bool) error {
+	u, err := url.Parse(cloneURL)
+	if err != nil {
+		return err
+	}
+	repo := strings.ToLower(strings.TrimSuffix(strings.Trim(u.Path, "/"), ".git"))
+	if _, err := gitOutput(mirror, "rev-parse", "--verify", "--quiet", cacheRef(repo)); err != nil {
+		return fmt.Errorf("%s is not in the cache", repo)
+	}
+	branch, _ := gitOutput(mirror, "config", "ghpm."+repo+".branch")
+
+	fmt.Println("Offline: cloning", repo, "from the cache")
+	fetch := []string{"fetch", "--quiet", "--no-tags"}
+	if !full {
+		fetch = append(fetch, "--depth", "1")
+	}
+	fetch = append(fetch, mirror, "+"+cacheRef(repo)+":refs/remotes/origin/"+branch)
+	checkout := []string{"checkout", "--quiet", "-b", branch, "--track", "origin/" + branch}
+	if branch == "" {
+		// The package was pinned to a tag or commit.
+		fetch[len(fetch)-1] = cacheRef(repo)
+		checkout = []string{"checkout", "--quiet", "--detach", "FETCH_HEAD"}
+	}
+	steps := [][]string{
+		{"init", "--quiet", dest},
+		{"-C", dest, "remote", "add", "origin", cloneURL},
+		append([]string{"-C", dest}, fetch...),
+		append([]string{"-C", dest}, checkout...),
+	}
+	if branch != "" {
+		steps = append(steps, []string{"-C", dest, "remote", "set-head", "origin", branch})
+	}
+	for _, args := range steps {
+		if err := runGit("", args...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runGit(dir string, args ...string) error {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// cacheEntry is a repository in the cache: a bare repository, or a
+// symlink to one for a fork.
+type cacheEntry struct {
+	Path   string
+	Target string // the repository a symlink points to, or ""
+	Repos  []string
+	Size   int64
+}
+
+func cacheEntries() []cacheEntry {
+	paths, _ := filepath.Glob(filepath.Join(cacheDir(), "*", "*", "*.git"))
+	var entries []cacheEntry
+	for _, path := range paths {
+		e := cacheEntry{Path: path}
+		if info, err := os.Lstat(path); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			e.Target, _ = os.Readlink(path)
+		} else {
+			e.Size = diskUsage(path)
+			refs, _ := gitOutput(path, "for-each-ref", "--format=%(refname)", "refs/ghpm/")
+			for _, ref := range strings.Fields(refs) {
+				e.Repos = append(e.Repos, strings.TrimPrefix(ref, "refs/ghpm/"))
+			}
+		}
+		entries = append(entries, e)
+	}
+	return entries
+}
+
+// cacheSize implements "ghpm cache size".
+func cacheSize() error {
+	entries := cacheEntries()
+	if len(entries) == 0 {
+		fmt.Println("The cache is empty.")
+		return nil
+	}
+	var total int64
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for _, e := range entries {
+		rel, _ := filepath.Rel(cacheDir(), e.Path)
+		if e.Target != "" {
+			target, _ := filepath.Rel(cacheDir(), e.Target)
+			fmt.Fprintf(tw, "%s\t-> %s\t\n", rel, target)
+			continue
+		}
+		total += e.Size
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", rel, formatSize(e.Size), strings.Join(e.Repos, ", "))
+	}
+	fmt.Fprintf(tw, "Total\t%s\t\n", formatSize(total))
+	tw.Flush()
+	fmt.Println("Location:", cacheDir())
+	return nil
+}
+
+// cachePrune implements "ghpm cache prune": it forgets the revisions of
+// packages that are no longer installed, removes repositories nothing
+// installed uses and compacts the rest. With all, it empties the cache.
+func cachePrune(all bool) error {
+	before := diskUsage(cacheDir())
+	if all {
+		if err := os.RemoveAll(cacheDir()); err != nil {
+			return err
+		}
+		fmt.Println("Removed the cache, freeing", formatSize(before))
+		return nil
+	}
+
+	installed := map[string]bool{}
+	for _, m := range loadAllManifests() {
+		installed[strings.ToLower(m.Repo)] = true
+	}
+	entries := cacheEntries()
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Target == "" && entries[j].Target != "" })
+
+	removed := map[string]bool{}
+	count := 0
+	for _, e := range entries {
+		if e.Target != "" {
+			owner := filepath.Base(filepath.Dir(e.Path))
+			repo := owner + "/" + strings.TrimSuffix(filepath.Base(e.Path), ".git")
+			if removed[e.Target] || !installed[repo] {
+				os.Remove(e.Path)
+				os.Remove(filepath.Dir(e.Path))
+			}
+			continue
+		}
+		var kept []string
+		for _, repo := range e.Repos {
+			if installed[repo] {
+				kept = append(kept, repo)
+			} else {
+				gitOutput(e.Path, "update-ref", "-d", "refs/ghpm/"+repo)
+				gitOutput(e.Path, "config", "--remove-section", "ghpm."+repo)
+			}
+		}
+		if len(kept) == 0 {
+			os.RemoveAll(e.Path)
+			// Fails, as it should, while the owner has other repositories.
+			os.Remove(filepath.Dir(e.Path))
+			removed[e.Path] = true
+			count++
+			continue
+		}
+		if _, err := gitOutput(e.Path, "gc", "--quiet", "--prune=now"); err != nil {
+			fmt.Println("Warning: git gc failed in", e.Path+":", err)
+		}
+	}
+	freed := max(before-diskUsage(cacheDir()), 0)
+	fmt.Printf("Removed %d unused repositories, freeing %s\n", count, formatSize(freed))
+	return nil
+}
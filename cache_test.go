@@ -0,0 +1,140 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// testCachedPackages sets up a home with a clone of one upstream repository
+// for each of repos, reached through https://github.com/<repo>.git, and
+// returns those URLs.
+func testCachedPackages(t *testing.T, repos ...string) []string {
+	t.Helper()
+	upstream := testUpstream(t, 3, map[int]string{2: "v1.0.0"})
+	home := testHome(t)
+	var config strings.Builder
+	var urls []string
+	for _, repo := range repos {
+		url := "https://github.com/" + repo + ".git"
+		config.WriteString("[url \"" + upstream + "\"]\n\tinsteadOf = " + url + "\n")
+		urls = append(urls, url)
+	}
+	if err := os.WriteFile(filepath.Join(home, ".gitconfig"), []byte(config.String()), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return urls
+}
+
+func installForTest(t *testing.T, repo, url string, health *repoHealth) Manifest {
+	t.Helper()
+	m := Manifest{Name: filepath.Base(repo), Repo: repo, URL: url}
+	if err := cloneRepo(url, filepath.Join(packagesDir, m.Name), false, cachedMirror(url, health)); err != nil {
+		t.Fatal(err)
+	}
+	saveManifest(m)
+	cacheRevision(m, health)
+	return m
+}
+
+func TestCacheOfflineClone(t *testing.T) {
+	urls := testCachedPackages(t, "own/up")
+	m := installForTest(t, "own/up", urls[0], nil)
+	pkgPath := filepath.Join(packagesDir, m.Name)
+	head, _ := gitOutput(pkgPath, "rev-parse", "HEAD")
+	branch, _ := gitOutput(pkgPath, "symbolic-ref", "--short", "HEAD")
+	os.RemoveAll(pkgPath)
+
+	// Nothing reachable but the cache.
+	os.Remove(filepath.Join(os.Getenv("HOME"), ".gitconfig"))
+	offline = true
+	defer func() { offline = false }()
+	mirror := cachedMirror(urls[0], nil)
+	if mirror == "" {
+		t.Fatal("the package is not cached")
+	}
+	if err := cloneRepo(urls[0], pkgPath, false, mirror); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := gitOutput(pkgPath, "rev-parse", "HEAD"); got != head {
+		t.Errorf("HEAD %s, want %s", got, head)
+	}
+	if got, _ := gitOutput(pkgPath, "rev-parse", "--abbrev-ref", "@{u}"); got != "origin/"+branch {
+		t.Errorf("upstream %q, want origin/%s", got, branch)
+	}
+	if got, _ := gitOutput(pkgPath, "remote", "get-url", "origin"); got != urls[0] {
+		t.Errorf("origin %s", got)
+	}
+	if _, err := os.Stat(filepath.Join(pkgPath, ".git", "objects", "info", "alternates")); err == nil {
+		t.Error("the clone depends on the cache")
+	}
+
+	if err := cloneRepo("https://github.com/own/other.git", filepath.Join(packagesDir, "other"), false, mirror); err == nil {
+		t.Error("cloned a repository the cache does not hold")
+	}
+}
+
+func TestCacheForksAndPrune(t *testing.T) {
+	urls := testCachedPackages(t, "own/up", "fork/upfork")
+	installForTest(t, "own/up", urls[0], nil)
+	installForTest(t, "fork/upfork", urls[1], &repoHealth{Parent: "own/up"})
+
+	parent, fork := mirrorPath(urls[0]), mirrorPath(urls[1])
+	if target, err := os.Readlink(fork); err != nil || target != parent {
+		t.Fatalf("fork entry links to %q (%v), want %s", target, err, parent)
+	}
+	entries := cacheEntries()
+	if len(entries) != 2 {
+		t.Fatalf("%d cache entries", len(entries))
+	}
+	for _, e := range entries {
+		if e.Path == parent && strings.Join(e.Repos, " ") != "fork/upfork own/up" {
+			t.Errorf("parent holds %v", e.Repos)
+		}
+		if e.Path == fork && e.Target != parent {
+			t.Errorf("fork entry %+v", e)
+		}
+	}
+	if err := cacheSize(); err != nil {
+		t.Error(err)
+	}
+
+	if err := cachePrune(false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(fork); err != nil {
+		t.Error("pruned the entry of an installed fork")
+	}
+
+	os.Remove(filepath.Join(manifestsDir, "upfork.json"))
+	if err := cachePrune(false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Lstat(fork); !os.IsNotExist(err) {
+		t.Error("kept the entry of a removed fork")
+	}
+	if _, err := gitOutput(parent, "rev-parse", "--verify", "--quiet", cacheRef("fork/upfork")); err == nil {
+		t.Error("kept the revision of a removed fork")
+	}
+	if _, err := gitOutput(parent, "rev-parse", "--verify", "--quiet", cacheRef("own/up")); err != nil {
+		t.Error("dropped the revision of an installed package")
+	}
+
+	os.Remove(filepath.Join(manifestsDir, "up.json"))
+	if err := cachePrune(false); err != nil {
+		t.Fatal(err)
+	}
+	if len(cacheEntries()) != 0 {
+		t.Error("kept repositories nothing installed uses")
+	}
+
+	os.RemoveAll(filepath.Join(packagesDir, "up"))
+	installForTest(t, "own/up", urls[0], nil)
+	if err := cachePrune(true); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(cacheDir()); !os.IsNotExist(err) {
+		t.Error("prune --all left the cache")
+	}
+}
@@ -0,0 +1,337 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"text/tabwriter"
+)
+
+// command is a ghpm subcommand. setup defines the command's flags on fs and
+// returns the function that runs it with the remaining arguments.
+type command struct {
+	name    string
+	args    string // argument synopsis for the usage line
+	summary string
+	minArgs int
+	// packages is set for commands whose arguments are installed package
+	// names, so shell completion can offer them.
+	packages bool
+	setup    func(fs *flag.FlagSet) func(args []string) error
+}
+
+// commands is filled in by init in main.go, in the order help lists them.
+var commands []*command
+
+func findCommand(name string) *command {
+	for _, c := range commands {
+		if c.name == name {
+			return c
+		}
+	}
+	return nil
+}
+
+// globalFlags holds the flags every command accepts, which may also be given
+// before the command name.
+type globalFlags struct {
+	quiet, offline *bool
+}
+
+// flagSet returns a fresh flag set for c with the global flags defined, and
+// the function that runs the command.
+func (c *command) flagSet() (*flag.FlagSet, globalFlags, func(args []string) error) {
+	fs := flag.NewFlagSet("ghpm "+c.name, flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	global := globalFlags{
+		quiet:   fs.Bool("quiet", false, "print only errors"),
+		offline: fs.Bool("offline", false, "fail at once instead of using the network"),
+	}
+	return fs, global, c.setup(fs)
+}
+
+func (c *command) usageLine() string {
+	line := "ghpm " + c.name
+	if c.args != "" {
+		line += " " + c.args
+	}
+	return line + " [flags]"
+}
+
+func (c *command) usageError() error {
+	return usageError("Usage: %s\nRun 'ghpm help %s' for details.", c.usageLine(), c.name)
+}
+
+func (c *command) printHelp(w io.Writer) {
+	fmt.Fprintln(w, "Usage:", c.usageLine())
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, c.summary+".")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Flags:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, f := range c.flags() {
+		fmt.Fprintf(tw, "  %s\t%s\n", f.synopsis(), f.usage)
+	}
+	fmt.Fprintf(tw, "  %s\t%s\n", "-h, --help", "show this help")
+	tw.Flush()
+}
+
+// flagInfo describes one flag of a command, with its aliases.
+type flagInfo struct {
+	names []string
+	value string // name of the value, or "" for a boolean flag
+	usage string
+}
+
+func (f flagInfo) synopsis() string {
+	var names []string
+	for _, n := range f.names {
+		names = append(names, dashed(n))
+	}
+	s := strings.Join(names, ", ")
+	if f.value != "" {
+		s += " <" + f.value + ">"
+	}
+	return s
+}
+
+// dashed writes one-letter flags with one dash and the rest with two.
+func dashed(name string) string {
+	if len(name) == 1 {
+		return "-" + name
+	}
+	return "--" + name
+}
+
+// flags lists the flags of c. Flags sharing a value, like --build and
+// --build-cmd, are aliases and are listed together.
+func (c *command) flags() []flagInfo {
+	fs, _, _ := c.flagSet()
+	var infos []flagInfo
+	var values []flag.Value
+	fs.VisitAll(func(f *flag.Flag) {
+		for i, v := range values {
+			if v == f.Value {
+				infos[i].names = append(infos[i].names, f.Name)
+				return
+			}
+		}
+		value, usage := flag.UnquoteUsage(f)
+		if isBoolFlag(f) {
+			value = ""
+		}
+		values = append(values, f.Value)
+		infos = append(infos, flagInfo{names: []string{f.Name}, value: value, usage: usage})
+	})
+	return infos
+}
+
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
+
+// parseArgs parses flags wherever they appear among args, so
+// "ghpm install owner/repo --no-build" works, and returns the other
+// arguments. Everything after "--" is an argument.
+func parseArgs(fs *flag.FlagSet, args []string) ([]string, error) {
+	var rest []string
+	for i, arg := range args {
+		if arg == "--" {
+			args, rest = args[:i], args[i+1:]
+			break
+		}
+	}
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+	return append(positional, rest...), nil
+}
+
+// flagArgs turns the flags set on fs back into arguments, leaving out skip,
+// so they can be passed on to worker processes.
+func flagArgs(fs *flag.FlagSet, skip ...string) []string {
+	var out []string
+	var seen []flag.Value
+	fs.Visit(func(f *flag.Flag) {
+		for _, name := range skip {
+			if f.Name == name {
+				return
+			}
+		}
+		for _, v := range seen {
+			if v == f.Value {
+				return
+			}
+		}
+		seen = append(seen, f.Value)
+		if list, ok := f.Value.(*flagList); ok {
+			for _, v := range *list {
+				out = append(out, "--"+f.Name+"="+v)
+			}
+			return
+		}
+		out = append(out, "--"+f.Name+"="+f.Value.String())
+	})
+	return out
+}
+
+// flagList is a flag that can be repeated, collecting every value.
+type flagList []string
+
+func (s *flagList) String() string {
+	if s == nil {
+		return ""
+	}
+	return strings.Join(*s, ", ")
+}
+
+func (s *flagList) Set(v string) error {
+	*s = append(*s, v)
+	return nil
+}
+
+// run executes the command named in os.Args and returns its error, if any.
+func run() error {
+	args := os.Args[1:]
+	for len(args) > 0 && isFlagArg(args[0]) {
+		switch strings.TrimLeft(args[0], "-") {
+		case "quiet":
+			setQuiet()
+		case "offline":
+			setOffline()
+		case "h", "help":
+			printUsage(os.Stdout)
+			return nil
+		case "version":
+			fmt.Println(versionString())
+			return nil
+		default:
+			return usageError("unknown flag %s\nRun 'ghpm help' for usage.", args[0])
+		}
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		printUsage(errOut)
+		return usageError("no command given")
+	}
+
+	name := args[0]
+	if name == "help" {
+		return helpCommand(args[1:])
+	}
+	c := findCommand(name)
+	if c == nil {
+		return usageError("unknown command: %s\nRun 'ghpm help' for a list of commands.", name)
+	}
+
+	fs, global, runCommand := c.flagSet()
+	positional, err := parseArgs(fs, args[1:])
+	if errors.Is(err, flag.ErrHelp) {
+		c.printHelp(os.Stdout)
+		return nil
+	}
+	if err != nil {
+		return usageError("%v\nRun 'ghpm help %s' for usage.", err, c.name)
+	}
+	if *global.quiet {
+		setQuiet()
+	}
+	if *global.offline {
+		setOffline()
+	}
+	if len(positional) < c.minArgs {
+		return c.usageError()
+	}
+
+	if err := initDirs(); err != nil {
+		return fmt.Errorf("failed to init directories: %v", err)
+	}
+	if !offline && (os.Getenv("GHPM_OFFLINE") != "" || loadConfig().Offline) {
+		setOffline()
+	}
+	if (c.name == "install" || c.name == "search") && !isWorker() {
+		warnMissingGPGKeys()
+	}
+	return runCommand(positional)
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprintln(w, "ghpm installs command-line tools from GitHub repositories.")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Usage: ghpm <command> [flags] [args]")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, c := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", c.name, c.summary)
+	}
+	fmt.Fprintf(tw, "  %s\t%s\n", "help", "Show help for ghpm or a command")
+	tw.Flush()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Global flags:")
+	tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintf(tw, "  %s\t%s\n", "--quiet", "print only errors")
+	fmt.Fprintf(tw, "  %s\t%s\n", "--offline", "fail at once instead of using the network")
+	fmt.Fprintf(tw, "  %s\t%s\n", "--version", "print the ghpm version")
+	fmt.Fprintf(tw, "  %s\t%s\n", "-h, --help", "show this help")
+	tw.Flush()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Run 'ghpm help <command>' for the flags of a command.")
+}
+
+// helpCommand implements "ghpm help [command]".
+func helpCommand(args []string) error {
+	if len(args) == 0 {
+		printUsage(os.Stdout)
+		return nil
+	}
+	c := findCommand(args[0])
+	if c == nil {
+		return usageError("unknown command: %s\nRun 'ghpm help' for a list of commands.", args[0])
+	}
+	c.printHelp(os.Stdout)
+	return nil
+}
+
+// version is set for releases with -ldflags "-X main.version=v1.2.3".
+// Other builds report the commit they were built from.
+var version = ""
+
+func versionString() string {
+	v := version
+	if info, ok := debug.ReadBuildInfo(); ok && v == "" {
+		if info.Main.Version != "" && info.Main.Version != "(devel)" {
+			v = info.Main.Version
+		} else {
+			settings := map[string]string{}
+			for _, s := range info.Settings {
+				settings[s.Key] = s.Value
+			}
+			if rev := settings["vcs.revision"]; rev != "" {
+				v = "dev+" + shortCommit(rev)
+				if settings["vcs.modified"] == "true" {
+					v += "-dirty"
+				}
+			}
+		}
+	}
+	if v == "" {
+		v = "dev"
+	}
+	return fmt.Sprintf("ghpm %s (%s %s/%s)", v, runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
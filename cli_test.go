@@ -0,0 +1,98 @@
+package main
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestGlobalFlagsAfterCommand(t *testing.T) {
+	tests := []struct {
+		args           []string
+		quiet, offline bool
+		positional     []string
+	}{
+		{[]string{"own/tool"}, false, false, []string{"own/tool"}},
+		{[]string{"--offline", "own/tool"}, false, true, []string{"own/tool"}},
+		{[]string{"own/tool", "--quiet", "--offline"}, true, true, []string{"own/tool"}},
+	}
+	for _, tt := range tests {
+		fs, global, _ := findCommand("install").flagSet()
+		positional, err := parseArgs(fs, tt.args)
+		if err != nil {
+			t.Errorf("%v: %v", tt.args, err)
+			continue
+		}
+		if *global.quiet != tt.quiet || *global.offline != tt.offline || !reflect.DeepEqual(positional, tt.positional) {
+			t.Errorf("%v: quiet %v, offline %v, args %v", tt.args, *global.quiet, *global.offline, positional)
+		}
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		args       []string
+		positional []string
+		noBuild    bool
+	}{
+		{[]string{"own/a", "--no-build", "own/b"}, []string{"own/a", "own/b"}, true},
+		{[]string{"--", "--no-build"}, []string{"--no-build"}, false},
+		{[]string{"own/a", "--", "-x", "own/b"}, []string{"own/a", "-x", "own/b"}, false},
+	}
+	for _, tt := range tests {
+		fs, _, _ := findCommand("install").flagSet()
+		positional, err := parseArgs(fs, tt.args)
+		if err != nil {
+			t.Errorf("%v: %v", tt.args, err)
+			continue
+		}
+		if !reflect.DeepEqual(positional, tt.positional) || fs.Lookup("no-build").Value.String() != strconv.FormatBool(tt.noBuild) {
+			t.Errorf("%v: args %v, --no-build %s", tt.args, positional, fs.Lookup("no-build").Value)
+		}
+	}
+}
+
+func TestFlagArgs(t *testing.T) {
+	fs, _, _ := findCommand("install").flagSet()
+	args := []string{"--build", "make all", "--build-cmd=make install", "--bin", "out/a", "-j", "3", "--no-build", "--full", "own/a"}
+	if _, err := parseArgs(fs, args); err != nil {
+		t.Fatal(err)
+	}
+	got := flagArgs(fs, "j", "jobs")
+	want := []string{"--bin=out/a", "--build=make all", "--build=make install", "--full=true", "--no-build=true"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("flagArgs = %q, want %q", got, want)
+	}
+
+	// A worker parses them back to the same flags.
+	worker, _, _ := findCommand("install").flagSet()
+	if _, err := parseArgs(worker, got); err != nil {
+		t.Fatal(err)
+	}
+	if again := flagArgs(worker); !reflect.DeepEqual(again, want) {
+		t.Errorf("after a round trip: %q", again)
+	}
+}
+
+func TestCommandFlags(t *testing.T) {
+	for _, c := range commands {
+		var b strings.Builder
+		c.printHelp(&b) // panics if a flag is defined twice
+		for _, global := range []string{"--quiet", "--offline"} {
+			if !strings.Contains(b.String(), global) {
+				t.Errorf("ghpm help %s does not list %s", c.name, global)
+			}
+		}
+	}
+	var aliases []string
+	for _, f := range findCommand("install").flags() {
+		if len(f.names) > 1 {
+			aliases = append(aliases, f.synopsis())
+		}
+	}
+	want := []string{"--build, --build-cmd <command>", "-j, --jobs <n>"}
+	if !reflect.DeepEqual(aliases, want) {
+		t.Errorf("install aliases %q, want %q", aliases, want)
+	}
+}
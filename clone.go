@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Packages are cloned shallow and partial by default: only the newest
+// commit (--depth 1) and, for any history fetched later, no file contents
+// until a checkout needs them (--filter=blob:none). install --full clones
+// the whole history instead. Older revisions are fetched when something
+// asks for one: a dependency constraint naming a tag, or a rollback.
+
+// cloneRepo clones url to dest, borrowing objects from mirror, a cache
+// repository, unless it is "".
+func cloneRepo(url, dest string, full bool, mirror string) error {
+	if mirror != "" {
+		return cloneFromCache(url, dest, mirror, full)
+	}
+	if full {
+		return runGit("", "clone", url, dest)
+	}
+	return runGit("", "clone", "--depth", "1", "--filter=blob:none", url, dest)
+}
+
+// isGitRepo reports whether repoPath is a repository of its own; a local
+// package copied from a plain directory is not.
+func isGitRepo(repoPath string) bool {
+	_, err := os.Stat(filepath.Join(repoPath, ".git"))
+	return err == nil
+}
+
+func isShallow(repoPath string) bool {
+	out, _ := gitOutput(repoPath, "rev-parse", "--is-shallow-repository")
+	return out == "true"
+}
+
+// unshallow fetches the rest of the history and all tags. A partial clone
+// stays partial: file contents of old revisions are still fetched lazily.
+func unshallow(repoPath string) error {
+	fmt.Println("Fetching the full history of", filepath.Base(repoPath))
+	cmd := exec.Command("git", "fetch", "--quiet", "--unshallow", "--tags", "origin")
+	cmd.Dir = repoPath
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func hasRevision(repoPath, ref string) bool {
+	_, err := gitOutput(repoPath, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	return err == nil
+}
+
+// ensureRevision makes ref available in the clone. In a shallow clone it
+// first fetches just that tag, branch or commit, and only fetches the
+// whole history when that is not enough (for example an abbreviated
+// commit).
+func ensureRevision(repoPath, ref string) error {
+	if hasRevision(repoPath, ref) || !isShallow(repoPath) {
+		return nil
+	}
+	if contains(remoteTags(repoPath), ref) {
+		gitOutput(repoPath, "fetch", "--quiet", "--depth", "1", "origin", "tag", ref)
+	} else if _, err := gitOutput(repoPath, "fetch", "--quiet", "--depth", "1", "origin", ref); err == nil && !hasRevision(repoPath, ref) {
+		// A full commit hash resolves once fetched; a branch is kept as
+		// origin/<branch>, which checkout turns into a local branch.
+		gitOutput(repoPath, "update-ref", "refs/remotes/origin/"+ref, "FETCH_HEAD")
+	}
+	if hasRevision(repoPath, ref) || hasRevision(repoPath, "origin/"+ref) {
+		return nil
+	}
+	return unshallow(repoPath)
+}
+
+// nearestTag returns the nearest tag of HEAD, as git describe finds it, or
+// "". A shallow clone only has the tags of the commits it has, so when none
+// is found and origin has tags, the history behind the shallow boundary is
+// fetched in growing steps until one turns up; tags pointing into it come
+// along. As the clone is partial this fetches commits and trees but no file
+// contents. After maxTagDepth commits it gives up rather than fetch the
+// whole history of a repository that has not tagged in a long time.
+func nearestTag(repoPath string) string {
+	tag, err := gitOutput(repoPath, "describe", "--tags", "--abbrev=0")
+	if err == nil || !isShallow(repoPath) || len(remoteTags(repoPath)) == 0 {
+		return tag
+	}
+	for fetched, step := 1, 16; fetched < maxTagDepth && isShallow(repoPath); fetched, step = fetched+step, step*4 {
+		if _, err := gitOutput(repoPath, "fetch", "--quiet", "--deepen", strconv.Itoa(step), "origin"); err != nil {
+			return ""
+		}
+		if tag, err := gitOutput(repoPath, "describe", "--tags", "--abbrev=0"); err == nil {
+			return tag
+		}
+	}
+	return ""
+}
+
+const maxTagDepth = 1024
+
+// remoteTags lists the tags on origin without fetching them.
+func remoteTags(repoPath string) []string {
+	out, err := gitOutput(repoPath, "ls-remote", "--tags", "--refs", "origin")
+	if err != nil {
+		return nil
+	}
+	var tags []string
+	for _, line := range strings.Split(out, "\n") {
+		if _, ref, ok := strings.Cut(line, "\trefs/tags/"); ok {
+			tags = append(tags, ref)
+		}
+	}
+	return tags
+}
+
+// diskUsage adds up the size of the files under paths.
+func diskUsage(paths ...string) int64 {
+	var total int64
+	for _, p := range paths {
+		filepath.WalkDir(p, func(_ string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			if info, err := d.Info(); err == nil {
+				total += info.Size()
+			}
+			return nil
+		})
+	}
+	return total
+}
+
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
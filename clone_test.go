@@ -0,0 +1,101 @@
+package main
+
+import (
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// testUpstream creates a repository with commits c1..cN and the given tags
+// (commit number to tag name), and returns its file:// URL, which unlike a
+// plain path allows shallow clones.
+func testUpstream(t *testing.T, commits int, tags map[int]string) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	for _, k := range []string{"GIT_AUTHOR_NAME", "GIT_COMMITTER_NAME"} {
+		t.Setenv(k, "ghpm")
+	}
+	for _, k := range []string{"GIT_AUTHOR_EMAIL", "GIT_COMMITTER_EMAIL"} {
+		t.Setenv(k, "ghpm@example.com")
+	}
+
+	dir := filepath.Join(t.TempDir(), "up")
+	git := func(args ...string) {
+		t.Helper()
+		if out, err := exec.Command("git", append([]string{"-C", dir}, args...)...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v\n%s", args, err, out)
+		}
+	}
+	if out, err := exec.Command("git", "init", "--quiet", dir).CombinedOutput(); err != nil {
+		t.Fatalf("git init: %v\n%s", err, out)
+	}
+	for i := 1; i <= commits; i++ {
+		git("commit", "--quiet", "--allow-empty", "-m", "c"+strconv.Itoa(i))
+		if tag, ok := tags[i]; ok {
+			git("tag", "-a", "-m", tag, tag)
+		}
+	}
+	return "file://" + dir
+}
+
+func testClone(t *testing.T, url string) string {
+	t.Helper()
+	dest := filepath.Join(t.TempDir(), "clone")
+	if err := cloneRepo(url, dest, false, ""); err != nil {
+		t.Fatal(err)
+	}
+	if !isShallow(dest) {
+		t.Fatal("clone is not shallow")
+	}
+	return dest
+}
+
+func TestNearestTagShallow(t *testing.T) {
+	url := testUpstream(t, 60, map[int]string{5: "v1.0.0", 12: "v1.1.0"})
+	dest := testClone(t, url)
+	if got := nearestTag(dest); got != "v1.1.0" {
+		t.Errorf("nearestTag = %q, want v1.1.0", got)
+	}
+
+	url = testUpstream(t, 3, nil)
+	dest = testClone(t, url)
+	if got := nearestTag(dest); got != "" {
+		t.Errorf("nearestTag without tags = %q", got)
+	}
+	if !isShallow(dest) {
+		t.Error("a repository without tags was deepened")
+	}
+}
+
+func TestCheckoutConstraintShallow(t *testing.T) {
+	url := testUpstream(t, 30, map[int]string{5: "v1.0.0", 12: "v1.1.0"})
+	tests := []struct {
+		constraint string
+		want       string // tag checked out, or "" for HEAD
+	}{
+		{">=1.0,<2", ""},
+		{"^1.0", ""},
+		{"<1.1", "v1.0.0"},
+		{"v1.1.0", "v1.1.0"},
+	}
+	for _, tt := range tests {
+		dest := testClone(t, url)
+		head, _ := gitOutput(dest, "rev-parse", "HEAD")
+		if err := checkoutConstraint(dest, tt.constraint); err != nil {
+			t.Errorf("%s: %v", tt.constraint, err)
+			continue
+		}
+		want := head
+		if tt.want != "" {
+			want, _ = gitOutput(dest, "rev-parse", tt.want+"^{commit}")
+		}
+		if got, _ := gitOutput(dest, "rev-parse", "HEAD"); got != want {
+			t.Errorf("%s: HEAD is %s, want %s", tt.constraint, got, want)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Completion scripts are generated from the command table, so they always
+// match the commands and flags of the binary that printed them. Installed
+// package names are looked up when completing, through "ghpm list".
+
+const listPackagesCmd = `ghpm list --format '{{.Name}}' 2>/dev/null`
+
+// completionCommand implements "ghpm completion bash|zsh|fish".
+func completionCommand(shell string) error {
+	switch shell {
+	case "bash":
+		fmt.Print(bashCompletion())
+	case "zsh":
+		fmt.Print(zshCompletion())
+	case "fish":
+		fmt.Print(fishCompletion())
+	default:
+		return usageError("unsupported shell %s (bash, zsh or fish)", shell)
+	}
+	return nil
+}
+
+func commandNames() []string {
+	var names []string
+	for _, c := range commands {
+		names = append(names, c.name)
+	}
+	return append(names, "help")
+}
+
+// flagWords lists the flags of c as typed on the command line.
+func flagWords(c *command) []string {
+	words := []string{"--help"}
+	for _, f := range c.flags() {
+		for _, n := range f.names {
+			words = append(words, dashed(n))
+		}
+	}
+	return words
+}
+
+// argWords is the shell code producing the arguments c completes, if any.
+func argWords(c *command) string {
+	switch {
+	case c.packages:
+		return "$(" + listPackagesCmd + ")"
+	case c.name == "completion":
+		return "bash zsh fish"
+	}
+	return ""
+}
+
+// shQuote quotes s for a POSIX shell or fish.
+func shQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
+func bashCompletion() string {
+	var b strings.Builder
+	b.WriteString("# bash completion for ghpm\n")
+	b.WriteString("# Load it with: source <(ghpm completion bash)\n\n")
+	b.WriteString("_ghpm() {\n")
+	b.WriteString("    local cur=${COMP_WORDS[COMP_CWORD]}\n")
+	b.WriteString("    if [[ $COMP_CWORD -eq 1 ]]; then\n")
+	fmt.Fprintf(&b, "        COMPREPLY=($(compgen -W %s -- \"$cur\"))\n", shQuote(strings.Join(commandNames(), " ")))
+	b.WriteString("        return\n")
+	b.WriteString("    fi\n")
+	b.WriteString("    local flags=\"\" words=\"\"\n")
+	b.WriteString("    case ${COMP_WORDS[1]} in\n")
+	for _, c := range commands {
+		fmt.Fprintf(&b, "        %s)\n", c.name)
+		fmt.Fprintf(&b, "            flags=%s\n", shQuote(strings.Join(flagWords(c), " ")))
+		if words := argWords(c); words != "" {
+			fmt.Fprintf(&b, "            words=\"%s\"\n", words)
+		}
+		b.WriteString("            ;;\n")
+	}
+	b.WriteString("        help)\n")
+	fmt.Fprintf(&b, "            words=%s\n", shQuote(strings.Join(commandNames(), " ")))
+	b.WriteString("            ;;\n")
+	b.WriteString("    esac\n")
+	b.WriteString("    if [[ $cur == -* ]]; then\n")
+	b.WriteString("        COMPREPLY=($(compgen -W \"$flags\" -- \"$cur\"))\n")
+	b.WriteString("    else\n")
+	b.WriteString("        COMPREPLY=($(compgen -W \"$words\" -- \"$cur\"))\n")
+	b.WriteString("    fi\n")
+	b.WriteString("}\n")
+	b.WriteString("complete -F _ghpm ghpm\n")
+	return b.String()
+}
+
+func zshCompletion() string {
+	var b strings.Builder
+	b.WriteString("#compdef ghpm\n")
+	b.WriteString("# zsh completion for ghpm\n")
+	b.WriteString("# Load it with: source <(ghpm completion zsh)\n\n")
+	b.WriteString("_ghpm() {\n")
+	b.WriteString("  local -a commands opts names\n")
+	b.WriteString("  commands=(\n")
+	for _, c := range commands {
+		fmt.Fprintf(&b, "    %s\n", shQuote(c.name+":"+strings.ReplaceAll(c.summary, ":", `\:`)))
+	}
+	b.WriteString("    'help:Show help for ghpm or a command'\n")
+	b.WriteString("  )\n")
+	b.WriteString("  if (( CURRENT == 2 )); then\n")
+	b.WriteString("    _describe 'command' commands\n")
+	b.WriteString("    return\n")
+	b.WriteString("  fi\n")
+	b.WriteString("  case ${words[2]} in\n")
+	for _, c := range commands {
+		fmt.Fprintf(&b, "    %s)\n", c.name)
+		fmt.Fprintf(&b, "      opts=(%s)\n", strings.Join(flagWords(c), " "))
+		switch {
+		case c.packages:
+			fmt.Fprintf(&b, "      names=(${(f)\"$(%s)\"})\n", listPackagesCmd)
+		case argWords(c) != "":
+			fmt.Fprintf(&b, "      names=(%s)\n", argWords(c))
+		}
+		b.WriteString("      ;;\n")
+	}
+	b.WriteString("    help)\n")
+	fmt.Fprintf(&b, "      names=(%s)\n", strings.Join(commandNames(), " "))
+	b.WriteString("      ;;\n")
+	b.WriteString("  esac\n")
+	b.WriteString("  if [[ $PREFIX == -* ]]; then\n")
+	b.WriteString("    compadd -a opts\n")
+	b.WriteString("  else\n")
+	b.WriteString("    compadd -a names\n")
+	b.WriteString("  fi\n")
+	b.WriteString("}\n\n")
+	b.WriteString("if [[ $funcstack[1] == _ghpm ]]; then\n")
+	b.WriteString("  _ghpm \"$@\"\n")
+	b.WriteString("else\n")
+	b.WriteString("  compdef _ghpm ghpm\n")
+	b.WriteString("fi\n")
+	return b.String()
+}
+
+func fishCompletion() string {
+	var b strings.Builder
+	b.WriteString("# fish completion for ghpm\n")
+	b.WriteString("# Load it with: ghpm completion fish | source\n\n")
+	b.WriteString("complete -c ghpm -f\n")
+	for _, c := range commands {
+		fmt.Fprintf(&b, "complete -c ghpm -n __fish_use_subcommand -a %s -d %s\n", c.name, shQuote(c.summary))
+	}
+	b.WriteString("complete -c ghpm -n __fish_use_subcommand -a help -d 'Show help for ghpm or a command'\n")
+	for _, c := range commands {
+		cond := shQuote("__fish_seen_subcommand_from " + c.name)
+		for _, f := range c.flags() {
+			for _, n := range f.names {
+				opt := "-l " + n
+				if len(n) == 1 {
+					opt = "-s " + n
+				}
+				if f.value != "" {
+					opt += " -r"
+				}
+				fmt.Fprintf(&b, "complete -c ghpm -n %s %s -d %s\n", cond, opt, shQuote(f.usage))
+			}
+		}
+		switch {
+		case c.packages:
+			fmt.Fprintf(&b, "complete -c ghpm -n %s -a %s\n", cond, shQuote("("+strings.ReplaceAll(listPackagesCmd, "'", `"`)+")"))
+		case argWords(c) != "":
+			fmt.Fprintf(&b, "complete -c ghpm -n %s -a %s\n", cond, shQuote(argWords(c)))
+		}
+	}
+	fmt.Fprintf(&b, "complete -c ghpm -n %s -a %s\n", shQuote("__fish_seen_subcommand_from help"), shQuote(strings.Join(commandNames(), " ")))
+	return b.String()
+}
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCompletionScripts(t *testing.T) {
+	scripts := map[string]string{"bash": bashCompletion(), "zsh": zshCompletion(), "fish": fishCompletion()}
+	for shell, script := range scripts {
+		for _, want := range []string{"install", "remove", "completion", "no-build", "offline", "ghpm list"} {
+			if !strings.Contains(script, want) {
+				t.Errorf("%s script lacks %q", shell, want)
+			}
+		}
+		if _, err := exec.LookPath(shell); err != nil {
+			continue
+		}
+		file := filepath.Join(t.TempDir(), "ghpm."+shell)
+		os.WriteFile(file, []byte(script), 0644)
+		if out, err := exec.Command(shell, "-n", file).CombinedOutput(); err != nil {
+			t.Errorf("%s script does not parse: %v\n%s", shell, err, out)
+		}
+	}
+	if err := completionCommand("powershell"); exitCode(err) != exitUsage {
+		t.Errorf("unsupported shell: %v", err)
+	}
+}
+
+// The bash script completes installed packages through ghpm list.
+func TestBashCompletion(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash is not installed")
+	}
+	bin := t.TempDir()
+	fake := "#!/bin/sh\nprintf 'fzf\\nripgrep\\n'\n"
+	if err := os.WriteFile(filepath.Join(bin, "ghpm"), []byte(fake), 0755); err != nil {
+		t.Fatal(err)
+	}
+	complete := func(words ...string) string {
+		script := bashCompletion() + `
+COMP_WORDS=("$@")
+COMP_CWORD=$(($# - 1))
+_ghpm
+echo "${COMPREPLY[*]}"
+`
+		cmd := exec.Command("bash", append([]string{"-c", script, "bash"}, words...)...)
+		cmd.Env = append(os.Environ(), "PATH="+bin+":"+os.Getenv("PATH"))
+		out, err := cmd.Output()
+		if err != nil {
+			t.Fatalf("%v: %v", words, err)
+		}
+		return strings.TrimSpace(string(out))
+	}
+	tests := []struct {
+		words []string
+		want  string
+	}{
+		{[]string{"ghpm", "upd"}, "update"},
+		{[]string{"ghpm", "remove", ""}, "fzf ripgrep"},
+		{[]string{"ghpm", "info", "r"}, "ripgrep"},
+		{[]string{"ghpm", "install", "--no-b"}, "--no-build"},
+		{[]string{"ghpm", "completion", "f"}, "fish"},
+	}
+	for _, tt := range tests {
+		if got := complete(tt.words...); got != tt.want {
+			t.Errorf("completing %q: %q, want %q", tt.words, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Config holds user settings from ~/.ghpm/config.json. Keys are flat so they
+// can be read and written with "ghpm config <key> [value]".
+type Config struct {
+	// RecipeIndex is a git URL or a local directory holding recipes laid
+	// out as <owner>/<repo>.json|.yml|.yaml.
+	RecipeIndex string `json:"recipe_index,omitempty"`
+
+	// Toolchains lets ghpm fetch the Go, Node and Rust versions a build
+	// declares into ~/.ghpm/toolchains. The mirrors default to the
+	// official download sites.
+	Toolchains bool   `json:"toolchains,omitempty"`
+	GoMirror   string `json:"go_mirror,omitempty"`
+	NodeMirror string `json:"node_mirror,omitempty"`
+	RustMirror string `json:"rust_mirror,omitempty"`
+
+	// RefuseArchived and RefuseUnlicensed turn those health warnings into
+	// errors; install --force overrides them.
+	RefuseArchived   bool `json:"refuse_archived,omitempty"`
+	RefuseUnlicensed bool `json:"refuse_unlicensed,omitempty"`
+
+	// LicenseAllow and LicenseDeny are SPDX identifiers, or their prefixes
+	// such as "AGPL", that install accepts or refuses; see license.go.
+	LicenseAllow stringList `json:"license_allow,omitempty"`
+	LicenseDeny  stringList `json:"license_deny,omitempty"`
+
+	// Offline is the default for the global --offline flag; see offline.go.
+	Offline bool `json:"offline,omitempty"`
+}
+
+func configPath() string {
+	return filepath.Join(baseDir, "config.json")
+}
+
+// loadConfig reads the config file. A missing file yields the defaults.
+// GHPM_RECIPE_INDEX overrides the recipe_index setting.
+func loadConfig() Config {
+	cfg := readConfigFile()
+	if v := os.Getenv("GHPM_RECIPE_INDEX"); v != "" {
+		cfg.RecipeIndex = v
+	}
+	return cfg
+}
+
+func readConfigFile() Config {
+	var cfg Config
+	if data, err := os.ReadFile(configPath()); err == nil {
+		if err := json.Unmarshal(data, &cfg); err != nil {
+			fmt.Println("Warning: ignoring invalid", configPath()+":", err)
+		}
+	}
+	return cfg
+}
+
+func saveConfig(cfg Config) error {
+	data, err := json.MarshalIndent(cfg, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(configPath(), data, 0644)
+}
+
+// configKeys lists the settable keys, taken from Config's JSON tags.
+func configKeys() []string {
+	var keys []string
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// configFields returns cfg as a map holding every key, set or not.
+func configFields(cfg Config) map[string]any {
+	fields := map[string]any{}
+	data, _ := json.Marshal(cfg)
+	json.Unmarshal(data, &fields)
+	for _, key := range configKeys() {
+		if _, ok := fields[key]; !ok {
+			fields[key] = nil
+		}
+	}
+	return fields
+}
+
+// configCommand implements "ghpm config", "ghpm config <key>" and
+// "ghpm config <key> <value>". Values that parse as JSON are stored as
+// such, so lists and booleans can be set too.
+func configCommand(args []string) error {
+	fields := configFields(readConfigFile())
+
+	if len(args) == 0 {
+		fmt.Println("Config file:", configPath())
+		for _, key := range configKeys() {
+			if fields[key] == nil {
+				fmt.Printf("%s =\n", key)
+				continue
+			}
+			data, _ := json.Marshal(fields[key])
+			fmt.Printf("%s = %s\n", key, data)
+		}
+		return nil
+	}
+
+	key := args[0]
+	if _, ok := fields[key]; !ok {
+		return usageError("unknown config key %s (keys: %s)", key, strings.Join(configKeys(), ", "))
+	}
+
+	if len(args) == 1 {
+		if fields[key] != nil {
+			data, _ := json.Marshal(fields[key])
+			fmt.Println(string(data))
+		}
+		return nil
+	}
+
+	var value any
+	if err := json.Unmarshal([]byte(args[1]), &value); err != nil {
+		value = args[1]
+	}
+	if args[1] == "" {
+		value = nil
+	}
+	fields[key] = value
+
+	data, _ := json.Marshal(fields)
+	var updated Config
+	if err := json.Unmarshal(data, &updated); err != nil {
+		return usageError("invalid value for %s: %v", key, err)
+	}
+	if err := saveConfig(updated); err != nil {
+		return fmt.Errorf("failed to save config: %v", err)
+	}
+	fmt.Println("Set", key)
+	return nil
+}
@@ -0,0 +1,334 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// dependency is one parsed "owner/repo@constraint" entry from a recipe or
+// manifest. Constraint is either empty (any version), a comma separated
+// list of comparisons (">=1.2,<2", "^1.4", "~0.3") checked against the
+// package's version tag, or a bare git ref (tag, branch or commit) that
+// must be checked out exactly.
+type dependency struct {
+	Repo       string
+	Constraint string
+}
+
+func parseDependency(s string) (dependency, error) {
+	repo, constraint, _ := strings.Cut(strings.TrimSpace(s), "@")
+	if strings.Count(repo, "/") != 1 || strings.HasPrefix(repo, "/") || strings.HasSuffix(repo, "/") {
+		return dependency{}, fmt.Errorf("invalid dependency %q: want owner/repo[@constraint]", s)
+	}
+	return dependency{Repo: repo, Constraint: strings.TrimSpace(constraint)}, nil
+}
+
+func (d dependency) String() string {
+	if d.Constraint == "" {
+		return d.Repo
+	}
+	return d.Repo + "@" + d.Constraint
+}
+
+// isRangeConstraint reports whether c compares versions rather than naming
+// a ref.
+func isRangeConstraint(c string) bool {
+	return strings.ContainsAny(c[:1], "<>=^~")
+}
+
+// satisfies reports whether an installed package meets constraint.
+func satisfies(m Manifest, constraint string) bool {
+	if constraint == "" {
+		return true
+	}
+	if !isRangeConstraint(constraint) {
+		return m.Version == constraint || (len(constraint) >= 7 && strings.HasPrefix(m.Commit, constraint))
+	}
+	if m.Version == "" {
+		return false
+	}
+	return versionSatisfies(m.Version, constraint)
+}
+
+// versionSatisfies checks version against every comma separated comparison
+// in constraint.
+func versionSatisfies(version, constraint string) bool {
+	for _, part := range strings.Split(constraint, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		op := part[:len(part)-len(strings.TrimLeft(part, "<>=^~"))]
+		want := strings.TrimSpace(strings.TrimPrefix(part, op))
+		cmp := compareVersions(version, want)
+		ok := false
+		switch op {
+		case ">=":
+			ok = cmp >= 0
+		case ">":
+			ok = cmp > 0
+		case "<=":
+			ok = cmp <= 0
+		case "<":
+			ok = cmp < 0
+		case "=", "==", "":
+			ok = cmp == 0
+		case "^":
+			// Same major version; for 0.x the minor version is the major.
+			w, v := versionParts(want), versionParts(version)
+			ok = cmp >= 0 && len(w) > 0 && len(v) > 0 && v[0] == w[0]
+			if ok && w[0] == 0 && len(w) > 1 {
+				ok = len(v) > 1 && v[1] == w[1]
+			}
+		case "~":
+			w, v := versionParts(want), versionParts(version)
+			ok = cmp >= 0 && len(w) > 0 && len(v) > 0 && v[0] == w[0]
+			if ok && len(w) > 1 {
+				ok = len(v) > 1 && v[1] == w[1]
+			}
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// checkoutConstraint moves a fresh clone to the revision a dependency
+// constraint asks for: the named ref, or the newest tag in range when HEAD
+// is not already in range.
+func checkoutConstraint(repoPath, constraint string) error {
+	if constraint == "" {
+		return nil
+	}
+	ref := constraint
+	if isRangeConstraint(constraint) {
+		current := nearestTag(repoPath)
+		if current != "" && versionSatisfies(current, constraint) {
+			return nil
+		}
+		tags, _ := gitOutput(repoPath, "tag", "--list")
+		candidates := strings.Fields(tags)
+		if isShallow(repoPath) {
+			candidates = remoteTags(repoPath)
+		}
+		ref = ""
+		for _, tag := range candidates {
+			if versionSatisfies(tag, constraint) && (ref == "" || compareVersions(tag, ref) > 0) {
+				ref = tag
+			}
+		}
+		if ref == "" {
+			return fmt.Errorf("no tag satisfies %s", constraint)
+		}
+	}
+
+	if err := ensureRevision(repoPath, ref); err != nil {
+		return err
+	}
+	fmt.Println("Checking out", ref, "to satisfy", constraint)
+	cmd := exec.Command("git", "checkout", "--quiet", ref)
+	cmd.Dir = repoPath
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func gitOutput(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+// recordRevision stores the checked out commit and nearest tag.
+func recordRevision(m *Manifest, repoPath string) {
+	m.Commit, _ = gitOutput(repoPath, "rev-parse", "HEAD")
+	m.Version = nearestTag(repoPath)
+}
+
+// deepenVersion fetches the full history of a shallow package to find the
+// nearest tag, and records it.
+func deepenVersion(m Manifest) Manifest {
+	pkgPath := filepath.Join(packagesDir, m.Name)
+	if !isShallow(pkgPath) || unshallow(pkgPath) != nil {
+		return m
+	}
+	recordRevision(&m, pkgPath)
+	saveManifest(m)
+	return m
+}
+
+func loadAllManifests() []Manifest {
+	files, _ := os.ReadDir(manifestsDir)
+	var all []Manifest
+	for _, f := range files {
+		// Skips the temporary files of writes in progress.
+		if filepath.Ext(f.Name()) != ".json" || strings.HasPrefix(f.Name(), ".") {
+			continue
+		}
+		if m, err := loadManifest(strings.TrimSuffix(f.Name(), ".json")); err == nil {
+			all = append(all, m)
+		}
+	}
+	return all
+}
+
+func findManifestByRepo(repo string) (Manifest, bool) {
+	for _, m := range loadAllManifests() {
+		if strings.EqualFold(m.Repo, repo) {
+			return m, true
+		}
+	}
+	return Manifest{}, false
+}
+
+// dependents returns the installed packages that depend on m.
+func dependents(m Manifest) []Manifest {
+	var out []Manifest
+	for _, other := range loadAllManifests() {
+		for _, raw := range other.Depends {
+			if d, err := parseDependency(raw); err == nil && strings.EqualFold(d.Repo, m.Repo) {
+				out = append(out, other)
+				break
+			}
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Name < out[j].Name })
+	return out
+}
+
+// installDependencies makes sure every dependency of repo is installed and
+// satisfied, installing missing ones first (depth first, so the order is
+// topological). parent is how repo itself is being installed: its chain of
+// packages above it is used to report cycles, and its build choices are
+// passed on.
+func installDependencies(repo string, deps []string, parent installOptions) error {
+	chain := append(parent.chain, repo)
+	for _, raw := range deps {
+		d, err := parseDependency(raw)
+		if err != nil {
+			return usageError("%v", err)
+		}
+		for _, parent := range chain {
+			if strings.EqualFold(parent, d.Repo) {
+				return verifyError("dependency cycle: %s", strings.Join(append(chain, d.Repo), " -> "))
+			}
+			// The package above holds the lock on its name, so a
+			// dependency with the same name would wait on it forever.
+			if name := path.Base(d.Repo); strings.EqualFold(path.Base(parent), name) {
+				return verifyError("cannot install %s: the package name %s is taken by %s", d.Repo, name, parent)
+			}
+		}
+
+		if m, ok := findManifestByRepo(d.Repo); ok {
+			if !satisfies(m, d.Constraint) && m.Version == "" && isRangeConstraint(d.Constraint) {
+				// nearestTag gives up on a shallow clone whose last tag
+				// is far back; the full history may still have one.
+				m = deepenVersion(m)
+			}
+			if !satisfies(m, d.Constraint) {
+				have := m.Version
+				if have == "" {
+					have = shortCommit(m.Commit)
+				}
+				return verifyError("%s needs %s, but %s is installed at %s", repo, d, m.Name, have)
+			}
+			continue
+		}
+
+		fmt.Println("Installing dependency", d, "for", repo)
+		if err := installRepo(d.Repo, installOptions{
+			Constraint:    d.Constraint,
+			AsDependency:  true,
+			NoBuild:       parent.NoBuild,
+			SkipPreflight: parent.SkipPreflight,
+			Force:         parent.Force,
+			Full:          parent.Full,
+			Bundle:        parent.Bundle,
+			chain:         chain,
+		}); err != nil {
+			return fmt.Errorf("failed to install dependency %s: %w", d, err)
+		}
+	}
+	return nil
+}
+
+func shortCommit(commit string) string {
+	if len(commit) > 7 {
+		return commit[:7]
+	}
+	return commit
+}
+
+// removeDependents removes every package that depends on m, deepest first.
+func removeDependents(m Manifest, seen map[string]bool) error {
+	for _, dep := range dependents(m) {
+		if seen[dep.Name] {
+			continue
+		}
+		seen[dep.Name] = true
+		if err := removeDependents(dep, seen); err != nil {
+			return err
+		}
+		if err := removePackage(dep.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// orphanedPackages returns dependency packages that nothing depends on.
+func orphanedPackages() []Manifest {
+	var orphans []Manifest
+	for _, m := range loadAllManifests() {
+		if m.AsDependency && len(dependents(m)) == 0 {
+			orphans = append(orphans, m)
+		}
+	}
+	return orphans
+}
+
+// autoremove removes orphaned dependency packages, repeating until removing
+// one no longer orphans another. With dryRun it only reports what would go.
+func autoremove(dryRun bool) error {
+	gone := map[string]bool{}
+	for {
+		var batch []Manifest
+		for _, m := range loadAllManifests() {
+			if !m.AsDependency || gone[m.Name] {
+				continue
+			}
+			needed := false
+			for _, d := range dependents(m) {
+				if !gone[d.Name] {
+					needed = true
+					break
+				}
+			}
+			if !needed {
+				batch = append(batch, m)
+			}
+		}
+		if len(batch) == 0 {
+			break
+		}
+		for _, m := range batch {
+			gone[m.Name] = true
+			if dryRun {
+				fmt.Println("Would remove", m.Name, "("+m.Repo+")")
+			} else if err := removePackage(m.Name); err != nil {
+				return err
+			}
+		}
+	}
+	if len(gone) == 0 {
+		fmt.Println("No orphaned packages.")
+	}
+	return nil
+}
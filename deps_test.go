@@ -0,0 +1,156 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseDependency(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    dependency
+		wantErr bool
+	}{
+		{in: "own/a", want: dependency{Repo: "own/a"}},
+		{in: " own/a@>=1.2, <2 ", want: dependency{Repo: "own/a", Constraint: ">=1.2, <2"}},
+		{in: "own/a@v1.4.0", want: dependency{Repo: "own/a", Constraint: "v1.4.0"}},
+		{in: "own/a@ ^0.3", want: dependency{Repo: "own/a", Constraint: "^0.3"}},
+		{in: "own/a@", want: dependency{Repo: "own/a"}},
+		{in: "a", wantErr: true},
+		{in: "own/a/b", wantErr: true},
+		{in: "/a", wantErr: true},
+		{in: "own/", wantErr: true},
+		{in: "@v1", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := parseDependency(tt.in)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("parseDependency(%q) = %+v, want an error", tt.in, got)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("parseDependency(%q) = %+v, %v, want %+v", tt.in, got, err, tt.want)
+		}
+	}
+}
+
+func TestDependencyString(t *testing.T) {
+	for _, s := range []string{"own/a", "own/a@^1.2"} {
+		d, err := parseDependency(s)
+		if err != nil || d.String() != s {
+			t.Errorf("round trip of %q gave %q, %v", s, d.String(), err)
+		}
+	}
+}
+
+func TestVersionSatisfies(t *testing.T) {
+	tests := []struct {
+		version, constraint string
+		want                bool
+	}{
+		{"v1.2.0", ">=1.2", true},
+		{"v1.1.9", ">=1.2", false},
+		{"1.2.0", ">1.2", false},
+		{"1.2.1", ">1.2", true},
+		{"2.0.0", "<2", false},
+		{"1.9.9", "<2", true},
+		{"2.0", "<=2.0.0", true},
+		{"v1.5.0", ">=1.2,<2", true},
+		{"v2.0.0", ">=1.2, <2", false},
+		{"1.4.0", "=1.4", true},
+		{"1.4.0", "==1.4.0", true},
+		{"1.4.1", "1.4.0", false},
+
+		// ^ keeps the major version, or the minor one below 1.0.
+		{"1.9.0", "^1.4", true},
+		{"1.3.0", "^1.4", false},
+		{"2.0.0", "^1.4", false},
+		{"0.3.5", "^0.3.1", true},
+		{"0.4.0", "^0.3.1", false},
+
+		// ~ keeps the minor version when one is given.
+		{"1.4.9", "~1.4", true},
+		{"1.5.0", "~1.4", false},
+		{"1.9.0", "~1", true},
+		{"2.0.0", "~1", false},
+
+		{"1.0.0", ",", true},
+	}
+	for _, tt := range tests {
+		if got := versionSatisfies(tt.version, tt.constraint); got != tt.want {
+			t.Errorf("versionSatisfies(%q, %q) = %v, want %v", tt.version, tt.constraint, got, tt.want)
+		}
+	}
+}
+
+func TestSatisfies(t *testing.T) {
+	m := Manifest{Version: "v1.4.0", Commit: "0123456789abcdef"}
+	tests := []struct {
+		constraint string
+		want       bool
+	}{
+		{"", true},
+		{">=1.0", true},
+		{"<1.0", false},
+		{"v1.4.0", true},
+		{"0123456", true},
+		{"012345", false}, // too short to name a commit
+		{"main", false},
+	}
+	for _, tt := range tests {
+		if got := satisfies(m, tt.constraint); got != tt.want {
+			t.Errorf("satisfies(%q) = %v, want %v", tt.constraint, got, tt.want)
+		}
+	}
+	if satisfies(Manifest{Commit: "abc"}, ">=1.0") {
+		t.Error("a package without a version satisfied a range")
+	}
+}
+
+// testHome points HOME, and with it ~/.ghpm, at a new temporary directory.
+func testHome(t *testing.T) string {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := initDirs(); err != nil {
+		t.Fatal(err)
+	}
+	return home
+}
+
+func TestInstallDependenciesNameTaken(t *testing.T) {
+	testHome(t)
+	tests := []struct {
+		chain []string
+		dep   string
+		want  string
+	}{
+		{nil, "owner2/tool", "the package name tool is taken by owner1/tool"},
+		{nil, "owner2/Tool", "the package name Tool is taken by owner1/tool"},
+		{[]string{"own/other"}, "owner2/other", "the package name other is taken by own/other"},
+	}
+	for _, tt := range tests {
+		// installRepo holds the lock on the package while it installs the
+		// dependencies; a dependency taking it again would wait forever.
+		lock, err := lockPackageCleanly("tool")
+		if err != nil {
+			t.Fatal(err)
+		}
+		done := make(chan error, 1)
+		go func() {
+			done <- installDependencies("owner1/tool", []string{tt.dep}, installOptions{chain: tt.chain})
+		}()
+		select {
+		case err := <-done:
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("chain %v, dependency %s: %v", tt.chain, tt.dep, err)
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatalf("chain %v, dependency %s: still waiting", tt.chain, tt.dep)
+		}
+		lock.unlock()
+	}
+}
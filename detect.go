@@ -0,0 +1,276 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// buildSignal is one piece of evidence that a repo is built with a given
+// build system. Patterns are lowercase globs matched against root file names.
+type buildSignal struct {
+	Pattern     string
+	BuildSystem string
+	Weight      int
+}
+
+var buildSignals = []buildSignal{
+	{"go.mod", "go", 100},
+	{"cargo.toml", "cargo", 100},
+	{"package.json", "npm", 90},
+	{"deno.json", "deno", 95},
+	{"deno.jsonc", "deno", 95},
+	{"pyproject.toml", "pip", 90},
+	{"setup.py", "pip", 85},
+	{"requirements.txt", "pip", 40},
+	{"*.gemspec", "ruby", 80},
+	{"gemfile", "ruby", 50},
+	{"stack.yaml", "stack", 95},
+	{"mix.exs", "mix", 95},
+	{"composer.json", "composer", 90},
+	{"*.csproj", "dotnet", 90},
+	{"*.fsproj", "dotnet", 90},
+	{"*.sln", "dotnet", 60},
+	{"dune-project", "dune", 95},
+	{"build.zig", "zig", 95},
+	{"meson.build", "meson", 80},
+	{"cmakelists.txt", "cmake", 70},
+	{"configure", "autotools", 65},
+	{"configure.ac", "autotools", 55},
+	{"makefile", "make", 30},
+	{"gnumakefile", "make", 30},
+	{"justfile", "just", 20},
+	{"*install*.sh", "shell", 10},
+}
+
+// buildSystemLanguages maps each build system to the language recorded in
+// the manifest and used to pick binaries in linkBinaries.
+var buildSystemLanguages = map[string]string{
+	"go":        "Go",
+	"cargo":     "Rust",
+	"npm":       "Node",
+	"deno":      "Deno",
+	"pip":       "Python",
+	"ruby":      "Ruby",
+	"stack":     "Haskell",
+	"mix":       "Elixir",
+	"composer":  "PHP",
+	"dotnet":    "C#",
+	"dune":      "OCaml",
+	"zig":       "Zig",
+	"meson":     "C/C++",
+	"cmake":     "C/C++",
+	"autotools": "C/C++",
+	"make":      "C/C++",
+	"just":      "Just",
+	"shell":     "Shell",
+}
+
+// wrapperHints are commands that, when found in a Makefile or Justfile, show
+// the task runner is only a wrapper around another build system.
+var wrapperHints = map[string][]string{
+	"go":     {"go build", "go install"},
+	"cargo":  {"cargo build", "cargo install"},
+	"npm":    {"npm ", "yarn ", "pnpm "},
+	"pip":    {"pip install", "python -m build", "python setup.py"},
+	"zig":    {"zig build"},
+	"dotnet": {"dotnet "},
+	"mix":    {"mix "},
+	"stack":  {"stack "},
+	"dune":   {"dune "},
+	"cmake":  {"cmake "},
+	"meson":  {"meson "},
+}
+
+const wrapperBonus = 15
+
+// detection is one ranked candidate build system for a repo.
+type detection struct {
+	BuildSystem string
+	Language    string
+	Score       int
+	Reasons     []string
+}
+
+// detectBuildSystems ranks every build system with evidence at the root of
+// repoPath, best first.
+func detectBuildSystems(repoPath string) []detection {
+	entries, err := os.ReadDir(repoPath)
+	if err != nil {
+		return nil
+	}
+	var names []string
+	for _, e := range entries {
+		if !e.IsDir() {
+			names = append(names, e.Name())
+		}
+	}
+	return detectFrom(names, func(name string) []byte {
+		data, _ := os.ReadFile(filepath.Join(repoPath, name))
+		return data
+	})
+}
+
+// detectFrom ranks build systems given the file names at a repo root and a
+// way to read their contents, so it works on a clone or on an API listing.
+func detectFrom(names []string, read func(name string) []byte) []detection {
+	found := map[string]*detection{}
+	hasFile := map[string]bool{}
+	add := func(system string, weight int, reason string) {
+		d, ok := found[system]
+		if !ok {
+			d = &detection{BuildSystem: system, Language: buildSystemLanguages[system]}
+			found[system] = d
+		}
+		d.Score += weight
+		d.Reasons = append(d.Reasons, reason)
+	}
+
+	for _, name := range names {
+		lower := strings.ToLower(name)
+		for _, sig := range buildSignals {
+			if ok, _ := filepath.Match(sig.Pattern, lower); ok {
+				add(sig.BuildSystem, sig.Weight, name)
+				hasFile[sig.BuildSystem] = true
+			}
+		}
+
+		if lower == "makefile" || lower == "gnumakefile" || lower == "justfile" {
+			content := string(read(name))
+			for system, hints := range wrapperHints {
+				for _, hint := range hints {
+					if containsCommand(content, hint) {
+						add(system, wrapperBonus, fmt.Sprintf("%s runs %q", name, strings.TrimSpace(hint)))
+						break
+					}
+				}
+			}
+		}
+	}
+
+	var ranked []detection
+	for system, d := range found {
+		// A wrapper hint alone is not enough to pick a build system.
+		if !hasFile[system] {
+			continue
+		}
+		ranked = append(ranked, *d)
+	}
+	sort.Slice(ranked, func(i, j int) bool {
+		if ranked[i].Score != ranked[j].Score {
+			return ranked[i].Score > ranked[j].Score
+		}
+		return ranked[i].BuildSystem < ranked[j].BuildSystem
+	})
+	return ranked
+}
+
+// resolveDetection picks the build system for repoPath. A non-empty override
+// wins over the ranking.
+func resolveDetection(repoPath, override string) detection {
+	ranked := detectBuildSystems(repoPath)
+	if override != "" {
+		for _, d := range ranked {
+			if d.BuildSystem == override {
+				d.Reasons = append(d.Reasons, "set with --build-system")
+				return d
+			}
+		}
+		return detection{
+			BuildSystem: override,
+			Language:    buildSystemLanguages[override],
+			Reasons:     []string{"set with --build-system"},
+		}
+	}
+	if len(ranked) == 0 {
+		return detection{Language: "Unknown"}
+	}
+	return ranked[0]
+}
+
+// containsCommand reports whether cmd appears in content at the start of a
+// word, so "go build" does not match inside "cargo build".
+func containsCommand(content, cmd string) bool {
+	for i := 0; ; {
+		j := strings.Index(content[i:], cmd)
+		if j < 0 {
+			return false
+		}
+		pos := i + j
+		if pos == 0 || strings.ContainsRune(" \t\n;&|()@$", rune(content[pos-1])) {
+			return true
+		}
+		i = pos + 1
+	}
+}
+
+func containsDetection(ranked []detection, system string) bool {
+	for _, d := range ranked {
+		if d.BuildSystem == system {
+			return true
+		}
+	}
+	return false
+}
+
+func knownBuildSystem(name string) bool {
+	_, ok := buildSystemLanguages[name]
+	return ok
+}
+
+func buildSystemNames() []string {
+	var names []string
+	for name := range buildSystemLanguages {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// showDetection prints the ranked build systems for an installed package or
+// a directory, marking the one ghpm would use.
+func showDetection(target string) error {
+	repoPath := target
+	override := ""
+	if info, err := os.Stat(target); err != nil || !info.IsDir() || !strings.ContainsRune(target, os.PathSeparator) {
+		repoPath = filepath.Join(packagesDir, target)
+		if m, err := loadManifest(target); err == nil {
+			override = m.BuildSystemOverride
+		}
+	}
+	if _, err := os.Stat(repoPath); err != nil {
+		return notFoundError("package not found: %s", target)
+	}
+
+	ranked := detectBuildSystems(repoPath)
+	chosen := resolveDetection(repoPath, override)
+	if len(ranked) == 0 && chosen.BuildSystem == "" {
+		fmt.Println("No build system detected in", repoPath)
+		return nil
+	}
+
+	fmt.Println("Build system detection for", repoPath+":")
+	if override != "" {
+		fmt.Println("Override:", override)
+		if !containsDetection(ranked, override) {
+			ranked = append([]detection{chosen}, ranked...)
+		}
+	}
+	for _, d := range ranked {
+		marker := " "
+		if d.BuildSystem == chosen.BuildSystem {
+			marker = "*"
+		}
+		fmt.Printf("%s %-10s %-8s score %-4d %s\n", marker, d.BuildSystem, d.Language, d.Score, strings.Join(d.Reasons, ", "))
+	}
+	if _, file := loadPackageRecipe(repoPath); file != "" {
+		fmt.Println("")
+		fmt.Println(file, "is present; the steps it declares take precedence over detection.")
+	}
+	fmt.Println("")
+	fmt.Println("Override with: ghpm install owner/repo --build-system <name>")
+	fmt.Println("Build systems:", strings.Join(buildSystemNames(), ", "))
+	return nil
+}
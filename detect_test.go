@@ -0,0 +1,89 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestDetectFrom(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		want  []string // build systems, best first
+		score int      // score of the best one
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:  "go module",
+			files: map[string]string{"go.mod": "", "README.md": ""},
+			want:  []string{"go"},
+			score: 100,
+		},
+		{
+			name:  "file names are matched case-insensitively",
+			files: map[string]string{"Cargo.toml": "", "Makefile": ""},
+			want:  []string{"cargo", "make"},
+			score: 100,
+		},
+		{
+			name:  "glob patterns",
+			files: map[string]string{"tool.gemspec": "", "scripts-install.sh": ""},
+			want:  []string{"ruby", "shell"},
+			score: 80,
+		},
+		{
+			name:  "signals for one system add up",
+			files: map[string]string{"setup.py": "", "requirements.txt": ""},
+			want:  []string{"pip"},
+			score: 125,
+		},
+		{
+			name:  "makefile wrapping go build adds a bonus to go",
+			files: map[string]string{"go.mod": "", "Makefile": "build:\n\tgo build ./...\n"},
+			want:  []string{"go", "make"},
+			score: 100 + wrapperBonus,
+		},
+		{
+			name:  "a wrapper hint alone does not select a build system",
+			files: map[string]string{"Makefile": "all:\n\tcargo build --release\n"},
+			want:  []string{"make"},
+			score: 30,
+		},
+		{
+			name:  "go build inside cargo build is not a hint",
+			files: map[string]string{"go.mod": "", "justfile": "release:\n  cargo build\n"},
+			want:  []string{"go", "just"},
+			score: 100,
+		},
+		{
+			name:  "equal scores are ordered by name",
+			files: map[string]string{"stack.yaml": "", "mix.exs": ""},
+			want:  []string{"mix", "stack"},
+			score: 95,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var names []string
+			for name := range tt.files {
+				names = append(names, name)
+			}
+			ranked := detectFrom(names, func(name string) []byte { return []byte(tt.files[name]) })
+			var got []string
+			for _, d := range ranked {
+				got = append(got, d.BuildSystem)
+				if d.Language != buildSystemLanguages[d.BuildSystem] {
+					t.Errorf("%s: language %q, want %q", d.BuildSystem, d.Language, buildSystemLanguages[d.BuildSystem])
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("got %v, want %v", got, tt.want)
+			}
+			if len(ranked) > 0 && ranked[0].Score != tt.score {
+				t.Errorf("score of %s = %d, want %d (reasons %v)", ranked[0].BuildSystem, ranked[0].Score, tt.score, ranked[0].Reasons)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// Exit codes. Scripts can rely on these.
+const (
+	exitOK       = 0
+	exitFailure  = 1 // anything not covered below
+	exitUsage    = 2 // bad command line
+	exitNotFound = 3 // package, repository or file does not exist
+	exitNetwork  = 4 // cloning, fetching or the GitHub API failed
+	exitBuild    = 5 // the build failed
+	exitVerify   = 6 // a check failed: toolchain preflight, dependency constraints, GPG
+)
+
+// cliError is an error with the exit code it should end ghpm with.
+type cliError struct {
+	code int
+	err  error
+}
+
+func (e *cliError) Error() string { return e.err.Error() }
+func (e *cliError) Unwrap() error { return e.err }
+
+func withCode(code int, format string, args ...any) error {
+	return &cliError{code: code, err: fmt.Errorf(format, args...)}
+}
+
+func usageError(format string, args ...any) error {
+	return withCode(exitUsage, format, args...)
+}
+
+func notFoundError(format string, args ...any) error {
+	return withCode(exitNotFound, format, args...)
+}
+
+func networkError(format string, args ...any) error {
+	return withCode(exitNetwork, format, args...)
+}
+
+func buildError(format string, args ...any) error {
+	return withCode(exitBuild, format, args...)
+}
+
+func verifyError(format string, args ...any) error {
+	return withCode(exitVerify, format, args...)
+}
+
+// exitCode returns the exit code for err; errors without one are general
+// failures.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	var ce *cliError
+	if errors.As(err, &ce) {
+		return ce.code
+	}
+	return exitFailure
+}
+
+// errOut is where errors go, and resultOut where --json and --format
+// results go. --quiet sends everything else to the null device, but these
+// are always shown.
+var (
+	errOut    = os.Stderr
+	resultOut = os.Stdout
+)
+
+// setQuiet discards normal output, including that of the commands ghpm
+// runs. Build output is still kept in the build logs.
+func setQuiet() {
+	devNull, err := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	if err != nil {
+		return
+	}
+	os.Stdout = devNull
+	os.Stderr = devNull
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		err  error
+		want int
+	}{
+		{nil, exitOK},
+		{fmt.Errorf("plain"), exitFailure},
+		{usageError("bad flag"), exitUsage},
+		{fmt.Errorf("installing: %w", networkError("clone failed")), exitNetwork},
+		{withCode(exitBuild, "%d of %d failed", 1, 2), exitBuild},
+	}
+	for _, tt := range tests {
+		if got := exitCode(tt.err); got != tt.want {
+			t.Errorf("exitCode(%v) = %d, want %d", tt.err, got, tt.want)
+		}
+	}
+}
+
+func runArgs(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+	old := os.Args
+	os.Args = append([]string{"ghpm"}, args...)
+	defer func() { os.Args = old }()
+	var err error
+	out := captureStdout(t, func() { err = run() })
+	return out, err
+}
+
+func TestRunExitCodes(t *testing.T) {
+	testHome(t)
+	saveManifest(Manifest{Name: "tool", Repo: "own/tool"})
+	tests := []struct {
+		args []string
+		want int
+	}{
+		{nil, exitUsage},
+		{[]string{"nosuch"}, exitUsage},
+		{[]string{"--bogus", "list"}, exitUsage},
+		{[]string{"list", "--bogus"}, exitUsage},
+		{[]string{"info"}, exitUsage},
+		{[]string{"list", "--json", "--format", "{{.Name}}"}, exitUsage},
+		{[]string{"info", "missing"}, exitNotFound},
+		{[]string{"remove", "missing"}, exitNotFound},
+		{[]string{"logs", "tool"}, exitNotFound},
+		{[]string{"--version"}, exitOK},
+		{[]string{"help", "install"}, exitOK},
+		{[]string{"list", "--help"}, exitOK},
+		{[]string{"list"}, exitOK},
+	}
+	for _, tt := range tests {
+		if _, err := runArgs(t, tt.args...); exitCode(err) != tt.want {
+			t.Errorf("ghpm %v: %v, want exit code %d", tt.args, err, tt.want)
+		}
+	}
+}
+
+func TestQuietKeepsResults(t *testing.T) {
+	testHome(t)
+	saveManifest(Manifest{Name: "tool", Repo: "own/tool"})
+	stdout, stderr := os.Stdout, os.Stderr
+	defer func() { os.Stdout, os.Stderr = stdout, stderr }()
+
+	out, err := runArgs(t, "list", "--quiet")
+	if err != nil || out != "" {
+		t.Errorf("list --quiet printed %q, %v", out, err)
+	}
+	out, err = runArgs(t, "--quiet", "list", "--json")
+	var records []packageRecord
+	if err != nil || json.Unmarshal([]byte(out), &records) != nil || len(records) != 1 {
+		t.Errorf("list --json --quiet printed %q, %v", out, err)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+const (
+	githubAPI = "https://api.github.com"
+	githubRaw = "https://raw.githubusercontent.com"
+)
+
+var httpClient = &http.Client{Timeout: 15 * time.Second}
+
+// githubRequest sends a GET to url with the headers GitHub expects. A
+// GITHUB_TOKEN in the environment is used to raise the rate limit.
+func githubRequest(url string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	req.Header.Set("User-Agent", "ghpm-cli")
+	if token := os.Getenv("GITHUB_TOKEN"); token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		return nil, fmt.Errorf("GitHub API returned status: %s", resp.Status)
+	}
+	return resp, nil
+}
+
+// githubGet decodes the JSON response of an API path such as
+// "/repos/owner/repo" into v.
+func githubGet(path string, v any) error {
+	resp, err := githubRequest(githubAPI + path)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// githubFile fetches a file from the default branch of repo.
+func githubFile(repo, path string) ([]byte, error) {
+	resp, err := githubRequest(githubRaw + "/" + repo + "/HEAD/" + path)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Before cloning, the repository's metadata is checked for signs that it
+// may not be a good thing to install: archived, a fork, abandoned, without
+// a license or barely used. They are warnings unless the config refuses
+// archived or unlicensed repositories; --force installs anyway.
+
+const (
+	staleAfter = 365 * 24 * time.Hour
+	fewStars   = 10
+)
+
+// repoHealth is the repository metadata the checks use, kept in the
+// manifest as of the last install or update.
+type repoHealth struct {
+	Stars     int       `json:"stars"`
+	Archived  bool      `json:"archived,omitempty"`
+	Fork      bool      `json:"fork,omitempty"`
+	Parent    string    `json:"parent,omitempty"`
+	License   string    `json:"license,omitempty"`
+	PushedAt  time.Time `json:"pushed_at"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+func fetchRepoHealth(repo string) (*repoHealth, error) {
+	var meta struct {
+		ghRepoItem
+		Fork   bool `json:"fork"`
+		Parent *struct {
+			FullName string `json:"full_name"`
+		} `json:"parent"`
+	}
+	if err := githubGet("/repos/"+repo, &meta); err != nil {
+		return nil, err
+	}
+	h := &repoHealth{
+		Stars:     meta.StargazersCount,
+		Archived:  meta.Archived,
+		Fork:      meta.Fork,
+		PushedAt:  meta.PushedAt,
+		CheckedAt: time.Now(),
+	}
+	if meta.Parent != nil {
+		h.Parent = meta.Parent.FullName
+	}
+	if meta.License != nil {
+		h.License = meta.License.SPDXID
+	}
+	return h, nil
+}
+
+// unlicensed reports whether GitHub found no license at all. NOASSERTION
+// means a license file it could not identify, which is not the same.
+func (h *repoHealth) unlicensed() bool {
+	return h.License == ""
+}
+
+// warnings describes the risk signals of the repository, if any.
+func (h *repoHealth) warnings() []string {
+	if h == nil {
+		return nil
+	}
+	var w []string
+	if h.Archived {
+		w = append(w, "archived: the owner no longer maintains it")
+	}
+	if h.Fork {
+		if h.Parent != "" {
+			w = append(w, "a fork of "+h.Parent)
+		} else {
+			w = append(w, "a fork")
+		}
+	}
+	if !h.PushedAt.IsZero() && h.CheckedAt.Sub(h.PushedAt) > staleAfter {
+		w = append(w, "no commits since "+h.PushedAt.Format("2006-01-02"))
+	}
+	if h.unlicensed() {
+		w = append(w, "no license")
+	}
+	if h.Stars < fewStars {
+		w = append(w, fmt.Sprintf("only %d stars", h.Stars))
+	}
+	return w
+}
+
+// checkHealth fetches and reports the risk signals of repo before it is
+// installed. It returns an error when the config refuses the repository
+// and --force was not given.
+func checkHealth(repo string, opts installOptions) (*repoHealth, error) {
+	if offline {
+		return vetHealth(repo, nil, errors.New("offline"), opts)
+	}
+	h, err := fetchRepoHealth(repo)
+	return vetHealth(repo, h, err, opts)
+}
+
+// vetHealth reports h and applies the refuse_* settings to it. When h is
+// nil because it could not be fetched (err), the check is skipped, unless
+// a refuse_* setting is on: a policy that cannot be checked refuses the
+// repository rather than letting it through.
+func vetHealth(repo string, h *repoHealth, err error, opts installOptions) (*repoHealth, error) {
+	cfg := loadConfig()
+	if h == nil {
+		var policies []string
+		if cfg.RefuseArchived {
+			policies = append(policies, "refuse_archived")
+		}
+		if cfg.RefuseUnlicensed {
+			policies = append(policies, "refuse_unlicensed")
+		}
+		if len(policies) > 0 && !opts.Force {
+			return nil, verifyError("refusing to install %s: cannot check it for %s: %v; pass --force to install anyway", repo, strings.Join(policies, ", "), err)
+		}
+		fmt.Println("Health check skipped:", err)
+		if len(policies) > 0 {
+			fmt.Println("Installing anyway (--force)")
+		}
+		return nil, nil
+	}
+
+	warnings := h.warnings()
+	for _, w := range warnings {
+		fmt.Printf("⚠ %s: %s\n", repo, w)
+	}
+
+	var refused []string
+	if cfg.RefuseArchived && h.Archived {
+		refused = append(refused, "archived (refuse_archived)")
+	}
+	if cfg.RefuseUnlicensed && h.unlicensed() {
+		refused = append(refused, "unlicensed (refuse_unlicensed)")
+	}
+	if len(refused) == 0 {
+		return h, nil
+	}
+	if opts.Force {
+		fmt.Println("Installing anyway (--force)")
+		return h, nil
+	}
+	return nil, verifyError("refusing to install %s: %s; pass --force to install anyway", repo, strings.Join(refused, ", "))
+}
+
+func printHealth(h *repoHealth) {
+	if h == nil {
+		return
+	}
+	fmt.Println("Stars:", h.Stars)
+	if !h.PushedAt.IsZero() {
+		fmt.Println("Last Push:", h.PushedAt.Format("2006-01-02"))
+	}
+	for _, w := range h.warnings() {
+		fmt.Println("Warning:", w)
+	}
+	fmt.Println("Checked:", h.CheckedAt.Format("2006-01-02"))
+}
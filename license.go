@@ -0,0 +1,374 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+// Each package records the SPDX identifier of its license: the one GitHub
+// detected, or else the one recognised in the LICENSE or COPYING files of
+// the clone. Several different licenses found in files are joined with
+// AND, since all of them may apply, except those in files named after
+// their license, like LICENSE-MIT and LICENSE-APACHE: those are the usual
+// way to offer a choice, and are joined with OR. NOASSERTION means a
+// license file that could not be identified; "" means none was found.
+//
+// The license_allow and license_deny config lists are matched against each
+// identifier in the expression. An entry matches the identifier itself and
+// its variants, so "AGPL" matches "AGPL-3.0-only" and "GPL-3.0" matches
+// "GPL-3.0-or-later", but "GPL" does not match "LGPL-2.1". Of the
+// alternatives in an OR expression, one acceptable license is enough.
+
+const noAssertion = "NOASSERTION"
+
+var licenseFileName = regexp.MustCompile(`(?i)^(licen[cs]e|copying|unlicense)([-._].*)?$`)
+
+// licenseTexts identifies license texts by phrases in their header. More
+// specific licenses come first.
+var licenseTexts = []struct {
+	id      string
+	phrases []string
+}{
+	{"AGPL-3.0", []string{"gnu affero general public license", "version 3"}},
+	{"LGPL-3.0", []string{"gnu lesser general public license", "version 3"}},
+	{"LGPL-2.1", []string{"gnu lesser general public license", "version 2.1"}},
+	{"GPL-3.0", []string{"gnu general public license", "version 3"}},
+	{"GPL-2.0", []string{"gnu general public license", "version 2"}},
+	{"MPL-2.0", []string{"mozilla public license", "2.0"}},
+	{"Apache-2.0", []string{"apache license", "version 2.0"}},
+	{"BSL-1.0", []string{"boost software license"}},
+	{"Unlicense", []string{"free and unencumbered software released into the public domain"}},
+	{"CC0-1.0", []string{"cc0 1.0 universal"}},
+	{"WTFPL", []string{"do what the fuck you want to"}},
+	{"ISC", []string{"permission to use, copy, modify, and/or distribute this software for any purpose"}},
+	{"Zlib", []string{"altered source versions must be plainly marked"}},
+	{"BSD-3-Clause", []string{"redistribution and use in source and binary forms", "neither the name"}},
+	{"BSD-2-Clause", []string{"redistribution and use in source and binary forms"}},
+	{"MIT", []string{"permission is hereby granted, free of charge"}},
+}
+
+// licenseHeaderLines is how many non-blank lines of a license file are
+// matched: the title, or for untitled licenses such as MIT the opening
+// clauses. Full texts name other licenses further down (GPL-3.0 mentions
+// the AGPL, MPL-2.0 lists it as a secondary license), so the rest is not.
+const licenseHeaderLines = 20
+
+// identifyLicense returns the SPDX identifier of a license text, or
+// NOASSERTION.
+func identifyLicense(text string) string {
+	var header []string
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		header = append(header, line)
+		if len(header) == licenseHeaderLines {
+			break
+		}
+	}
+	text = strings.ToLower(strings.Join(strings.Fields(strings.Join(header, " ")), " "))
+	for _, l := range licenseTexts {
+		found := true
+		for _, p := range l.phrases {
+			if !strings.Contains(text, p) {
+				found = false
+				break
+			}
+		}
+		if found {
+			return l.id
+		}
+	}
+	return noAssertion
+}
+
+// scanLicense looks for license files at the top of the clone and returns
+// the license they hold and the files it came from.
+func scanLicense(repoPath string) (string, []string) {
+	entries, err := os.ReadDir(repoPath)
+	if err != nil {
+		return "", nil
+	}
+	var ids, named, plain, files []string
+	for _, e := range entries {
+		match := licenseFileName.FindStringSubmatch(e.Name())
+		if e.IsDir() || match == nil {
+			continue
+		}
+		data, err := os.ReadFile(filepath.Join(repoPath, e.Name()))
+		if err != nil {
+			continue
+		}
+		files = append(files, e.Name())
+		id := identifyLicense(string(data))
+		if !contains(ids, id) {
+			ids = append(ids, id)
+		}
+		if strings.HasPrefix(match[2], "-") {
+			named = append(named, id)
+		} else {
+			plain = append(plain, id)
+		}
+	}
+	if len(ids) > 1 {
+		// An identified license makes an unidentified file less likely to
+		// be a license of its own (it is usually a notice).
+		var known []string
+		for _, id := range ids {
+			if id != noAssertion {
+				known = append(known, id)
+			}
+		}
+		ids = known
+	}
+
+	// A license in a file named after it, like LICENSE-MIT, is one choice
+	// among those files, unless a plain LICENSE file holds it too.
+	var required, alternatives []string
+	for _, id := range ids {
+		if contains(named, id) && !contains(plain, id) && id != noAssertion {
+			alternatives = append(alternatives, id)
+		} else {
+			required = append(required, id)
+		}
+	}
+	if len(alternatives) == 1 {
+		required, alternatives = append(required, alternatives...), nil
+	}
+	sort.Strings(required)
+	sort.Strings(alternatives)
+	expr := strings.Join(alternatives, " OR ")
+	if len(required) == 0 {
+		return expr, files
+	}
+	if len(alternatives) > 0 {
+		required = append(required, "("+expr+")")
+	}
+	return strings.Join(required, " AND "), files
+}
+
+// detectLicense returns the license of the package cloned at repoPath,
+// preferring the one GitHub detected.
+func detectLicense(repoPath string, health *repoHealth) (string, []string) {
+	license, files := scanLicense(repoPath)
+	if health != nil && health.License != "" && health.License != noAssertion {
+		return health.License, files
+	}
+	return license, files
+}
+
+// licenseIDs splits a license expression into its identifiers.
+func licenseIDs(license string) []string {
+	var ids []string
+	for _, f := range strings.Fields(strings.NewReplacer("(", " ", ")", " ").Replace(license)) {
+		switch strings.ToUpper(f) {
+		case "AND", "OR", "WITH":
+			continue
+		}
+		ids = append(ids, f)
+	}
+	return ids
+}
+
+func licenseMatches(entry, id string) bool {
+	entry, id = strings.ToLower(entry), strings.ToLower(id)
+	return id == entry || strings.HasPrefix(id, entry+"-") || strings.HasPrefix(id, entry+".")
+}
+
+// licenseViolation explains why the policy in cfg rejects license, or
+// returns "" when it is acceptable.
+func licenseViolation(license string, cfg Config) string {
+	if len(licenseIDs(license)) == 0 {
+		if len(cfg.LicenseAllow) > 0 {
+			return "no license found and license_allow is set"
+		}
+		return ""
+	}
+	e := &licenseExpr{
+		tokens: strings.Fields(strings.NewReplacer("(", " ( ", ")", " ) ").Replace(license)),
+		check: func(id string) string {
+			for _, entry := range cfg.LicenseDeny {
+				if licenseMatches(entry, id) {
+					return fmt.Sprintf("license %s is denied (license_deny %s)", id, entry)
+				}
+			}
+			if len(cfg.LicenseAllow) == 0 {
+				return ""
+			}
+			for _, entry := range cfg.LicenseAllow {
+				if licenseMatches(entry, id) {
+					return ""
+				}
+			}
+			return fmt.Sprintf("license %s is not in license_allow", id)
+		},
+	}
+	violation := e.or()
+	// Whatever a malformed expression has left over must be acceptable too.
+	for len(e.tokens) > 0 {
+		if !e.accept(")") {
+			if v := e.or(); violation == "" {
+				violation = v
+			}
+		}
+	}
+	return violation
+}
+
+// licenseExpr evaluates an SPDX license expression, split into tokens, to
+// the first violation check finds in it, or "" when it is acceptable. AND
+// binds tighter than OR.
+type licenseExpr struct {
+	tokens []string
+	check  func(id string) string
+}
+
+func (e *licenseExpr) accept(token string) bool {
+	if len(e.tokens) > 0 && strings.EqualFold(e.tokens[0], token) {
+		e.tokens = e.tokens[1:]
+		return true
+	}
+	return false
+}
+
+func (e *licenseExpr) or() string {
+	violation := e.and()
+	acceptable := violation == ""
+	for e.accept("OR") {
+		if e.and() == "" {
+			acceptable = true
+		}
+	}
+	if acceptable {
+		return ""
+	}
+	return violation
+}
+
+func (e *licenseExpr) and() string {
+	violation := e.license()
+	for e.accept("AND") {
+		if v := e.license(); violation == "" {
+			violation = v
+		}
+	}
+	return violation
+}
+
+// license evaluates a parenthesized expression or a single identifier,
+// with its exception if any.
+func (e *licenseExpr) license() string {
+	if e.accept("(") {
+		violation := e.or()
+		e.accept(")")
+		return violation
+	}
+	if len(e.tokens) == 0 {
+		return ""
+	}
+	id := e.tokens[0]
+	e.tokens = e.tokens[1:]
+	if e.accept("WITH") && len(e.tokens) > 0 {
+		e.tokens = e.tokens[1:]
+	}
+	return e.check(id)
+}
+
+// checkLicensePolicy refuses a license the config does not accept, unless
+// --force was given.
+func checkLicensePolicy(repo, license string, opts installOptions) error {
+	violation := licenseViolation(license, loadConfig())
+	if violation == "" {
+		return nil
+	}
+	if opts.Force {
+		fmt.Printf("⚠ %s: %s; installing anyway (--force)\n", repo, violation)
+		return nil
+	}
+	return verifyError("refusing to install %s: %s; pass --force to install anyway", repo, violation)
+}
+
+// packageLicense returns the recorded license of m, detecting it for
+// packages installed before licenses were recorded.
+func packageLicense(m Manifest) (string, []string) {
+	if m.License != "" || len(m.LicenseFiles) > 0 {
+		return m.License, m.LicenseFiles
+	}
+	return detectLicense(filepath.Join(packagesDir, m.Name), m.Health)
+}
+
+func displayLicense(license string) string {
+	if license == "" {
+		return "none"
+	}
+	return license
+}
+
+// licensesCommand implements "ghpm licenses": installed packages grouped
+// by license. With check it fails when a package breaks the policy.
+func licensesCommand(out outputMode, check bool) error {
+	cfg := loadConfig()
+	records := []licenseRecord{}
+	var violations []string
+	for _, m := range loadAllManifests() {
+		license, files := packageLicense(m)
+		r := licenseRecord{
+			Name:      m.Name,
+			Repo:      m.Repo,
+			Version:   m.Version,
+			License:   license,
+			Files:     nonNil(files),
+			Violation: licenseViolation(license, cfg),
+		}
+		if r.Violation != "" {
+			violations = append(violations, m.Name)
+		}
+		records = append(records, r)
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return displayLicense(records[i].License) < displayLicense(records[j].License)
+	})
+
+	var err error
+	if check && len(violations) > 0 {
+		err = verifyError("license policy violated by %s", strings.Join(violations, ", "))
+	}
+	if out.machine() {
+		if werr := out.write(records); werr != nil {
+			return werr
+		}
+		return err
+	}
+
+	if len(records) == 0 {
+		fmt.Println("No packages installed.")
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	for i, r := range records {
+		if i == 0 || displayLicense(r.License) != displayLicense(records[i-1].License) {
+			if i > 0 {
+				fmt.Fprintln(tw)
+			}
+			count := 0
+			for _, o := range records {
+				if displayLicense(o.License) == displayLicense(r.License) {
+					count++
+				}
+			}
+			fmt.Fprintf(tw, "%s (%d)\n", displayLicense(r.License), count)
+		}
+		note := strings.Join(r.Files, ", ")
+		if r.Violation != "" {
+			note = "POLICY: " + r.Violation
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\t%s\n", r.Name, r.Repo, r.Version, note)
+	}
+	tw.Flush()
+	return err
+}
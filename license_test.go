@@ -0,0 +1,154 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// testdata/licenses holds real license texts, each named after its SPDX
+// identifier.
+func TestIdentifyLicenseTexts(t *testing.T) {
+	entries, err := os.ReadDir(filepath.Join("testdata", "licenses"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		data, err := os.ReadFile(filepath.Join("testdata", "licenses", e.Name()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := identifyLicense(string(data)); got != e.Name() {
+			t.Errorf("%s identified as %s", e.Name(), got)
+		}
+	}
+}
+
+func TestIdentifyLicenseHeaders(t *testing.T) {
+	tests := []struct {
+		name, text, want string
+	}{
+		{
+			name: "AGPL-3.0 text",
+			text: `                    GNU AFFERO GENERAL PUBLIC LICENSE
+                       Version 3, 19 November 2007
+
+ Copyright (C) 2007 Free Software Foundation, Inc. <https://fsf.org/>
+ Everyone is permitted to copy and distribute verbatim copies
+ of this license document, but changing it is not allowed.
+
+                            Preamble
+
+  The GNU Affero General Public License is a free, copyleft license for
+software and other kinds of works, specifically designed to ensure
+cooperation with the community in the case of network server software.
+`,
+			want: "AGPL-3.0",
+		},
+		{
+			name: "GPL-3.0 notice",
+			text: `Copyright (C) 2024 Someone
+
+This program is free software: you can redistribute it and/or modify
+it under the terms of the GNU General Public License as published by
+the Free Software Foundation, either version 3 of the License, or
+(at your option) any later version.
+`,
+			want: "GPL-3.0",
+		},
+		{
+			name: "WTFPL",
+			text: "DO WHAT THE FUCK YOU WANT TO PUBLIC LICENSE\nVersion 2, December 2004\n",
+			want: "WTFPL",
+		},
+		{
+			name: "unknown text",
+			text: "All rights reserved. Contact the author for licensing.\n",
+			want: noAssertion,
+		},
+		{
+			name: "empty",
+			want: noAssertion,
+		},
+	}
+	for _, tt := range tests {
+		if got := identifyLicense(tt.text); got != tt.want {
+			t.Errorf("%s identified as %s, want %s", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestScanLicense(t *testing.T) {
+	mit, err := os.ReadFile(filepath.Join("testdata", "licenses", "MIT"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	apache, err := os.ReadFile(filepath.Join("testdata", "licenses", "Apache-2.0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	notice := []byte("See the LICENSE-* files.\n")
+	tests := []struct {
+		name  string
+		files map[string][]byte
+		want  string
+	}{
+		{"choice", map[string][]byte{"LICENSE-MIT": mit, "LICENSE-APACHE": apache, "COPYING": notice}, "Apache-2.0 OR MIT"},
+		{"both apply", map[string][]byte{"LICENSE": mit, "COPYING": apache}, "Apache-2.0 AND MIT"},
+		{"one named file", map[string][]byte{"LICENSE-MIT": mit, "LICENSE.md": notice}, "MIT"},
+		{"choice and a plain license", map[string][]byte{"LICENSE-MIT": mit, "LICENSE-APACHE": apache, "LICENSE.BSD": []byte(
+			"Redistribution and use in source and binary forms, with or without modification, are permitted. Neither the name of the copyright holder...\n")},
+			"BSD-3-Clause AND (Apache-2.0 OR MIT)"},
+		{"named and plain", map[string][]byte{"LICENSE": mit, "LICENSE-MIT": mit, "LICENSE-APACHE": apache}, "Apache-2.0 AND MIT"},
+		{"notice only", map[string][]byte{"COPYING": notice}, noAssertion},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		tt.files["README.md"] = []byte("Licensed under MIT or Apache-2.0.\n")
+		for name, data := range tt.files {
+			if err := os.WriteFile(filepath.Join(dir, name), data, 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		license, found := scanLicense(dir)
+		if license != tt.want {
+			t.Errorf("%s: license = %q, want %q", tt.name, license, tt.want)
+		}
+		if len(found) != len(tt.files)-1 {
+			t.Errorf("%s: license files = %v", tt.name, found)
+		}
+	}
+}
+
+func TestLicenseViolation(t *testing.T) {
+	permissive := Config{LicenseAllow: []string{"MIT", "Apache-2.0", "BSD"}}
+	noGPL := Config{LicenseDeny: []string{"GPL"}}
+	tests := []struct {
+		license string
+		cfg     Config
+		want    string
+	}{
+		{"MIT", permissive, ""},
+		{"GPL-3.0", permissive, "license GPL-3.0 is not in license_allow"},
+		{"", permissive, "no license found and license_allow is set"},
+		{"", noGPL, ""},
+		{"Apache-2.0 OR MIT", permissive, ""},
+		{"GPL-3.0 OR MIT", permissive, ""},
+		{"MIT OR GPL-3.0", noGPL, ""},
+		{"GPL-2.0 OR GPL-3.0", noGPL, "license GPL-2.0 is denied (license_deny GPL)"},
+		{"MIT AND GPL-3.0", permissive, "license GPL-3.0 is not in license_allow"},
+		{"MIT AND GPL-3.0", noGPL, "license GPL-3.0 is denied (license_deny GPL)"},
+		{"BSD-3-Clause AND (Apache-2.0 OR MIT)", permissive, ""},
+		{"GPL-3.0 AND (Apache-2.0 OR MIT)", permissive, "license GPL-3.0 is not in license_allow"},
+		{"(GPL-3.0 AND MIT) OR Apache-2.0", noGPL, ""},
+		{"GPL-3.0 AND MIT OR Apache-2.0", noGPL, ""},
+		{"GPL-2.0 WITH Classpath-exception-2.0", noGPL, "license GPL-2.0 is denied (license_deny GPL)"},
+		{"MIT or Apache-2.0", Config{LicenseAllow: []string{"Apache-2.0"}}, ""},
+		{"MIT) GPL-3.0", noGPL, "license GPL-3.0 is denied (license_deny GPL)"},
+	}
+	for _, tt := range tests {
+		if got := licenseViolation(tt.license, tt.cfg); got != tt.want {
+			t.Errorf("licenseViolation(%q, %v) = %q, want %q", tt.license, tt.cfg.LicenseAllow, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// A local package is installed from a directory instead of GitHub, for
+// tools developed alongside it or to try the build pipeline without a
+// network. Its repo is local/<name>, after the directory's name, and the
+// package directory is either a copy of the tree or, with --link, a
+// symlink to it. "ghpm update" copies the tree again, or for a linked
+// package just rebuilds it; there is no upstream to check or roll back to.
+
+// isLocalPath reports whether an install target is a directory rather than
+// a GitHub repository: an absolute path or one starting with . or ..
+func isLocalPath(target string) bool {
+	if target == "." || target == ".." || filepath.IsAbs(target) {
+		return true
+	}
+	for _, prefix := range []string{"./", "../", "." + string(filepath.Separator), ".." + string(filepath.Separator)} {
+		if strings.HasPrefix(target, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// installLocal installs the directory dir as a package, copying it or,
+// with link, linking it in place.
+func installLocal(dir string, link bool, opts installOptions) error {
+	src, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(src)
+	if err != nil {
+		return notFoundError("cannot install %s: %v", dir, err)
+	}
+	if !info.IsDir() {
+		return usageError("cannot install %s: not a directory", dir)
+	}
+	opts.Source = src
+	opts.Link = link
+	return installRepo("local/"+filepath.Base(src), opts)
+}
+
+// placeLocal puts the source directory at dest, as a symlink or a copy.
+func placeLocal(src, dest string, link bool) error {
+	if link {
+		fmt.Println("Linking", dest, "to", src)
+		return os.Symlink(src, dest)
+	}
+	fmt.Println("Copying", src, "to", dest)
+	return copyTree(src, dest)
+}
+
+// refreshLocal brings a local package up to date with its directory before
+// it is rebuilt. A copy is replaced only once the new one is complete.
+func refreshLocal(m Manifest, pkgPath string) error {
+	if _, err := os.Stat(m.Source); err != nil {
+		return notFoundError("the directory %s was installed from is gone: %v", m.Name, err)
+	}
+	if m.Linked {
+		return nil
+	}
+	fmt.Println("Copying", m.Source, "to", pkgPath)
+	tmp := pkgPath + ".new"
+	os.RemoveAll(tmp)
+	if err := copyTree(m.Source, tmp); err != nil {
+		os.RemoveAll(tmp)
+		return fmt.Errorf("failed to copy %s: %v", m.Source, err)
+	}
+	if err := os.RemoveAll(pkgPath); err != nil {
+		os.RemoveAll(tmp)
+		return err
+	}
+	return os.Rename(tmp, pkgPath)
+}
+
+// copyTree copies the directory src to dest, keeping file modes and
+// symlinks.
+func copyTree(src, dest string) error {
+	return filepath.WalkDir(src, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(src, path)
+		target := filepath.Join(dest, rel)
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case d.IsDir():
+			// Owner write access lets the files inside be created.
+			return os.MkdirAll(target, info.Mode().Perm()|0700)
+		case info.Mode()&os.ModeSymlink != 0:
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, target)
+		case info.Mode().IsRegular():
+			return copyFile(path, target, info.Mode().Perm())
+		}
+		// Sockets, pipes and devices are left out.
+		return nil
+	})
+}
+
+func copyFile(src, dest string, perm os.FileMode) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	return extractFile(dest, in, perm)
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestIsLocalPath(t *testing.T) {
+	tests := []struct {
+		target string
+		want   bool
+	}{
+		{".", true},
+		{"..", true},
+		{"./tool", true},
+		{"../src/tool", true},
+		{"/home/me/tool", true},
+		{"own/tool", false},
+		{"tool", false},
+		{".tool/x", false},
+	}
+	for _, tt := range tests {
+		if got := isLocalPath(tt.target); got != tt.want {
+			t.Errorf("isLocalPath(%q) = %v", tt.target, got)
+		}
+	}
+}
+
+// testSource makes a directory with an executable, a read-only directory
+// and a symlink.
+func testSource(t *testing.T) string {
+	t.Helper()
+	src := filepath.Join(t.TempDir(), "tool")
+	os.MkdirAll(filepath.Join(src, "docs"), 0755)
+	os.WriteFile(filepath.Join(src, "run.sh"), []byte("#!/bin/sh\n"), 0755)
+	os.WriteFile(filepath.Join(src, "docs", "README"), []byte("docs\n"), 0644)
+	os.Chmod(filepath.Join(src, "docs"), 0555)
+	t.Cleanup(func() { os.Chmod(filepath.Join(src, "docs"), 0755) })
+	os.Symlink("run.sh", filepath.Join(src, "tool"))
+	return src
+}
+
+func TestCopyTree(t *testing.T) {
+	src := testSource(t)
+	dest := filepath.Join(t.TempDir(), "copy")
+	if err := copyTree(src, dest); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := os.Stat(filepath.Join(dest, "run.sh")); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("run.sh: %v %v", info, err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dest, "docs", "README")); string(data) != "docs\n" {
+		t.Errorf("docs/README holds %q", data)
+	}
+	if link, err := os.Readlink(filepath.Join(dest, "tool")); err != nil || link != "run.sh" {
+		t.Errorf("symlink to %q, %v", link, err)
+	}
+}
+
+func TestInstallLocal(t *testing.T) {
+	testHome(t)
+	src := testSource(t)
+	if err := installLocal(src, false, installOptions{NoBuild: true}); err != nil {
+		t.Fatal(err)
+	}
+	pkgPath := filepath.Join(packagesDir, "tool")
+	m, err := loadManifest("tool")
+	if err != nil || m.Repo != "local/tool" || m.Source != src || m.Linked {
+		t.Fatalf("manifest %+v, %v", m, err)
+	}
+	if info, err := os.Lstat(pkgPath); err != nil || !info.IsDir() {
+		t.Fatalf("package directory: %v %v", info, err)
+	}
+
+	// update copies the tree again.
+	os.WriteFile(filepath.Join(src, "run.sh"), []byte("#!/bin/sh\necho new\n"), 0755)
+	os.Remove(filepath.Join(src, "tool"))
+	if err := refreshLocal(m, pkgPath); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(filepath.Join(pkgPath, "run.sh")); string(data) != "#!/bin/sh\necho new\n" {
+		t.Errorf("run.sh holds %q after a refresh", data)
+	}
+	if _, err := os.Lstat(filepath.Join(pkgPath, "tool")); !os.IsNotExist(err) {
+		t.Error("a file removed from the directory is still in the package")
+	}
+	if _, err := os.Stat(pkgPath + ".new"); !os.IsNotExist(err) {
+		t.Error("left the new copy behind")
+	}
+
+	m.Source = filepath.Join(t.TempDir(), "gone")
+	if err := refreshLocal(m, pkgPath); exitCode(err) != exitNotFound {
+		t.Errorf("refresh from a missing directory: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(pkgPath, "run.sh")); err != nil {
+		t.Error("a failed refresh removed the package")
+	}
+}
+
+func TestInstallLocalLinked(t *testing.T) {
+	testHome(t)
+	src := testSource(t)
+	if err := installLocal(src, true, installOptions{NoBuild: true}); err != nil {
+		t.Fatal(err)
+	}
+	pkgPath := filepath.Join(packagesDir, "tool")
+	if target, err := os.Readlink(pkgPath); err != nil || target != src {
+		t.Errorf("package links to %q, %v", target, err)
+	}
+	m, _ := loadManifest("tool")
+	if !m.Linked {
+		t.Error("the manifest does not record the link")
+	}
+	if err := refreshLocal(m, pkgPath); err != nil {
+		t.Error(err)
+	}
+	if target, _ := os.Readlink(pkgPath); target != src {
+		t.Error("refreshing a linked package replaced the link")
+	}
+
+	if err := removeRepo("tool", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(src, "run.sh")); err != nil {
+		t.Error("removing a linked package removed its directory")
+	}
+
+	for _, dir := range []string{filepath.Join(src, "run.sh"), filepath.Join(src, "missing")} {
+		if err := installLocal(dir, false, installOptions{}); exitCode(err) == exitOK {
+			t.Errorf("installed %s", dir)
+		}
+	}
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Work on a package (install, update, edit, remove) happens under a lock
+// on ~/.ghpm/locks/<name>.lock, so two ghpm processes cannot touch the same
+// package at once while work on different packages still runs in parallel.
+// The holder writes its PID into the file and empties it on release; a PID
+// still there when the lock is next taken means the holder died mid-way.
+
+type packageLock struct {
+	f    *os.File
+	name string
+}
+
+func locksDir() string {
+	return filepath.Join(baseDir, "locks")
+}
+
+// lockPackage takes the lock for name, waiting while another process holds
+// it. stale reports that the previous holder exited without releasing it.
+func lockPackage(name string) (lock *packageLock, stale bool, err error) {
+	if err := os.MkdirAll(locksDir(), 0755); err != nil {
+		return nil, false, err
+	}
+	path := filepath.Join(locksDir(), name+".lock")
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, false, err
+	}
+
+	ok, err := tryLockFile(f)
+	if err != nil {
+		f.Close()
+		return nil, false, err
+	}
+	if !ok {
+		holder := "another ghpm process"
+		if pid := lockHolder(f); pid > 0 {
+			holder = fmt.Sprintf("ghpm (pid %d)", pid)
+		}
+		fmt.Println("Waiting for", holder, "to finish with", name, "...")
+		if err := lockFile(f); err != nil {
+			f.Close()
+			return nil, false, err
+		}
+	}
+
+	// The lock is ours now, so any PID left in the file belongs to a
+	// process that died while holding it.
+	if pid := lockHolder(f); pid > 0 && pid != os.Getpid() {
+		stale = true
+		fmt.Printf("Found a stale lock on %s left by ghpm (pid %d), which did not finish\n", name, pid)
+	}
+
+	f.Truncate(0)
+	f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	f.Sync()
+	return &packageLock{f: f, name: name}, stale, nil
+}
+
+// lockHolder reads the PID recorded in a lock file, or 0.
+func lockHolder(f *os.File) int {
+	buf := make([]byte, 32)
+	n, _ := f.ReadAt(buf, 0)
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(buf[:n])))
+	return pid
+}
+
+func (l *packageLock) unlock() {
+	if l == nil {
+		return
+	}
+	l.f.Truncate(0)
+	unlockFile(l.f)
+	l.f.Close()
+}
+
+// lockPackageCleanly takes the lock for name and, if a previous holder died
+// half way through an install, clears the partial clone it left.
+func lockPackageCleanly(name string) (*packageLock, error) {
+	lock, stale, err := lockPackage(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock %s: %v", name, err)
+	}
+	if stale {
+		pkgPath := filepath.Join(packagesDir, name)
+		if _, err := os.Stat(pkgPath); err == nil {
+			if _, err := loadManifest(name); err != nil {
+				fmt.Println("Removing the incomplete install at", pkgPath)
+				os.RemoveAll(pkgPath)
+			}
+		}
+	}
+	return lock, nil
+}
+
+// writeFileAtomic replaces path with data through a temporary file and a
+// rename, so readers never see a partly written file.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,59 @@
+//go:build windows
+
+package main
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+var (
+	kernel32         = syscall.NewLazyDLL("kernel32.dll")
+	procLockFileEx   = kernel32.NewProc("LockFileEx")
+	procUnlockFileEx = kernel32.NewProc("UnlockFileEx")
+)
+
+const (
+	lockfileFailImmediately = 0x1
+	lockfileExclusiveLock   = 0x2
+	errorLockViolation      = syscall.Errno(33)
+)
+
+// The locked byte sits far past the end of the file: Windows locks are
+// mandatory, and the PID at the start must stay readable by waiters.
+func lockOverlapped() *syscall.Overlapped {
+	return &syscall.Overlapped{OffsetHigh: 1}
+}
+
+func lockFileEx(f *os.File, flags uint32) error {
+	ol := lockOverlapped()
+	r, _, err := procLockFileEx.Call(f.Fd(), uintptr(flags), 0, 1, 0, uintptr(unsafe.Pointer(ol)))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
+
+// tryLockFile takes an exclusive lock on f without waiting and reports
+// whether it succeeded.
+func tryLockFile(f *os.File) (bool, error) {
+	err := lockFileEx(f, lockfileExclusiveLock|lockfileFailImmediately)
+	if err == errorLockViolation {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func lockFile(f *os.File) error {
+	return lockFileEx(f, lockfileExclusiveLock)
+}
+
+func unlockFile(f *os.File) error {
+	ol := lockOverlapped()
+	r, _, err := procUnlockFileEx.Call(f.Fd(), 0, 1, 0, uintptr(unsafe.Pointer(ol)))
+	if r == 0 {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Every build is recorded in ~/.ghpm/logs/<name>/<timestamp>.log: a header
+// with the directory and environment, everything the build printed, each
+// command with its exit status, and a footer with the result.
+
+const (
+	logTimeFormat  = "20060102-150405.000"
+	logsPerPackage = 20
+)
+
+var secretEnvWords = []string{"TOKEN", "SECRET", "PASSWORD", "PASSWD", "CREDENTIAL", "KEY"}
+
+func logsDir(name string) string {
+	return filepath.Join(baseDir, "logs", name)
+}
+
+// buildLog tees the process output into a log file while a build runs.
+type buildLog struct {
+	path     string
+	f        *os.File
+	mu       sync.Mutex
+	start    time.Time
+	exitCode int
+
+	stdout, stderr *os.File
+	pipes          []*os.File
+	done           sync.WaitGroup
+}
+
+// activeLog is the log of the build in progress, if any.
+var activeLog *buildLog
+
+// startBuildLog opens a new log for name and redirects os.Stdout and
+// os.Stderr through it until finish is called. It returns nil, after a
+// warning, when the log cannot be created.
+func startBuildLog(name, repoPath string) *buildLog {
+	dir := logsDir(name)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fmt.Println("Warning: cannot create build log:", err)
+		return nil
+	}
+	start := time.Now()
+	path := filepath.Join(dir, start.Format(logTimeFormat)+".log")
+	f, err := os.Create(path)
+	if err != nil {
+		fmt.Println("Warning: cannot create build log:", err)
+		return nil
+	}
+
+	l := &buildLog{path: path, f: f, start: start, stdout: os.Stdout, stderr: os.Stderr}
+	fmt.Fprintf(f, "package: %s\n", name)
+	fmt.Fprintf(f, "started: %s\n", start.Format(time.RFC3339))
+	fmt.Fprintf(f, "dir: %s\n", repoPath)
+	fmt.Fprintf(f, "args: %s\n", strings.Join(os.Args, " "))
+	fmt.Fprintln(f, "environment:")
+	env := os.Environ()
+	sort.Strings(env)
+	for _, kv := range env {
+		fmt.Fprintf(f, "  %s\n", redactEnv(kv))
+	}
+	fmt.Fprintln(f, "---")
+
+	os.Stdout = l.tee(l.stdout)
+	os.Stderr = l.tee(l.stderr)
+	activeLog = l
+	return l
+}
+
+// tee returns a pipe whose output is copied to both out and the log file.
+// Build commands get the pipe as their stdout or stderr.
+func (l *buildLog) tee(out *os.File) *os.File {
+	r, w, err := os.Pipe()
+	if err != nil {
+		return out
+	}
+	l.pipes = append(l.pipes, w)
+	l.done.Add(1)
+	go func() {
+		defer l.done.Done()
+		defer r.Close()
+		l.copy(out, r)
+	}()
+	return w
+}
+
+// Notes for the log alone travel through the stdout pipe between these
+// separators, so they stay in order with the build's own output.
+const (
+	logNoteStart = '\x1e'
+	logNoteEnd   = '\x1f'
+)
+
+// copy writes everything read from r to the log, and everything outside
+// log notes to out as well.
+func (l *buildLog) copy(out io.Writer, r io.Reader) {
+	buf := make([]byte, 32*1024)
+	inNote := false
+	for {
+		n, err := r.Read(buf)
+		chunk := buf[:n]
+		for len(chunk) > 0 {
+			sep := logNoteStart
+			if inNote {
+				sep = logNoteEnd
+			}
+			part := chunk
+			i := bytes.IndexByte(chunk, byte(sep))
+			if i >= 0 {
+				part = chunk[:i]
+			}
+			if !inNote {
+				out.Write(part)
+			}
+			l.Write(part)
+			if i < 0 {
+				break
+			}
+			inNote = !inNote
+			chunk = chunk[i+1:]
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (l *buildLog) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.f.Write(p)
+}
+
+// note adds a line to the log without showing it on the terminal.
+func (l *buildLog) note(format string, args ...any) {
+	fmt.Fprintf(os.Stdout, "%c%s\n%c", logNoteStart, fmt.Sprintf(format, args...), logNoteEnd)
+}
+
+func redactEnv(kv string) string {
+	key, _, _ := strings.Cut(kv, "=")
+	upper := strings.ToUpper(key)
+	for _, word := range secretEnvWords {
+		if strings.Contains(upper, word) {
+			return key + "=<redacted>"
+		}
+	}
+	return kv
+}
+
+// runLogged runs a build command with the build environment, noting it and
+// its exit status in the active build log.
+func runLogged(cmd *exec.Cmd) error {
+	withBuildEnv(cmd)
+	l := activeLog
+	if l != nil {
+		l.note("$ %s   (in %s)", strings.Join(cmd.Args, " "), cmd.Dir)
+	}
+	start := time.Now()
+	err := cmd.Run()
+	if l != nil {
+		code := 0
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			code = exitErr.ExitCode()
+		} else if err != nil {
+			code = -1
+		}
+		if code != 0 {
+			l.exitCode = code
+		}
+		l.note("[exit %d after %s]", code, time.Since(start).Round(time.Millisecond))
+	}
+	return err
+}
+
+// finish restores the terminal output and writes the result footer.
+func (l *buildLog) finish(res buildResult) {
+	if l == nil {
+		return
+	}
+	activeLog = nil
+	os.Stdout, os.Stderr = l.stdout, l.stderr
+	for _, w := range l.pipes {
+		w.Close()
+	}
+
+	// A background process started by the build may hold the pipe open;
+	// do not wait for it forever.
+	copied := make(chan struct{})
+	go func() {
+		l.done.Wait()
+		close(copied)
+	}()
+	select {
+	case <-copied:
+	case <-time.After(5 * time.Second):
+	}
+
+	result := "success"
+	code := 0
+	if !res.Built {
+		result = "failed"
+		code = l.exitCode
+		if code == 0 {
+			code = 1
+		}
+	}
+	if res.BuildCmd == "skipped" {
+		result = "skipped"
+	}
+	l.mu.Lock()
+	fmt.Fprintln(l.f, "---")
+	fmt.Fprintf(l.f, "build: %s\n", res.BuildCmd)
+	fmt.Fprintf(l.f, "result: %s\n", result)
+	fmt.Fprintf(l.f, "exit code: %d\n", code)
+	fmt.Fprintf(l.f, "duration: %s\n", time.Since(l.start).Round(time.Millisecond))
+	l.f.Close()
+	l.mu.Unlock()
+
+	if result == "failed" {
+		fmt.Println("Build log:", l.path)
+	}
+	pruneLogs(filepath.Dir(l.path))
+}
+
+// logFiles returns the logs of a package, oldest first.
+func logFiles(name string) []string {
+	files, _ := filepath.Glob(filepath.Join(logsDir(name), "*.log"))
+	sort.Strings(files)
+	return files
+}
+
+func pruneLogs(dir string) {
+	files, _ := filepath.Glob(filepath.Join(dir, "*.log"))
+	sort.Strings(files)
+	for len(files) > logsPerPackage {
+		os.Remove(files[0])
+		files = files[1:]
+	}
+}
+
+// logSummary reads the footer fields of a log file.
+func logSummary(path string) map[string]string {
+	fields := map[string]string{}
+	f, err := os.Open(path)
+	if err != nil {
+		return fields
+	}
+	defer f.Close()
+	footer := false
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "---" {
+			footer = true
+			fields = map[string]string{}
+			continue
+		}
+		if key, value, ok := strings.Cut(line, ": "); ok && footer {
+			fields[key] = value
+		}
+	}
+	return fields
+}
+
+// lastFailedLog returns the newest log of a failed build, or "".
+func lastFailedLog(name string) string {
+	files := logFiles(name)
+	for i := len(files) - 1; i >= 0; i-- {
+		if logSummary(files[i])["result"] == "failed" {
+			return files[i]
+		}
+	}
+	return ""
+}
+
+// logsCommand implements "ghpm logs <name> [--last|--list]".
+func logsCommand(name string, list bool) error {
+	files := logFiles(name)
+	if len(files) == 0 {
+		return notFoundError("no build logs for %s", name)
+	}
+
+	if list {
+		for _, path := range files {
+			s := logSummary(path)
+			when := strings.TrimSuffix(filepath.Base(path), ".log")
+			if t, err := time.ParseInLocation(logTimeFormat, when, time.Local); err == nil {
+				when = t.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%s  %-8s %-9s %s\n", when, s["result"], s["duration"], path)
+		}
+		return nil
+	}
+
+	last := files[len(files)-1]
+	data, err := os.ReadFile(last)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", last, err)
+	}
+	fmt.Println("==>", last)
+	os.Stdout.Write(data)
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestBuildLog(t *testing.T) {
+	testHome(t)
+	t.Setenv("GITHUB_TOKEN", "hunter2")
+	var path string
+	out := captureStdout(t, func() {
+		l := startBuildLog("tool", "/src/tool")
+		path = l.path
+		fmt.Println("Building...")
+		cmd := exec.Command("sh", "-c", "echo compiled; exit 3")
+		cmd.Stdout = os.Stdout
+		runLogged(cmd)
+		l.finish(buildResult{BuildCmd: "sh"})
+	})
+	if want := "Building...\ncompiled\nBuild log: " + path + "\n"; out != want {
+		t.Errorf("printed %q, want %q", out, want)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := string(data)
+	for _, want := range []string{
+		"package: tool\n",
+		"dir: /src/tool\n",
+		"  GITHUB_TOKEN=<redacted>\n",
+		"---\nBuilding...\n$ sh -c echo compiled; exit 3   (in )\ncompiled\n[exit 3 after ",
+		"result: failed\nexit code: 3\n",
+	} {
+		if !strings.Contains(log, want) {
+			t.Errorf("log lacks %q:\n%s", want, log)
+		}
+	}
+	if strings.Contains(log, "hunter2") {
+		t.Error("the log holds a secret")
+	}
+	if got := logSummary(path); got["result"] != "failed" || got["build"] != "sh" {
+		t.Errorf("summary %v", got)
+	}
+	if got := lastFailedLog("tool"); got != path {
+		t.Errorf("lastFailedLog = %q", got)
+	}
+}
+
+func TestPruneLogs(t *testing.T) {
+	testHome(t)
+	dir := logsDir("tool")
+	os.MkdirAll(dir, 0755)
+	for i := 0; i < logsPerPackage+5; i++ {
+		os.WriteFile(filepath.Join(dir, fmt.Sprintf("20240101-0000%02d.000.log", i)), []byte("---\nresult: success\n"), 0644)
+	}
+	pruneLogs(dir)
+	files := logFiles("tool")
+	if len(files) != logsPerPackage || filepath.Base(files[0]) != "20240101-000005.000.log" {
+		t.Errorf("kept %d logs from %s", len(files), filepath.Base(files[0]))
+	}
+	if got := lastFailedLog("tool"); got != "" {
+		t.Errorf("lastFailedLog = %q without failed builds", got)
+	}
+	if err := logsCommand("other", false); exitCode(err) != exitNotFound {
+		t.Errorf("logs of a package without builds: %v", err)
+	}
+}
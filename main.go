@@ -3,12 +3,14 @@ package main
 import (
 	"bufio"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
 	"time"
@@ -24,6 +26,70 @@ type Manifest struct {
 	Language    string    `json:"language,omitempty"`
 	Built       bool      `json:"built,omitempty"`
 	BuildCmd    string    `json:"build_cmd,omitempty"`
+	Binaries    []string  `json:"binaries,omitempty"`
+
+	BuildSystem         string  `json:"build_system,omitempty"`
+	BuildSystemOverride string  `json:"build_system_override,omitempty"`
+	Recipe              *Recipe `json:"recipe,omitempty"`
+	RecipeSource        string  `json:"recipe_source,omitempty"`
+
+	// Links are extra symlinks (man pages, completions) created for the
+	// package, recorded by link path.
+	Links []string `json:"links,omitempty"`
+
+	// Depends lists the packages this one needs, as owner/repo@constraint.
+	Depends []string `json:"depends,omitempty"`
+	// AsDependency is set when the package was only pulled in by another
+	// one, making it a candidate for autoremove.
+	AsDependency bool `json:"as_dependency,omitempty"`
+
+	// Health is the repository metadata from the last install or update.
+	Health *repoHealth `json:"health,omitempty"`
+
+	// License is an SPDX license expression, and LicenseFiles the license
+	// files found at the top of the clone.
+	License      string   `json:"license,omitempty"`
+	LicenseFiles []string `json:"license_files,omitempty"`
+
+	// PreviousCommit is the commit checked out before the last update or
+	// rollback; "ghpm rollback" returns to it.
+	PreviousCommit string `json:"previous_commit,omitempty"`
+
+	// Source is the directory a local package was installed from, and
+	// Linked is set when the package directory is a symlink to it rather
+	// than a copy; see local.go.
+	Source string `json:"source,omitempty"`
+	Linked bool   `json:"linked,omitempty"`
+}
+
+// installOptions carries the per-install choices given on the command line.
+type installOptions struct {
+	BuildSystem string
+	Recipe      *Recipe
+
+	// Constraint is set when installing a dependency and picks the
+	// revision to check out; see dependency.
+	Constraint   string
+	AsDependency bool
+	chain        []string
+
+	// NoBuild clones and links without building; SkipPreflight skips the
+	// toolchain check before cloning; Force installs repositories the
+	// health policy refuses; Full clones the whole history instead of a
+	// shallow clone. Dependencies inherit all four.
+	NoBuild       bool
+	SkipPreflight bool
+	Force         bool
+	Full          bool
+
+	// Bundle, when set, provides the repositories and recipes instead of
+	// GitHub; dependencies come from it too.
+	Bundle *bundle
+
+	// Source, when set, is a local directory to copy, or with Link to
+	// symlink, in place of a clone. Dependencies do not inherit it.
+	Source string
+	Link   bool
 }
 
 var baseDir, packagesDir, manifestsDir string
@@ -51,203 +117,461 @@ func initDirs() error {
 }
 
 func main() {
-	if len(os.Args) < 2 {
-		fmt.Println("Usage: ghpm <command> [args]")
-		fmt.Println("Commands: install, remove, list, search, update, info, check-gpg")
-		return
-	}
-
-	if err := initDirs(); err != nil {
-		fmt.Println("Failed to init directories:", err)
-		return
+	if err := run(); err != nil {
+		fmt.Fprintln(errOut, "Error:", err)
+		os.Exit(exitCode(err))
 	}
+}
 
-	if os.Args[1] == "install" || os.Args[1] == "search" {
-		if commandExists("gpg") {
-			out, err := exec.Command("gpg", "--list-secret-keys", "--keyid-format", "LONG").Output()
-			if err != nil || !strings.Contains(string(out), "sec") {
-				fmt.Println("⚠ No GPG keys found. Run 'ghpm check-gpg' for setup info.")
-				fmt.Println("")
-			}
-		}
+func init() {
+	commands = []*command{
+		{name: "install", args: "<owner/repo|name|./dir>... | --path <dir> | --from-bundle <file> [name...]",
+			summary: "Clone, build and link packages; a name without an owner is searched for first",
+			setup: func(fs *flag.FlagSet) func([]string) error {
+				opts := installFlags(fs)
+				search := searchFlags(fs)
+				jobs := jobsFlag(fs)
+				skipPreflight := fs.Bool("skip-preflight", false, "do not check the build tools before cloning")
+				force := fs.Bool("force", false, "install even if the health policy refuses the repository")
+				full := fs.Bool("full", false, "clone the whole history instead of only the newest commit")
+				fromBundle := fs.String("from-bundle", "", "install the packages in a `file` made by ghpm bundle create, or the named ones")
+				path := fs.String("path", "", "install the local `dir` as a package")
+				link := fs.Bool("link", false, "link a local directory in place instead of copying it")
+				return func(args []string) error {
+					n, err := jobs()
+					if err != nil {
+						return err
+					}
+					o, err := opts()
+					if err != nil {
+						return err
+					}
+					o.SkipPreflight = *skipPreflight
+					o.Force = *force
+					o.Full = *full
+					if *fromBundle != "" {
+						return installBundle(*fromBundle, args, o)
+					}
+					if *path != "" {
+						if len(args) > 0 {
+							return usageError("--path takes no other packages")
+						}
+						return installLocal(*path, *link, o)
+					}
+					if len(args) == 0 {
+						return findCommand("install").usageError()
+					}
+					if len(args) > 1 {
+						return installMany(args, n, flagArgs(fs, "j", "jobs"))
+					}
+					if isLocalPath(args[0]) {
+						return installLocal(args[0], *link, o)
+					}
+					if *link {
+						return usageError("--link needs a local directory")
+					}
+					if strings.Contains(args[0], "/") {
+						return installRepo(args[0], o)
+					}
+					s, err := search()
+					if err != nil {
+						return err
+					}
+					return searchAndPrompt(args[0], s, o)
+				}
+			}},
+		{name: "remove", args: "<name>", minArgs: 1, packages: true,
+			summary: "Remove a package and its links",
+			setup: func(fs *flag.FlagSet) func([]string) error {
+				cascade := fs.Bool("cascade", false, "also remove the packages that depend on it")
+				return func(args []string) error {
+					return removeRepo(args[0], *cascade)
+				}
+			}},
+		{name: "autoremove",
+			summary: "Remove dependencies no installed package needs any more",
+			setup: func(fs *flag.FlagSet) func([]string) error {
+				dryRun := fs.Bool("dry-run", false, "only show what would be removed")
+				return func(args []string) error {
+					return autoremove(*dryRun)
+				}
+			}},
+		{name: "list",
+			summary: "List installed packages",
+			setup: func(fs *flag.FlagSet) func([]string) error {
+				explicit := fs.Bool("explicit", false, "only packages installed on request")
+				deps := fs.Bool("deps", false, "only packages installed as dependencies")
+				output := outputFlags(fs)
+				return func(args []string) error {
+					out, err := output()
+					if err != nil {
+						return err
+					}
+					return listRepos(*explicit, *deps, out)
+				}
+			}},
+		{name: "search", args: "<query>...", minArgs: 1,
+			summary: "Search GitHub and install the chosen result",
+			setup: func(fs *flag.FlagSet) func([]string) error {
+				search := searchFlags(fs)
+				output := outputFlags(fs)
+				return func(args []string) error {
+					s, err := search()
+					if err != nil {
+						return err
+					}
+					out, err := output()
+					if err != nil {
+						return err
+					}
+					if out.machine() {
+						return printSearch(strings.Join(args, " "), s, out)
+					}
+					return searchAndPrompt(strings.Join(args, " "), s, installOptions{})
+				}
+			}},
+		{name: "outdated", args: "[name...]", packages: true,
+			summary: "Show packages whose upstream has new commits",
+			setup: func(fs *flag.FlagSet) func([]string) error {
+				output := outputFlags(fs)
+				return func(args []string) error {
+					out, err := output()
+					if err != nil {
+						return err
+					}
+					return outdatedCommand(args, out)
+				}
+			}},
+		{name: "update", args: "<name>... | --all", packages: true,
+			summary: "Pull and rebuild packages",
+			setup: func(fs *flag.FlagSet) func([]string) error {
+				all := fs.Bool("all", false, "update every installed package")
+				jobs := jobsFlag(fs)
+				return func(names []string) error {
+					if len(names) < 1 && !*all {
+						return findCommand("update").usageError()
+					}
+					n, err := jobs()
+					if err != nil {
+						return err
+					}
+					if *all {
+						names = nil
+						for _, m := range loadAllManifests() {
+							names = append(names, m.Name)
+						}
+						if len(names) == 0 {
+							fmt.Println("No packages installed.")
+							return nil
+						}
+					}
+					if len(names) == 1 && !*all {
+						return updateRepo(names[0])
+					}
+					return updateMany(names, n)
+				}
+			}},
+		{name: "rollback", args: "<name> [tag|commit]", minArgs: 1, packages: true,
+			summary: "Go back to the revision before the last update, or to the one given",
+			setup: func(fs *flag.FlagSet) func([]string) error {
+				return func(args []string) error {
+					ref := ""
+					if len(args) > 1 {
+						ref = args[1]
+					}
+					return rollbackRepo(args[0], ref)
+				}
+			}},
+		{name: "info", args: "<name>", minArgs: 1, packages: true,
+			summary: "Show details of an installed package",
+			setup: func(fs *flag.FlagSet) func([]string) error {
+				detect := fs.Bool("detect", false, "explain how the build system was detected")
+				output := outputFlags(fs)
+				return func(args []string) error {
+					out, err := output()
+					if err != nil {
+						return err
+					}
+					if *detect {
+						return showDetection(args[0])
+					}
+					return showInfo(args[0], out)
+				}
+			}},
+		{name: "edit", args: "<name>", minArgs: 1, packages: true,
+			summary: "Change or show the build settings of a package",
+			setup: func(fs *flag.FlagSet) func([]string) error {
+				builds, bins, system := recipeFlags(fs)
+				clear := fs.Bool("clear", false, "drop all build overrides")
+				return func(args []string) error {
+					return editPackage(args[0], *builds, *bins, *system, *clear)
+				}
+			}},
+		{name: "logs", args: "<name>", minArgs: 1, packages: true,
+			summary: "Show the build logs of a package",
+			setup: func(fs *flag.FlagSet) func([]string) error {
+				fs.Bool("last", false, "show the newest log (the default)")
+				list := fs.Bool("list", false, "list the kept logs instead")
+				return func(args []string) error {
+					return logsCommand(args[0], *list)
+				}
+			}},
+		{name: "recipes", args: "[sync | show <owner/repo>]",
+			summary: "Show, sync or look up the recipe index",
+			setup: func(fs *flag.FlagSet) func([]string) error {
+				return recipesCommand
+			}},
+		{name: "toolchains", args: "[install|remove <go|node|rust> <version>]",
+			summary: "List, install or remove managed toolchains",
+			setup: func(fs *flag.FlagSet) func([]string) error {
+				return toolchainsCommand
+			}},
+		{name: "config", args: "[key [value]]",
+			summary: "Show or change settings",
+			setup: func(fs *flag.FlagSet) func([]string) error {
+				return configCommand
+			}},
+		{name: "licenses",
+			summary: "List installed packages by license",
+			setup: func(fs *flag.FlagSet) func([]string) error {
+				check := fs.Bool("check", false, "exit with an error if a package breaks the license policy")
+				output := outputFlags(fs)
+				return func(args []string) error {
+					out, err := output()
+					if err != nil {
+						return err
+					}
+					return licensesCommand(out, *check)
+				}
+			}},
+		{name: "audit", args: "[name...]", packages: true,
+			summary: "Check the libraries of installed packages against imported advisories",
+			setup: func(fs *flag.FlagSet) func([]string) error {
+				source := fs.String("import", "", "first import OSV advisories from a .json `file`, .zip export or directory")
+				severity := fs.String("severity", "low", "only report advisories of this `severity` or higher: low, moderate, high, critical; those without one are always reported")
+				output := outputFlags(fs)
+				return func(args []string) error {
+					out, err := output()
+					if err != nil {
+						return err
+					}
+					if *source != "" {
+						n, err := importAdvisories(*source)
+						if err != nil {
+							return err
+						}
+						fmt.Fprintf(errOut, "Imported %d advisories from %s\n", n, *source)
+					}
+					return auditCommand(args, *severity, out)
+				}
+			}},
+		{name: "sbom",
+			summary: "Write a software bill of materials for the installed packages",
+			setup: func(fs *flag.FlagSet) func([]string) error {
+				format := fs.String("format", "cyclonedx", "document `format`: "+strings.Join(sbomFormats, ", "))
+				output := new(string)
+				for _, name := range []string{"output", "o"} {
+					fs.StringVar(output, name, "", "write the document to `file` instead of stdout")
+				}
+				return func(args []string) error {
+					return sbomCommand(*format, *output)
+				}
+			}},
+		{name: "cache", args: "<size|prune>", minArgs: 1,
+			summary: "Show or shrink the shared git object cache",
+			setup: func(fs *flag.FlagSet) func([]string) error {
+				all := fs.Bool("all", false, "with prune, empty the whole cache")
+				return func(args []string) error {
+					switch args[0] {
+					case "size":
+						return cacheSize()
+					case "prune":
+						return cachePrune(*all)
+					}
+					return findCommand("cache").usageError()
+				}
+			}},
+		{name: "bundle", args: "create <name>...", minArgs: 2,
+			summary: "Pack installed packages and their dependencies for installing offline",
+			setup: func(fs *flag.FlagSet) func([]string) error {
+				output := new(string)
+				for _, name := range []string{"output", "o"} {
+					fs.StringVar(output, name, "ghpm-bundle.tar", "write the bundle to `file`")
+				}
+				return func(args []string) error {
+					return bundleCommand(args, *output)
+				}
+			}},
+		{name: "check-gpg",
+			summary: "Check for GPG keys",
+			setup: func(fs *flag.FlagSet) func([]string) error {
+				return func(args []string) error {
+					return checkGPGKeys()
+				}
+			}},
+		{name: "version",
+			summary: "Print the ghpm version",
+			setup: func(fs *flag.FlagSet) func([]string) error {
+				return func(args []string) error {
+					fmt.Println(versionString())
+					return nil
+				}
+			}},
+		{name: "completion", args: "<bash|zsh|fish>", minArgs: 1,
+			summary: "Print a shell completion script",
+			setup: func(fs *flag.FlagSet) func([]string) error {
+				return func(args []string) error {
+					return completionCommand(args[0])
+				}
+			}},
 	}
+}
 
-	command := os.Args[1]
+// recipeFlags defines the build override flags shared by install and edit.
+func recipeFlags(fs *flag.FlagSet) (builds, bins *flagList, system *string) {
+	builds, bins = &flagList{}, &flagList{}
+	fs.Var(builds, "build", "build `command` to run instead of the detected one (repeatable)")
+	fs.Var(builds, "build-cmd", "same as --build")
+	fs.Var(bins, "bin", "`path` of a binary to link, relative to the clone (repeatable)")
+	system = fs.String("build-system", "", "use this build `system` instead of detecting one")
+	return builds, bins, system
+}
 
-	switch command {
-	case "install":
-		if len(os.Args) < 3 {
-			fmt.Println("Usage: ghpm install owner/repo")
-			return
-		}
-		repoArg := os.Args[2]
-		if strings.Contains(repoArg, "/") {
-			installRepo(repoArg)
-		} else {
-			searchAndPrompt(repoArg)
-		}
-	case "remove":
-		if len(os.Args) < 3 {
-			fmt.Println("Usage: ghpm remove repo-name")
-			return
-		}
-		removeRepo(os.Args[2])
-	case "list":
-		listRepos()
-	case "search":
-		if len(os.Args) < 3 {
-			fmt.Println("Usage: ghpm search <query>")
-			return
-		}
-		searchAndPrompt(os.Args[2])
-	case "update":
-		if len(os.Args) < 3 {
-			fmt.Println("Usage: ghpm update <repo-name>")
-			return
+// installFlags defines the build flags of install on fs. The returned
+// function gives the install options once fs is parsed.
+func installFlags(fs *flag.FlagSet) func() (installOptions, error) {
+	builds, bins, system := recipeFlags(fs)
+	noBuild := fs.Bool("no-build", false, "clone and link without building")
+	return func() (installOptions, error) {
+		opts := installOptions{BuildSystem: *system, NoBuild: *noBuild}
+		if opts.BuildSystem != "" && !knownBuildSystem(opts.BuildSystem) {
+			return opts, usageError("unknown build system %s (build systems: %s)", opts.BuildSystem, strings.Join(buildSystemNames(), ", "))
 		}
-		updateRepo(os.Args[2])
-	case "info":
-		if len(os.Args) < 3 {
-			fmt.Println("Usage: ghpm info <repo-name>")
-			return
+		recipe := &Recipe{Build: stringList(*builds), Bin: stringList(*bins)}
+		if !recipe.empty() {
+			opts.Recipe = recipe
 		}
-		showInfo(os.Args[2])
-	case "check-gpg":
-		checkGPGKeys()
-	default:
-		fmt.Println("Unknown command:", command)
+		return opts, nil
 	}
 }
 
+func isFlagArg(arg string) bool {
+	return strings.HasPrefix(arg, "-") && arg != "-"
+}
+
 type ghSearchResult struct {
 	TotalCount int          `json:"total_count"`
 	Items      []ghRepoItem `json:"items"`
 }
 
 type ghRepoItem struct {
-	FullName        string  `json:"full_name"`
-	HTMLURL         string  `json:"html_url"`
-	Description     string  `json:"description"`
-	StargazersCount int     `json:"stargazers_count"`
-	Language        *string `json:"language"`
+	FullName        string     `json:"full_name"`
+	HTMLURL         string     `json:"html_url"`
+	Description     string     `json:"description"`
+	StargazersCount int        `json:"stargazers_count"`
+	Language        *string    `json:"language"`
+	PushedAt        time.Time  `json:"pushed_at"`
+	Archived        bool       `json:"archived"`
+	License         *ghLicense `json:"license"`
+}
+
+type ghLicense struct {
+	SPDXID string `json:"spdx_id"`
+	Name   string `json:"name"`
+}
+
+func (r ghRepoItem) language() string {
+	if r.Language != nil && *r.Language != "" {
+		return *r.Language
+	}
+	return "Unknown"
+}
+
+// license returns the SPDX identifier GitHub detected, or "none".
+func (r ghRepoItem) license() string {
+	if r.License == nil || r.License.SPDXID == "" {
+		return "none"
+	}
+	return r.License.SPDXID
 }
 
-func searchAndPrompt(query string) {
-	results, err := searchRepos(query, 10)
+// searchAndPrompt searches GitHub for query and installs the result chosen
+// by the search options or, failing that, by the user.
+func searchAndPrompt(query string, search searchOptions, opts installOptions) error {
+	sr, err := searchRepos(query, search)
 	if err != nil {
-		fmt.Println("Search failed:", err)
-		return
+		return networkError("search failed: %v", err)
 	}
+	results := sr.Items
 
 	if len(results) == 0 {
-		fmt.Println("No results found for:", query)
-		return
+		return notFoundError("no results found for: %s", query)
 	}
 
-	for i, r := range results {
-		lang := "Unknown"
-		if r.Language != nil && *r.Language != "" {
-			lang = *r.Language
+	chosen, err := chooseResult(results, search)
+	if err != nil {
+		return err
+	}
+	if chosen != nil {
+		return installRepo(chosen.FullName, opts)
+	}
+
+	if canBrowse() {
+		picked, err := browseResults(query, results)
+		if err == nil {
+			return installChosen(picked, opts)
 		}
-		fmt.Printf("%d) %s  ★%d  %s\n", i+1, r.FullName, r.StargazersCount, lang)
+		if errors.Is(err, errSearchCancelled) {
+			return usageError("no selection made")
+		}
+		// The terminal cannot be driven; use the numbered prompt.
+	}
+
+	for i, r := range results {
+		fmt.Printf("%d) %s  ★%d  %s\n", i+1, r.FullName, r.StargazersCount, r.language())
+	}
+	if shown := (search.Page-1)*search.Limit + len(results); sr.TotalCount > shown {
+		fmt.Printf("Showing %d of %d results; --page %d shows more.\n", len(results), sr.TotalCount, search.Page+1)
 	}
 
 	fmt.Print("Select a number: ")
 	reader := bufio.NewReader(os.Stdin)
 	input, err := reader.ReadString('\n')
 	if err != nil && err != io.EOF {
-		fmt.Println("Failed to read input:", err)
-		return
+		return fmt.Errorf("failed to read input: %v", err)
 	}
 	input = strings.TrimSpace(input)
 	if input == "" {
-		fmt.Println("No selection made")
-		return
+		return usageError("no selection made")
 	}
 	idx, err := strconv.Atoi(input)
 	if err != nil {
-		fmt.Println("Invalid selection")
-		return
+		return usageError("invalid selection %q", input)
 	}
 	if idx < 1 || idx > len(results) {
-		fmt.Println("Selection out of range")
-		return
+		return usageError("selection out of range")
 	}
 
-	chosen := results[idx-1]
-	installRepo(chosen.FullName)
+	return installRepo(results[idx-1].FullName, opts)
 }
 
-func searchRepos(query string, perPage int) ([]ghRepoItem, error) {
-	if perPage <= 0 || perPage > 50 {
-		perPage = 10
-	}
-	url := fmt.Sprintf("https://api.github.com/search/repositories?q=%s&per_page=%d", query, perPage)
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Accept", "application/vnd.github.v3+json")
-	req.Header.Set("User-Agent", "ghpm-cli")
-
-	client := &http.Client{Timeout: 15 * time.Second}
-	resp, err := client.Do(req)
+// printSearch prints search results for scripts instead of prompting.
+func printSearch(query string, search searchOptions, out outputMode) error {
+	sr, err := searchRepos(query, search)
 	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("GitHub API returned status: %s", resp.Status)
+		return networkError("search failed: %v", err)
 	}
-
-	var sr ghSearchResult
-	dec := json.NewDecoder(resp.Body)
-	if err := dec.Decode(&sr); err != nil {
-		return nil, err
+	records := []searchRecord{}
+	for _, r := range sr.Items {
+		records = append(records, newSearchRecord(r))
 	}
-
-	return sr.Items, nil
+	return out.write(records)
 }
 
-func detectLanguage(repoPath string) string {
-	checks := []struct {
-		file string
-		lang string
-	}{
-		{"go.mod", "Go"},
-		{"Cargo.toml", "Rust"},
-		{"package.json", "Node"},
-		{"setup.py", "Python"},
-		{"pyproject.toml", "Python"},
-		{"requirements.txt", "Python"},
-		{"Gemfile", "Ruby"},
-		{"Makefile", "C/C++"},
-		{"CMakeLists.txt", "C/C++"},
-	}
-
-	for _, check := range checks {
-		if _, err := os.Stat(filepath.Join(repoPath, check.file)); err == nil {
-			return check.lang
-		}
-	}
-
-	entries, err := os.ReadDir(repoPath)
-	if err == nil {
-		for _, e := range entries {
-			if !e.IsDir() && strings.HasSuffix(e.Name(), ".sh") {
-				if strings.Contains(strings.ToLower(e.Name()), "install") {
-					return "Shell"
-				}
-			}
-		}
-	}
-
-	if matches, _ := filepath.Glob(filepath.Join(repoPath, "*.gemspec")); len(matches) > 0 {
-		return "Ruby"
-	}
-
-	return "Unknown"
+func searchRepos(query string, o searchOptions) (ghSearchResult, error) {
+	var sr ghSearchResult
+	err := githubGet(searchPath(query, o), &sr)
+	return sr, err
 }
 
 type binLink struct {
@@ -290,8 +614,101 @@ func packageJSONBinLinks(repoPath string) []binLink {
 	return links
 }
 
+func composerBinPaths(repoPath string) []string {
+	data, err := os.ReadFile(filepath.Join(repoPath, "composer.json"))
+	if err != nil {
+		return nil
+	}
+	var raw struct {
+		Bin []string `json:"bin"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil
+	}
+	return raw.Bin
+}
+
+type goMainPackage struct {
+	ImportPath string
+	Rel        string
+	Binary     string
+}
+
+// goMainPackages lists every package main in the module rooted at repoPath.
+// go list already skips vendor, testdata and nested modules for us.
+func goMainPackages(repoPath string) ([]goMainPackage, error) {
+	cmd := withBuildEnv(exec.Command("go", "list", "-e", "-f", `{{if eq .Name "main"}}{{.ImportPath}}{{"\t"}}{{.Dir}}{{end}}`, "./..."))
+	cmd.Dir = repoPath
+	cmd.Stderr = os.Stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, err
+	}
+
+	var pkgs []goMainPackage
+	for _, line := range strings.Split(string(out), "\n") {
+		parts := strings.SplitN(strings.TrimSpace(line), "\t", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		rel, err := filepath.Rel(repoPath, parts[1])
+		if err != nil {
+			continue
+		}
+		pkgs = append(pkgs, goMainPackage{
+			ImportPath: parts[0],
+			Rel:        filepath.ToSlash(rel),
+			Binary:     goBinaryName(parts[0]),
+		})
+	}
+	return pkgs, nil
+}
+
+// goBinaryName mirrors the name go build picks for an import path, dropping a
+// trailing major version element such as /v2.
+func goBinaryName(importPath string) string {
+	elems := strings.Split(importPath, "/")
+	name := elems[len(elems)-1]
+	if len(elems) > 1 && len(name) > 1 && name[0] == 'v' {
+		if _, err := strconv.Atoi(name[1:]); err == nil {
+			name = elems[len(elems)-2]
+		}
+	}
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	return name
+}
+
+func packageBinDir(name string) string {
+	return filepath.Join(baseDir, "bin", name)
+}
+
+// commandExists reports whether name is on PATH, the build commands' PATH
+// while a managed toolchain is active.
+// stageBinDir makes an empty directory next to binDir for a build to write
+// its binaries into, so the ones from the last good build stay in place if
+// this one fails. replaceBinDir then swaps it in.
+func stageBinDir(binDir string) (string, error) {
+	if err := os.MkdirAll(filepath.Dir(binDir), 0755); err != nil {
+		return "", err
+	}
+	dir, err := os.MkdirTemp(filepath.Dir(binDir), "."+filepath.Base(binDir)+".new-")
+	if err != nil {
+		return "", err
+	}
+	return dir, os.Chmod(dir, 0755)
+}
+
+func replaceBinDir(binDir, staged string) error {
+	if err := os.RemoveAll(binDir); err != nil {
+		return err
+	}
+	return os.Rename(staged, binDir)
+}
+
 func commandExists(name string) bool {
-	_, err := exec.LookPath(name)
+	_, err := buildLookPath(name)
 	return err == nil
 }
 
@@ -313,12 +730,25 @@ func warnIfPathMissing(binDir string) {
 	fmt.Println("Warning:", binDir, "is not on your PATH. Add it to ~/.zshrc or ~/.bashrc.")
 }
 
-func checkGPGKeys() {
+// warnMissingGPGKeys prints a hint when gpg has no secret keys. It goes to
+// stderr so that it cannot mix with --json or --format results, and --quiet
+// still hides it.
+func warnMissingGPGKeys() {
 	if !commandExists("gpg") {
-		fmt.Println("❌ GPG is not installed")
-		fmt.Println("Install: apt install gnupg (Ubuntu) or brew install gnupg (macOS)")
 		return
 	}
+	out, err := exec.Command("gpg", "--list-secret-keys", "--keyid-format", "LONG").Output()
+	if err != nil || !strings.Contains(string(out), "sec") {
+		fmt.Fprintln(os.Stderr, "⚠ No GPG keys found. Run 'ghpm check-gpg' for setup info.")
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+func checkGPGKeys() error {
+	if !commandExists("gpg") {
+		fmt.Println("Install: apt install gnupg (Ubuntu) or brew install gnupg (macOS)")
+		return verifyError("GPG is not installed")
+	}
 
 	fmt.Println("✓ GPG is installed")
 
@@ -334,59 +764,84 @@ func checkGPGKeys() {
 	if err == nil && strings.Contains(string(out), "sec") {
 		fmt.Println("\n🔐 Private Keys Found:")
 		fmt.Println(string(out))
-	} else {
-		fmt.Println("⚠ No private keys found")
-		fmt.Println("\nTo create a key: gpg --full-generate-key")
+		return nil
 	}
+	fmt.Println("\nTo create a key: gpg --full-generate-key")
+	return verifyError("no private GPG keys found")
 }
 
-func autoBuildRepo(repoPath, language string) (bool, string) {
-	for _, arg := range os.Args {
-		if arg == "--no-build" {
-			fmt.Println("Skipping build (--no-build flag)")
-			return false, "skipped"
-		}
-	}
-
-	if language == "Unknown" {
+func autoBuildRepo(repoPath string, det detection) (bool, string) {
+	if det.BuildSystem == "" {
 		fmt.Println("Could not detect language - skipping auto-build")
 		fmt.Println("You may need to build/install manually. Check the repo's README.")
 		return false, "unknown language"
 	}
 
-	fmt.Println("Detected language:", language)
+	fmt.Println("Detected language:", det.Language)
+	fmt.Println("Build system:", det.BuildSystem, "("+strings.Join(det.Reasons, ", ")+")")
 	fmt.Println("Attempting auto-build/install...")
 
 	var cmd *exec.Cmd
 	var cmdDesc string
 
-	switch language {
-	case "Go":
+	switch det.BuildSystem {
+	case "go":
 		if !commandExists("go") {
 			fmt.Println("Go is not installed or not on PATH.")
 			return false, "missing go"
 		}
-		cmdDesc = "go install"
-		cmd = exec.Command("go", "install")
-		cmd.Dir = repoPath
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-		if err := cmd.Run(); err != nil {
-			fmt.Println("go install failed, trying go build...")
-			cmdDesc = "go build"
-			cmd = exec.Command("go", "build")
+		mains, err := goMainPackages(repoPath)
+		if err != nil {
+			fmt.Println("go list failed:", err)
+			return false, "go list"
+		}
+		if len(mains) == 0 {
+			fmt.Println("No main packages found. This looks like a library.")
+			return false, "no main packages"
+		}
+
+		binDir := packageBinDir(filepath.Base(repoPath))
+		staged, err := stageBinDir(binDir)
+		if err != nil {
+			fmt.Println("Failed to create bin directory:", err)
+			return false, "mkdir " + binDir
+		}
+		defer os.RemoveAll(staged)
+
+		// Main packages with the same last path element would build to the
+		// same file; only the first one is built.
+		var builtPkgs []string
+		owners := map[string]string{}
+		for _, pkg := range mains {
+			if owner, ok := owners[pkg.Binary]; ok {
+				fmt.Printf("Warning: not building %s: its binary %s would overwrite the one from %s\n", pkg.ImportPath, pkg.Binary, owner)
+				continue
+			}
+			owners[pkg.Binary] = pkg.ImportPath
+			fmt.Println("Building", pkg.ImportPath, "...")
+			cmd = exec.Command("go", "build", "-o", filepath.Join(staged, pkg.Binary), "./"+pkg.Rel)
 			cmd.Dir = repoPath
 			cmd.Stdout = os.Stdout
 			cmd.Stderr = os.Stderr
-			if err := cmd.Run(); err != nil {
-				fmt.Println("Build failed. You may need to build manually.")
-				return false, cmdDesc
+			if err := runLogged(cmd); err != nil {
+				fmt.Println("go build failed for", pkg.ImportPath)
+				continue
 			}
+			builtPkgs = append(builtPkgs, "./"+pkg.Rel)
+		}
+		cmdDesc = "go build -o " + binDir + " " + strings.Join(builtPkgs, " ")
+		if len(builtPkgs) == 0 {
+			fmt.Println("Build failed. You may need to build manually.")
+			return false, "go build"
+		}
+		if err := replaceBinDir(binDir, staged); err != nil {
+			fmt.Println("Failed to install the binaries:", err)
+			return false, cmdDesc
 		}
 		fmt.Println("Build successful!")
 		return true, cmdDesc
 
-	case "Rust":
+	case "cargo":
 		if !commandExists("cargo") {
 			fmt.Println("Rust (cargo) is not installed or not on PATH.")
 			return false, "missing cargo"
@@ -396,14 +851,14 @@ func autoBuildRepo(repoPath, language string) (bool, string) {
 		cmd.Dir = repoPath
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
-		if err := cmd.Run(); err != nil {
+		if err := runLogged(cmd); err != nil {
 			fmt.Println("cargo install failed, trying cargo build...")
 			cmdDesc = "cargo build --release"
 			cmd = exec.Command("cargo", "build", "--release")
 			cmd.Dir = repoPath
 			cmd.Stdout = os.Stdout
 			cmd.Stderr = os.Stderr
-			if err := cmd.Run(); err != nil {
+			if err := runLogged(cmd); err != nil {
 				fmt.Println("Build failed. You may need to build manually.")
 				return false, cmdDesc
 			}
@@ -411,7 +866,7 @@ func autoBuildRepo(repoPath, language string) (bool, string) {
 		fmt.Println("Build successful!")
 		return true, cmdDesc
 
-	case "Node":
+	case "npm":
 		if !commandExists("npm") {
 			fmt.Println("Node (npm) is not installed or not on PATH.")
 			return false, "missing npm"
@@ -421,7 +876,7 @@ func autoBuildRepo(repoPath, language string) (bool, string) {
 		cmd.Dir = repoPath
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
-		if err := cmd.Run(); err != nil {
+		if err := runLogged(cmd); err != nil {
 			fmt.Println("npm install failed. You may need to install manually.")
 			return false, cmdDesc
 		}
@@ -429,7 +884,7 @@ func autoBuildRepo(repoPath, language string) (bool, string) {
 		fmt.Println("Note: This is a Node project. Check package.json for run commands.")
 		return true, cmdDesc
 
-	case "Python":
+	case "pip":
 		if !commandExists("pip") && !commandExists("python") {
 			fmt.Println("Python is not installed or not on PATH.")
 			return false, "missing python/pip"
@@ -440,7 +895,7 @@ func autoBuildRepo(repoPath, language string) (bool, string) {
 			cmd.Dir = repoPath
 			cmd.Stdout = os.Stdout
 			cmd.Stderr = os.Stderr
-			if err := cmd.Run(); err != nil {
+			if err := runLogged(cmd); err != nil {
 				fmt.Println("pip install failed, trying setup.py...")
 				if !commandExists("python") {
 					fmt.Println("python is not installed or not on PATH.")
@@ -451,7 +906,7 @@ func autoBuildRepo(repoPath, language string) (bool, string) {
 				cmd.Dir = repoPath
 				cmd.Stdout = os.Stdout
 				cmd.Stderr = os.Stderr
-				if err := cmd.Run(); err != nil {
+				if err := runLogged(cmd); err != nil {
 					fmt.Println("Install failed. You may need to install manually.")
 					return false, cmdDesc
 				}
@@ -465,15 +920,14 @@ func autoBuildRepo(repoPath, language string) (bool, string) {
 		cmd.Dir = repoPath
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
-		if err := cmd.Run(); err != nil {
+		if err := runLogged(cmd); err != nil {
 			fmt.Println("Install failed. You may need to install manually.")
 			return false, cmdDesc
 		}
 		fmt.Println("Build successful!")
 		return true, cmdDesc
 
-	case "Ruby":
-
+	case "ruby":
 		if !commandExists("ruby") {
 			fmt.Println("Ruby is not installed or not on PATH.")
 			return false, "missing ruby"
@@ -481,7 +935,7 @@ func autoBuildRepo(repoPath, language string) (bool, string) {
 		fmt.Println("Ruby project detected. Skipping auto-build; will link bin scripts if present.")
 		return false, "ruby: no build required"
 
-	case "Shell":
+	case "shell":
 		if !commandExists("sh") {
 			fmt.Println("sh is not available on PATH.")
 			return false, "missing sh"
@@ -513,140 +967,415 @@ func autoBuildRepo(repoPath, language string) (bool, string) {
 		cmd.Dir = repoPath
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
-		if err := cmd.Run(); err != nil {
+		if err := runLogged(cmd); err != nil {
 			fmt.Println("Install script failed. Check the README for manual installation.")
 			return false, cmdDesc
 		}
 		fmt.Println("Install script completed!")
 		return true, cmdDesc
 
-	case "C/C++":
-		hasMake := commandExists("make")
-		hasCmake := commandExists("cmake")
-		if !hasMake && !hasCmake {
-			fmt.Println("Neither make nor cmake is available on PATH.")
-			return false, "missing make/cmake"
+	case "make":
+		if !commandExists("make") {
+			fmt.Println("make is not installed or not on PATH.")
+			return false, "missing make"
 		}
-
 		cmdDesc = "make"
-		if hasMake {
-			_, err := os.Stat(filepath.Join(repoPath, "Makefile"))
-			if err == nil {
-				fmt.Println("Running make...")
-				cmd = exec.Command("make")
-				cmd.Dir = repoPath
-				cmd.Stdout = os.Stdout
-				cmd.Stderr = os.Stderr
-				if err := cmd.Run(); err != nil {
-					fmt.Println("make failed. You may need to build manually.")
-					return false, cmdDesc
-				}
-				fmt.Println("Running make install...")
-				cmdInstall := exec.Command("make", "install")
-				cmdInstall.Dir = repoPath
-				cmdInstall.Stdout = os.Stdout
-				cmdInstall.Stderr = os.Stderr
-				if err := cmdInstall.Run(); err != nil {
-					fmt.Println("make install failed (this is sometimes expected)")
-					fmt.Println("Binary may be in:", repoPath)
-				}
-				fmt.Println("Build successful!")
-				return true, cmdDesc + " && make install"
-			}
+		fmt.Println("Running make...")
+		cmd = exec.Command("make")
+		cmd.Dir = repoPath
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := runLogged(cmd); err != nil {
+			fmt.Println("make failed. You may need to build manually.")
+			return false, cmdDesc
 		}
+		fmt.Println("Running make install...")
+		cmdInstall := exec.Command("make", "install")
+		cmdInstall.Dir = repoPath
+		cmdInstall.Stdout = os.Stdout
+		cmdInstall.Stderr = os.Stderr
+		if err := runLogged(cmdInstall); err != nil {
+			fmt.Println("make install failed (this is sometimes expected)")
+			fmt.Println("Binary may be in:", repoPath)
+		}
+		fmt.Println("Build successful!")
+		return true, cmdDesc + " && make install"
 
-		if hasCmake {
-			_, err := os.Stat(filepath.Join(repoPath, "CMakeLists.txt"))
-			if err == nil {
-				buildDir := filepath.Join(repoPath, "build")
-				os.MkdirAll(buildDir, 0755)
-
-				cmdDesc = "cmake && make"
-				fmt.Println("Running cmake...")
-				cmd = exec.Command("cmake", "..")
-				cmd.Dir = buildDir
-				cmd.Stdout = os.Stdout
-				cmd.Stderr = os.Stderr
-				if err := cmd.Run(); err != nil {
-					fmt.Println("cmake failed. You may need to build manually.")
-					return false, cmdDesc
-				}
-
-				fmt.Println("Running make...")
-				cmd = exec.Command("make")
-				cmd.Dir = buildDir
-				cmd.Stdout = os.Stdout
-				cmd.Stderr = os.Stderr
-				if err := cmd.Run(); err != nil {
-					fmt.Println("make failed. You may need to build manually.")
-					return false, cmdDesc
-				}
-				fmt.Println("Build successful!")
-				return true, cmdDesc
-			}
+	case "cmake":
+		if !commandExists("cmake") || !commandExists("make") {
+			fmt.Println("cmake and make are required but not both on PATH.")
+			return false, "missing cmake/make"
 		}
+		buildDir := filepath.Join(repoPath, "build")
+		os.MkdirAll(buildDir, 0755)
 
-		fmt.Println("No Makefile or CMakeLists.txt found. Check README for build instructions.")
-		return false, "no build system found"
+		cmdDesc = "cmake && make"
+		fmt.Println("Running cmake...")
+		cmd = exec.Command("cmake", "..")
+		cmd.Dir = buildDir
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := runLogged(cmd); err != nil {
+			fmt.Println("cmake failed. You may need to build manually.")
+			return false, cmdDesc
+		}
 
-	default:
-		fmt.Println("Unsupported language for auto-build")
-		return false, "unsupported language"
-	}
-}
+		fmt.Println("Running make...")
+		cmd = exec.Command("make")
+		cmd.Dir = buildDir
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := runLogged(cmd); err != nil {
+			fmt.Println("make failed. You may need to build manually.")
+			return false, cmdDesc
+		}
+		fmt.Println("Build successful!")
+		return true, cmdDesc
 
-func installRepo(repo string) {
-	if !strings.Contains(repo, "/") {
-		fmt.Println("Invalid repo format. Use owner/repo")
-		return
-	}
+	case "meson":
+		if !commandExists("meson") {
+			fmt.Println("meson is not installed or not on PATH.")
+			return false, "missing meson"
+		}
+		cmdDesc = "meson setup build && meson compile -C build"
+		steps := [][]string{
+			{"meson", "setup", "build"},
+			{"meson", "compile", "-C", "build"},
+		}
+		if !runBuildSteps(repoPath, steps) {
+			fmt.Println("meson build failed. You may need to build manually.")
+			return false, cmdDesc
+		}
+		fmt.Println("Build successful!")
+		return true, cmdDesc
+
+	case "autotools":
+		if !commandExists("make") {
+			fmt.Println("make is not installed or not on PATH.")
+			return false, "missing make"
+		}
+		var steps [][]string
+		if _, err := os.Stat(filepath.Join(repoPath, "configure")); err != nil {
+			if !commandExists("autoreconf") {
+				fmt.Println("No configure script and autoreconf is not on PATH.")
+				return false, "missing autoreconf"
+			}
+			steps = append(steps, []string{"autoreconf", "-fi"})
+		}
+		steps = append(steps, []string{"sh", "./configure"}, []string{"make"})
+		cmdDesc = describeSteps(steps)
+		if !runBuildSteps(repoPath, steps) {
+			fmt.Println("Build failed. You may need to build manually.")
+			return false, cmdDesc
+		}
+		fmt.Println("Build successful!")
+		return true, cmdDesc
+
+	case "zig":
+		if !commandExists("zig") {
+			fmt.Println("Zig is not installed or not on PATH.")
+			return false, "missing zig"
+		}
+		steps := [][]string{{"zig", "build", "-Doptimize=ReleaseSafe"}}
+		cmdDesc = describeSteps(steps)
+		if !runBuildSteps(repoPath, steps) {
+			fmt.Println("zig build failed. You may need to build manually.")
+			return false, cmdDesc
+		}
+		fmt.Println("Build successful!")
+		return true, cmdDesc
+
+	case "stack":
+		if !commandExists("stack") {
+			fmt.Println("Haskell (stack) is not installed or not on PATH.")
+			return false, "missing stack"
+		}
+		binDir := packageBinDir(filepath.Base(repoPath))
+		os.MkdirAll(binDir, 0755)
+		steps := [][]string{{"stack", "install", "--local-bin-path", binDir}}
+		cmdDesc = describeSteps(steps)
+		if !runBuildSteps(repoPath, steps) {
+			fmt.Println("stack install failed. You may need to build manually.")
+			return false, cmdDesc
+		}
+		fmt.Println("Build successful!")
+		return true, cmdDesc
+
+	case "mix":
+		if !commandExists("mix") {
+			fmt.Println("Elixir (mix) is not installed or not on PATH.")
+			return false, "missing mix"
+		}
+		steps := [][]string{{"mix", "deps.get"}, {"mix", "escript.build"}}
+		cmdDesc = describeSteps(steps)
+		if !runBuildSteps(repoPath, steps) {
+			fmt.Println("mix build failed. You may need to build manually.")
+			return false, cmdDesc
+		}
+		fmt.Println("Build successful!")
+		return true, cmdDesc
+
+	case "deno":
+		if !commandExists("deno") {
+			fmt.Println("Deno is not installed or not on PATH.")
+			return false, "missing deno"
+		}
+		steps := [][]string{{"deno", "install"}}
+		cmdDesc = describeSteps(steps)
+		if !runBuildSteps(repoPath, steps) {
+			fmt.Println("deno install failed. You may need to install manually.")
+			return false, cmdDesc
+		}
+		fmt.Println("Dependencies installed!")
+		fmt.Println("Note: This is a Deno project. Check deno.json for tasks.")
+		return true, cmdDesc
+
+	case "composer":
+		if !commandExists("composer") {
+			fmt.Println("PHP (composer) is not installed or not on PATH.")
+			return false, "missing composer"
+		}
+		steps := [][]string{{"composer", "install", "--no-dev"}}
+		cmdDesc = describeSteps(steps)
+		if !runBuildSteps(repoPath, steps) {
+			fmt.Println("composer install failed. You may need to install manually.")
+			return false, cmdDesc
+		}
+		fmt.Println("Dependencies installed!")
+		return true, cmdDesc
+
+	case "dotnet":
+		if !commandExists("dotnet") {
+			fmt.Println(".NET SDK (dotnet) is not installed or not on PATH.")
+			return false, "missing dotnet"
+		}
+		binDir := packageBinDir(filepath.Base(repoPath))
+		staged, err := stageBinDir(binDir)
+		if err != nil {
+			fmt.Println("Failed to create bin directory:", err)
+			return false, "mkdir " + binDir
+		}
+		defer os.RemoveAll(staged)
+		steps := [][]string{{"dotnet", "publish", "-c", "Release", "-o", staged}}
+		cmdDesc = describeSteps(steps)
+		if !runBuildSteps(repoPath, steps) {
+			fmt.Println("dotnet publish failed. You may need to build manually.")
+			return false, cmdDesc
+		}
+		if err := replaceBinDir(binDir, staged); err != nil {
+			fmt.Println("Failed to install the binaries:", err)
+			return false, cmdDesc
+		}
+		fmt.Println("Build successful!")
+		return true, cmdDesc
+
+	case "dune":
+		if !commandExists("dune") {
+			fmt.Println("OCaml (dune) is not installed or not on PATH.")
+			return false, "missing dune"
+		}
+		steps := [][]string{{"dune", "build", "@install"}}
+		cmdDesc = describeSteps(steps)
+		if !runBuildSteps(repoPath, steps) {
+			fmt.Println("dune build failed. You may need to build manually.")
+			return false, cmdDesc
+		}
+		fmt.Println("Build successful!")
+		return true, cmdDesc
+
+	case "just":
+		if !commandExists("just") {
+			fmt.Println("just is not installed or not on PATH.")
+			return false, "missing just"
+		}
+		steps := [][]string{{"just"}}
+		cmdDesc = describeSteps(steps)
+		if !runBuildSteps(repoPath, steps) {
+			fmt.Println("just failed. You may need to build manually.")
+			return false, cmdDesc
+		}
+		fmt.Println("Build successful!")
+		return true, cmdDesc
+
+	default:
+		fmt.Println("Unsupported language for auto-build")
+		return false, "unsupported language"
+	}
+}
+
+// runBuildSteps runs each command in order inside dir, stopping at the first
+// failure.
+func runBuildSteps(dir string, steps [][]string) bool {
+	for _, step := range steps {
+		fmt.Println("Running", strings.Join(step, " "), "...")
+		cmd := exec.Command(step[0], step[1:]...)
+		cmd.Dir = dir
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := runLogged(cmd); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+func describeSteps(steps [][]string) string {
+	var parts []string
+	for _, step := range steps {
+		parts = append(parts, strings.Join(step, " "))
+	}
+	return strings.Join(parts, " && ")
+}
+
+// installRepo clones, builds and links owner/repo after installing its
+// dependencies. A package that is already installed is left in place, only
+// marked as explicitly installed when it was a dependency before.
+func installRepo(repo string, opts installOptions) error {
+	if !strings.Contains(repo, "/") {
+		return usageError("invalid repo format %q: use owner/repo", repo)
+	}
 
 	repoName := strings.Split(repo, "/")[1]
+	lock, err := lockPackageCleanly(repoName)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
 	dest := filepath.Join(packagesDir, repoName)
-	if _, err := os.Stat(dest); err == nil {
+	if _, err := os.Lstat(dest); err == nil {
+		// Packages are named after the repository alone, so owner/tool
+		// and someone/tool cannot both be installed.
+		if m, err := loadManifest(repoName); err == nil && !strings.EqualFold(m.Repo, repo) {
+			return verifyError("cannot install %s: the package name %s is taken by %s", repo, repoName, m.Repo)
+		}
 		fmt.Println("Already installed:", repoName)
-		return
+		if m, err := loadManifest(repoName); err == nil && m.AsDependency && !opts.AsDependency {
+			m.AsDependency = false
+			saveManifest(m)
+			fmt.Println("Marked", repoName, "as explicitly installed")
+		}
+		return nil
+	}
+
+	var bundled Manifest
+	if opts.Bundle != nil {
+		var ok bool
+		if bundled, ok = opts.Bundle.manifest(repo); !ok {
+			return notFoundError("%s is not in the bundle", repo)
+		}
+		if opts.Recipe == nil {
+			opts.Recipe = bundled.Recipe
+		}
+		if opts.BuildSystem == "" {
+			opts.BuildSystem = bundled.BuildSystemOverride
+		}
 	}
 
 	url := "https://github.com/" + repo + ".git"
-	fmt.Println("Cloning", url, "to", dest)
+	var health *repoHealth
+	if opts.Source != "" {
+		url = "file://" + filepath.ToSlash(opts.Source)
+	} else if opts.Bundle != nil {
+		// The health report recorded when the bundle was made stands in
+		// for a fresh one, so the refuse_* settings still apply.
+		if health, err = vetHealth(repo, bundled.Health, errors.New("the bundle has no health report"), opts); err != nil {
+			return err
+		}
+	} else {
+		if health, err = checkHealth(repo, opts); err != nil {
+			return err
+		}
+		if err := preflight(repo, url, opts); err != nil {
+			return err
+		}
+	}
 
-	cmd := exec.Command("git", "clone", url, dest)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	if err := cmd.Run(); err != nil {
-		fmt.Println("Git clone failed:", err)
-		return
+	if opts.Source != "" {
+		if err := placeLocal(opts.Source, dest, opts.Link); err != nil {
+			os.RemoveAll(dest)
+			return fmt.Errorf("failed to install %s: %v", opts.Source, err)
+		}
+	} else if opts.Bundle != nil {
+		fmt.Println("Unpacking", repo, "from the bundle to", dest)
+		if err := opts.Bundle.checkout(bundled, url, dest); err != nil {
+			os.RemoveAll(dest)
+			return fmt.Errorf("failed to unpack %s: %v", repo, err)
+		}
+	} else {
+		fmt.Println("Cloning", url, "to", dest)
+		if err := cloneRepo(url, dest, opts.Full, cachedMirror(url, health)); err != nil {
+			// A clone from the cache can fail after git clone itself
+			// succeeded; a directory left behind would look installed.
+			os.RemoveAll(dest)
+			return networkError("git clone of %s failed: %v", url, err)
+		}
+	}
+	// A bundled repository is already at the revision that satisfied the
+	// constraint where the bundle was made.
+	if opts.Bundle == nil {
+		if err := checkoutConstraint(dest, opts.Constraint); err != nil {
+			os.RemoveAll(dest)
+			return verifyError("cannot satisfy %s@%s: %v", repo, opts.Constraint, err)
+		}
+	}
+	license, licenseFiles := detectLicense(dest, health)
+	if err := checkLicensePolicy(repo, license, opts); err != nil {
+		os.RemoveAll(dest)
+		return err
+	}
+
+	recipe, recipeSource := resolveRecipe(repo, dest, opts.Recipe)
+	var depends []string
+	if recipe != nil && len(recipe.Depends) > 0 {
+		depends = recipe.Depends
+		fmt.Println("Depends on:", strings.Join(depends, ", "))
+		if err := installDependencies(repo, depends, opts); err != nil {
+			os.RemoveAll(dest)
+			return fmt.Errorf("aborting install of %s: %w", repo, err)
+		}
 	}
 
-	language := detectLanguage(dest)
-	built, buildCmd := autoBuildRepo(dest, language)
+	det := resolveDetection(dest, opts.BuildSystem)
+	res := buildPackage(dest, repoName, det, recipe, opts.NoBuild)
 
 	manifest := Manifest{
-		Name:        repoName,
-		Repo:        repo,
-		URL:         url,
-		InstalledAt: time.Now(),
-		Language:    language,
-		Built:       built,
-		BuildCmd:    buildCmd,
+		Name:                repoName,
+		Repo:                repo,
+		URL:                 url,
+		InstalledAt:         time.Now(),
+		Language:            det.Language,
+		Built:               res.Built,
+		BuildCmd:            res.BuildCmd,
+		BuildSystem:         det.BuildSystem,
+		BuildSystemOverride: opts.BuildSystem,
+		Recipe:              opts.Recipe,
+		RecipeSource:        recipeSource,
+		Binaries:            res.Binaries,
+		Links:               res.Links,
+		Depends:             depends,
+		AsDependency:        opts.AsDependency,
+		Health:              health,
+		License:             license,
+		LicenseFiles:        licenseFiles,
+		Source:              opts.Source,
+		Linked:              opts.Link,
 	}
+	recordRevision(&manifest, dest)
 	saveManifest(manifest)
-
-	linkBinaries(dest, repoName, language)
+	cacheRevision(manifest, health)
 
 	fmt.Println("Installed", repoName)
-	if !built && language != "Unknown" {
+	if err := res.err(det, recipe); err != nil {
 		fmt.Println("Package cloned but not built. Check", dest, "for manual build instructions.")
+		return err
 	}
+	return nil
 }
 
-func linkBinaries(repoPath, repoName, language string) {
-
-	binDir := filepath.Join(os.Getenv("HOME"), ".local", "bin")
-	os.MkdirAll(binDir, 0755)
-	warnIfPathMissing(binDir)
-
+// linkBinaries symlinks the package's executables into ~/.local/bin and
+// returns the paths that were linked.
+func linkBinaries(repoPath, repoName, language string) []string {
 	var binaries []string
 	isExecutable := func(path string) bool {
 		info, err := os.Stat(path)
@@ -659,18 +1388,27 @@ func linkBinaries(repoPath, repoName, language string) {
 	switch language {
 	case "Go":
 
-		gobin := os.Getenv("GOBIN")
-		if gobin == "" {
-			gobin = filepath.Join(os.Getenv("HOME"), "go", "bin")
+		entries, _ := os.ReadDir(packageBinDir(repoName))
+		for _, e := range entries {
+			if !e.IsDir() {
+				binaries = append(binaries, filepath.Join(packageBinDir(repoName), e.Name()))
+			}
 		}
-		binPath := filepath.Join(gobin, repoName)
-		if _, err := os.Stat(binPath); err == nil {
-			binaries = append(binaries, binPath)
-		} else {
 
-			binPath = filepath.Join(repoPath, repoName)
+		if len(binaries) == 0 {
+			gobin := os.Getenv("GOBIN")
+			if gobin == "" {
+				gobin = filepath.Join(os.Getenv("HOME"), "go", "bin")
+			}
+			binPath := filepath.Join(gobin, repoName)
 			if _, err := os.Stat(binPath); err == nil {
 				binaries = append(binaries, binPath)
+			} else {
+
+				binPath = filepath.Join(repoPath, repoName)
+				if _, err := os.Stat(binPath); err == nil {
+					binaries = append(binaries, binPath)
+				}
 			}
 		}
 
@@ -790,7 +1528,47 @@ func linkBinaries(repoPath, repoName, language string) {
 			}
 		}
 
-	case "C/C++":
+	case "Zig":
+
+		dir := filepath.Join(repoPath, "zig-out", "bin")
+		entries, _ := os.ReadDir(dir)
+		for _, e := range entries {
+			if full := filepath.Join(dir, e.Name()); isExecutable(full) {
+				binaries = append(binaries, full)
+			}
+		}
+
+	case "Haskell", "C#":
+
+		dir := packageBinDir(repoName)
+		entries, _ := os.ReadDir(dir)
+		for _, e := range entries {
+			if full := filepath.Join(dir, e.Name()); isExecutable(full) {
+				binaries = append(binaries, full)
+			}
+		}
+
+	case "OCaml":
+
+		dir := filepath.Join(repoPath, "_build", "install", "default", "bin")
+		entries, _ := os.ReadDir(dir)
+		for _, e := range entries {
+			if full := filepath.Join(dir, e.Name()); isExecutable(full) {
+				binaries = append(binaries, full)
+			}
+		}
+
+	case "PHP":
+
+		for _, rel := range composerBinPaths(repoPath) {
+			full := filepath.Join(repoPath, rel)
+			if _, err := os.Stat(full); err == nil {
+				os.Chmod(full, 0755)
+				binaries = append(binaries, full)
+			}
+		}
+
+	case "C/C++", "Elixir", "Deno", "Just":
 
 		candidates := []string{
 			filepath.Join(repoPath, repoName),
@@ -825,6 +1603,17 @@ func linkBinaries(repoPath, repoName, language string) {
 		}
 	}
 
+	return linkFiles(binaries, repoName)
+}
+
+// linkFiles symlinks each file into ~/.local/bin under its base name and
+// returns the ones that were linked.
+func linkFiles(binaries []string, repoName string) []string {
+	binDir := filepath.Join(os.Getenv("HOME"), ".local", "bin")
+	os.MkdirAll(binDir, 0755)
+	warnIfPathMissing(binDir)
+
+	var linked []string
 	for _, b := range binaries {
 		linkPath := filepath.Join(binDir, filepath.Base(b))
 
@@ -835,45 +1624,118 @@ func linkBinaries(repoPath, repoName, language string) {
 			continue
 		}
 		fmt.Println("Linked", filepath.Base(b), "to", binDir)
+		linked = append(linked, b)
 	}
 
 	if len(binaries) == 0 {
 		fmt.Println("No binaries found to link for", repoName)
 	}
+	return linked
 }
 
-func removeRepo(name string) {
+// unlinkBinaries removes the ~/.local/bin symlinks recorded in a manifest,
+// leaving alone any link that has since been repointed elsewhere, along
+// with the package's man page and completion links.
+func unlinkBinaries(m Manifest) {
+	binDir := filepath.Join(os.Getenv("HOME"), ".local", "bin")
+	for _, b := range m.Binaries {
+		linkPath := filepath.Join(binDir, filepath.Base(b))
+		if target, err := os.Readlink(linkPath); err == nil && target == b {
+			os.Remove(linkPath)
+		}
+	}
+	for _, link := range m.Links {
+		if info, err := os.Lstat(link); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			os.Remove(link)
+		}
+	}
+}
+
+// removeRepo removes a package. Packages that others depend on are only
+// removed with cascade, which removes the dependents as well.
+func removeRepo(name string, cascade bool) error {
+	pkgPath := filepath.Join(packagesDir, name)
+	if _, err := os.Lstat(pkgPath); os.IsNotExist(err) {
+		return notFoundError("repo not installed: %s", name)
+	}
+
+	if m, err := loadManifest(name); err == nil {
+		if deps := dependents(m); len(deps) > 0 {
+			if !cascade {
+				var names []string
+				for _, d := range deps {
+					names = append(names, d.Name)
+				}
+				return usageError("%s is required by %s; use --cascade to remove them as well", name, strings.Join(names, ", "))
+			}
+			if err := removeDependents(m, map[string]bool{name: true}); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := removePackage(name); err != nil {
+		return err
+	}
+	if orphans := orphanedPackages(); len(orphans) > 0 {
+		fmt.Println(len(orphans), "dependency package(s) are no longer needed. Run 'ghpm autoremove' to remove them.")
+	}
+	return nil
+}
+
+// removePackage deletes a package's files, links and manifest.
+func removePackage(name string) error {
+	lock, err := lockPackageCleanly(name)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
 	manifestPath := filepath.Join(manifestsDir, name+".json")
 	pkgPath := filepath.Join(packagesDir, name)
 
-	if _, err := os.Stat(pkgPath); os.IsNotExist(err) {
-		fmt.Println("Repo not installed:", name)
-		return
+	if m, err := loadManifest(name); err == nil {
+		unlinkBinaries(m)
 	}
 
 	os.RemoveAll(pkgPath)
+	os.RemoveAll(packageBinDir(name))
+	os.RemoveAll(logsDir(name))
 	os.Remove(manifestPath)
 	fmt.Println("Removed", name)
+	return nil
 }
 
-func listRepos() {
-	files, err := os.ReadDir(manifestsDir)
-	if err != nil {
-		fmt.Println("Failed to read manifests:", err)
-		return
+// listRepos prints installed packages. explicitOnly and depsOnly restrict the
+// list to packages installed on request or pulled in as dependencies.
+func listRepos(explicitOnly, depsOnly bool, out outputMode) error {
+	if _, err := os.Stat(manifestsDir); err != nil {
+		return fmt.Errorf("failed to read manifests: %v", err)
+	}
+
+	var manifests []Manifest
+	for _, m := range loadAllManifests() {
+		if (explicitOnly && m.AsDependency) || (depsOnly && !m.AsDependency) {
+			continue
+		}
+		manifests = append(manifests, m)
 	}
 
-	if len(files) == 0 {
+	if out.machine() {
+		records := []packageRecord{}
+		for _, m := range manifests {
+			records = append(records, newPackageRecord(m))
+		}
+		return out.write(records)
+	}
+
+	if len(manifests) == 0 {
 		fmt.Println("No installed packages.")
-		return
+		return nil
 	}
 
 	fmt.Println("Installed packages:")
-	for _, f := range files {
-		var m Manifest
-		data, _ := os.ReadFile(filepath.Join(manifestsDir, f.Name()))
-		json.Unmarshal(data, &m)
-
+	for _, m := range manifests {
 		extra := ""
 		if m.Language != "" && m.Language != "Unknown" {
 			extra = fmt.Sprintf(" [%s]", m.Language)
@@ -883,87 +1745,296 @@ func listRepos() {
 				extra += " ✗"
 			}
 		}
+		if m.AsDependency {
+			extra += " (dependency)"
+		}
 		fmt.Printf("- %s (%s)%s\n", m.Name, m.Repo, extra)
 	}
+	return nil
 }
 
-func updateRepo(name string) {
-	manifestPath := filepath.Join(manifestsDir, name+".json")
+func updateRepo(name string) error {
+	lock, err := lockPackageCleanly(name)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
 	pkgPath := filepath.Join(packagesDir, name)
+	if _, err := os.Lstat(pkgPath); os.IsNotExist(err) {
+		return notFoundError("package not installed: %s", name)
+	}
+	m, err := loadManifest(name)
+	if err != nil {
+		return fmt.Errorf("failed to read manifest: %v", err)
+	}
 
-	if _, err := os.Stat(pkgPath); os.IsNotExist(err) {
-		fmt.Println("Package not installed:", name)
-		return
+	fmt.Println("Updating", name, "...")
+
+	// A local package is rebuilt from the current state of its directory.
+	if m.Source != "" {
+		if err := refreshLocal(m, pkgPath); err != nil {
+			return err
+		}
+		m.License, m.LicenseFiles = detectLicense(pkgPath, nil)
+		err = rebuildPackage(&m, pkgPath)
+		if err == nil || exitCode(err) == exitBuild {
+			fmt.Println("Updated", name, "from", m.Source)
+		}
+		return err
 	}
 
-	var m Manifest
-	data, err := os.ReadFile(manifestPath)
-	if err != nil {
-		fmt.Println("Failed to read manifest:", err)
-		return
+	// A shallow clone fetches only the new tip and moves the branch to it,
+	// which also works when upstream rewrote its history.
+	steps := [][]string{{"pull"}}
+	if isShallow(pkgPath) {
+		steps = [][]string{{"fetch", "--depth", "1"}, {"reset", "--keep", "@{u}"}}
 	}
-	if err := json.Unmarshal(data, &m); err != nil {
-		fmt.Println("Failed to parse manifest:", err)
-		return
+	for _, args := range steps {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = pkgPath
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return networkError("git %s failed: %v", args[0], err)
+		}
 	}
+	if h, err := fetchRepoHealth(m.Repo); err == nil {
+		known := m.Health.warnings()
+		for _, w := range h.warnings() {
+			if !contains(known, w) {
+				fmt.Printf("⚠ %s: %s\n", m.Repo, w)
+			}
+		}
+		m.Health = h
+	}
+	m.License, m.LicenseFiles = detectLicense(pkgPath, m.Health)
 
-	fmt.Println("Updating", name, "...")
+	if head, _ := gitOutput(pkgPath, "rev-parse", "HEAD"); head != m.Commit {
+		m.PreviousCommit = m.Commit
+	}
+	err = rebuildPackage(&m, pkgPath)
+	if err == nil || exitCode(err) == exitBuild {
+		fmt.Println("Updated", name)
+	}
+	return err
+}
 
-	cmd := exec.Command("git", "pull")
+// rebuildPackage redetects and rebuilds a package after its checkout
+// moved, then records the new revision and saves m. When dependencies are
+// not satisfied nothing is rebuilt or saved.
+func rebuildPackage(m *Manifest, pkgPath string) error {
+	name := m.Name
+	det := resolveDetection(pkgPath, m.BuildSystemOverride)
+	m.Language = det.Language
+	m.BuildSystem = det.BuildSystem
+	recipe, recipeSource := resolveRecipe(m.Repo, pkgPath, m.Recipe)
+	m.RecipeSource = recipeSource
+	m.Depends = nil
+	if recipe != nil && len(recipe.Depends) > 0 {
+		m.Depends = recipe.Depends
+		if err := installDependencies(m.Repo, m.Depends, installOptions{}); err != nil {
+			return fmt.Errorf("dependencies of %s are not satisfied; not rebuilding: %w", name, err)
+		}
+	}
+	// A local package is rebuilt even if its last build failed, since the
+	// tree may have been fixed since, and so is one whose build system was
+	// set with "ghpm edit", usually because the guessed one failed.
+	var buildErr error
+	if ((m.Built || m.Source != "" || m.BuildSystemOverride != "") && det.BuildSystem != "") || recipe != nil {
+		fmt.Println("Rebuilding...")
+		res := buildPackage(pkgPath, name, det, recipe, false)
+		buildErr = res.err(det, recipe)
+		m.Built = res.Built
+		m.BuildCmd = res.BuildCmd
+		if res.Built {
+			m.Binaries = res.Binaries
+			m.Links = res.Links
+		}
+	}
+
+	m.InstalledAt = time.Now()
+	recordRevision(m, pkgPath)
+	saveManifest(*m)
+	cacheRevision(*m, m.Health)
+	return buildErr
+}
+
+// rollbackRepo checks out an earlier revision of a package, by default the
+// one before the last update, and rebuilds it. A shallow clone fetches the
+// revision, or its whole history, first.
+func rollbackRepo(name, ref string) error {
+	lock, err := lockPackageCleanly(name)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	pkgPath := filepath.Join(packagesDir, name)
+	m, err := loadManifest(name)
+	if err != nil {
+		return notFoundError("package not installed: %s", name)
+	}
+	if m.Source != "" {
+		return usageError("%s was installed from %s and has no earlier revisions; check one out there and run 'ghpm update %s'", name, m.Source, name)
+	}
+	if ref == "" {
+		if m.PreviousCommit == "" {
+			return usageError("no earlier revision of %s is recorded; name one: ghpm rollback %s <tag|commit>", name, name)
+		}
+		ref = m.PreviousCommit
+	}
+	if err := ensureRevision(pkgPath, ref); err != nil {
+		return networkError("could not fetch the history of %s: %v", name, err)
+	}
+	target, err := gitOutput(pkgPath, "rev-parse", "--verify", "--quiet", ref+"^{commit}")
+	if err != nil {
+		return notFoundError("revision %s not found in %s", ref, m.Repo)
+	}
+
+	fmt.Println("Rolling back", name, "to", ref, "...")
+	// On a branch the branch is moved, so a later update moves it forward
+	// again; a package pinned by a constraint stays detached.
+	args := []string{"reset", "--quiet", "--keep", target}
+	if _, err := gitOutput(pkgPath, "symbolic-ref", "--quiet", "HEAD"); err != nil {
+		args = []string{"checkout", "--quiet", "--detach", target}
+	}
+	cmd := exec.Command("git", args...)
 	cmd.Dir = pkgPath
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	if err := cmd.Run(); err != nil {
-		fmt.Println("Git pull failed:", err)
-		return
+		return fmt.Errorf("git %s failed: %v", args[0], err)
 	}
 
-	m.Language = detectLanguage(pkgPath)
-	if m.Built && m.Language != "Unknown" {
-		fmt.Println("Rebuilding...")
-		success, buildCmd := autoBuildRepo(pkgPath, m.Language)
-		m.Built = success
-		m.BuildCmd = buildCmd
+	m.PreviousCommit = m.Commit
+	err = rebuildPackage(&m, pkgPath)
+	if err == nil || exitCode(err) == exitBuild {
+		fmt.Println("Rolled back", name, "to", shortCommit(m.Commit))
 	}
-
-	m.InstalledAt = time.Now()
-	saveManifest(m)
-	fmt.Println("Updated", name)
+	return err
 }
 
-func showInfo(name string) {
+func showInfo(name string, out outputMode) error {
 	manifestPath := filepath.Join(manifestsDir, name+".json")
 
 	var m Manifest
 	data, err := os.ReadFile(manifestPath)
 	if err != nil {
-		fmt.Println("Package not found:", name)
-		return
+		return notFoundError("package not found: %s", name)
 	}
 	if err := json.Unmarshal(data, &m); err != nil {
-		fmt.Println("Failed to parse manifest:", err)
-		return
+		return fmt.Errorf("failed to parse manifest: %v", err)
+	}
+
+	if out.machine() {
+		return out.write(newPackageRecord(m))
 	}
 
 	fmt.Println("Package:", m.Name)
 	fmt.Println("Repository:", m.Repo)
 	fmt.Println("URL:", m.URL)
+	if m.Linked {
+		fmt.Println("Source:", m.Source, "(linked)")
+	} else if m.Source != "" {
+		fmt.Println("Source:", m.Source, "(copied)")
+	}
+	license, files := packageLicense(m)
+	if len(files) > 0 {
+		fmt.Printf("License: %s (%s)\n", displayLicense(license), strings.Join(files, ", "))
+	} else {
+		fmt.Println("License:", displayLicense(license))
+	}
+	printHealth(m.Health)
 	if m.Language != "" {
 		fmt.Println("Language:", m.Language)
 	}
+	if m.BuildSystem != "" {
+		if m.BuildSystemOverride != "" {
+			fmt.Println("Build System:", m.BuildSystem, "(override)")
+		} else {
+			fmt.Println("Build System:", m.BuildSystem)
+		}
+	}
 	fmt.Println("Built:", m.Built)
 	if m.BuildCmd != "" {
 		fmt.Println("Build Command:", m.BuildCmd)
 	}
+	if path := lastFailedLog(m.Name); path != "" {
+		fmt.Println("Last failed build:", path)
+	}
+	if m.RecipeSource != "" {
+		fmt.Println("Recipe:", m.RecipeSource)
+	}
+	if m.Recipe != nil {
+		for _, b := range m.Recipe.Build {
+			fmt.Println("Build Override:", b)
+		}
+		for _, b := range m.Recipe.Bin {
+			fmt.Println("Bin Override:", b)
+		}
+	}
+	if len(m.Binaries) > 0 {
+		fmt.Println("Binaries:")
+		for _, b := range m.Binaries {
+			fmt.Println("  -", b)
+		}
+	}
+	if len(m.Depends) > 0 {
+		fmt.Println("Depends:", strings.Join(m.Depends, ", "))
+	}
+	if deps := dependents(m); len(deps) > 0 {
+		var names []string
+		for _, d := range deps {
+			names = append(names, d.Name)
+		}
+		fmt.Println("Required by:", strings.Join(names, ", "))
+	}
+	if m.AsDependency {
+		fmt.Println("Installed as: dependency")
+	} else {
+		fmt.Println("Installed as: explicit")
+	}
+	if m.Version != "" {
+		fmt.Println("Version:", m.Version)
+	}
+	if m.Commit != "" {
+		fmt.Println("Commit:", m.Commit)
+	}
+	if m.PreviousCommit != "" {
+		fmt.Println("Previous Commit:", m.PreviousCommit)
+	}
 	fmt.Println("Installed:", m.InstalledAt.Format("2006-01-02 15:04:05"))
 
 	pkgPath := filepath.Join(packagesDir, name)
 	if _, err := os.Stat(pkgPath); err == nil {
 		fmt.Println("Location:", pkgPath)
+		usage := formatSize(diskUsage(pkgPath, packageBinDir(name)))
+		switch {
+		case !isGitRepo(pkgPath):
+			fmt.Println("Disk Usage:", usage)
+		case isShallow(pkgPath):
+			fmt.Printf("Disk Usage: %s (shallow history)\n", usage)
+		default:
+			fmt.Printf("Disk Usage: %s (full history)\n", usage)
+		}
 	}
+	return nil
+}
+
+func loadManifest(name string) (Manifest, error) {
+	var m Manifest
+	data, err := os.ReadFile(filepath.Join(manifestsDir, name+".json"))
+	if err != nil {
+		return m, err
+	}
+	err = json.Unmarshal(data, &m)
+	return m, err
 }
 
 func saveManifest(m Manifest) {
 	data, _ := json.MarshalIndent(m, "", "  ")
-	os.WriteFile(filepath.Join(manifestsDir, m.Name+".json"), data, 0644)
+	if err := writeFileAtomic(filepath.Join(manifestsDir, m.Name+".json"), data, 0644); err != nil {
+		fmt.Println("Failed to write manifest:", err)
+	}
 }
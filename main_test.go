@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// captureStdout returns what f prints to standard output, results included.
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, results := os.Stdout, resultOut
+	os.Stdout, resultOut = w, w
+	done := make(chan []byte)
+	go func() {
+		data, _ := io.ReadAll(r)
+		done <- data
+	}()
+	defer func() { os.Stdout, resultOut = stdout, results }()
+	f()
+	w.Close()
+	return string(<-done)
+}
+
+func TestFailedBuildKeepsBinaries(t *testing.T) {
+	if !commandExists("go") {
+		t.Skip("go is not installed")
+	}
+	if cache, err := os.UserCacheDir(); err == nil && os.Getenv("GOCACHE") == "" {
+		t.Setenv("GOCACHE", filepath.Join(cache, "go-build"))
+	}
+	testHome(t)
+	repoPath := filepath.Join(packagesDir, "tool")
+	write := func(name, data string) {
+		t.Helper()
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(repoPath, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(repoPath, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("go.mod", "module example.com/tool\n\ngo 1.21\n")
+	write("main.go", "package main\n\nfunc main() {}\n")
+	det := detection{BuildSystem: "go", Language: "Go"}
+
+	if ok, _ := autoBuildRepo(repoPath, det); !ok {
+		t.Fatal("first build failed")
+	}
+	bin := filepath.Join(packageBinDir("tool"), "tool")
+	before, err := os.ReadFile(bin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	write("main.go", "package main\n\nfunc main() { undefined() }\n")
+	if ok, _ := autoBuildRepo(repoPath, det); ok {
+		t.Fatal("broken build succeeded")
+	}
+	if after, err := os.ReadFile(bin); err != nil || string(after) != string(before) {
+		t.Errorf("a failed build replaced the binary: %v", err)
+	}
+	entries, _ := os.ReadDir(filepath.Dir(packageBinDir("tool")))
+	if len(entries) != 1 {
+		t.Errorf("left build directories behind: %v", entries)
+	}
+
+	write("main.go", "package main\n\nfunc main() { println() }\n")
+	write("extra/main.go", "package main\n\nfunc main() {}\n")
+	if ok, _ := autoBuildRepo(repoPath, det); !ok {
+		t.Fatal("rebuild failed")
+	}
+	for _, name := range []string{"tool", "extra"} {
+		if _, err := os.Stat(filepath.Join(packageBinDir("tool"), name)); err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+func TestListReposSkipsPartialWrites(t *testing.T) {
+	testHome(t)
+	saveManifest(Manifest{Name: "tool", Repo: "own/tool"})
+	// A write in progress, as left by writeFileAtomic.
+	if err := os.WriteFile(filepath.Join(manifestsDir, ".tool.json.tmp-123"), []byte(`{"name": "tool", "repo": "own/tool"}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	out := captureStdout(t, func() { err = listRepos(false, false, outputMode{JSON: true}) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []packageRecord
+	if err := json.Unmarshal([]byte(out), &records); err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 1 || records[0].Name != "tool" {
+		t.Errorf("listed %+v", records)
+	}
+}
+
+func TestListReposFilters(t *testing.T) {
+	testHome(t)
+	saveManifest(Manifest{Name: "tool", Repo: "own/tool"})
+	tests := []struct {
+		explicit, deps bool
+		want           string
+	}{
+		{false, false, "Installed packages:\n- tool (own/tool)\n"},
+		{true, false, "Installed packages:\n- tool (own/tool)\n"},
+		{false, true, "No installed packages.\n"},
+	}
+	for _, tt := range tests {
+		out := captureStdout(t, func() { listRepos(tt.explicit, tt.deps, outputMode{}) })
+		if out != tt.want {
+			t.Errorf("explicit %v, deps %v: printed %q, want %q", tt.explicit, tt.deps, out, tt.want)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+)
+
+// In offline mode (the global --offline flag, or "offline": true in the
+// config) nothing is fetched: HTTP requests and git transports other than
+// local files fail at once instead of waiting for a timeout, and the
+// language builds are told not to download dependencies. Commands that
+// need the network then fail with exit code 4, and checks that are only
+// advisory, such as the health check, are skipped.
+
+var offline bool
+
+// offlineTransport refuses every request.
+type offlineTransport struct{}
+
+func (offlineTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return nil, fmt.Errorf("offline: not connecting to %s", req.URL.Host)
+}
+
+// offlineEnv is set for every command ghpm runs, including the builds and
+// worker processes.
+var offlineEnv = map[string]string{
+	"GHPM_OFFLINE":       "1",
+	"GIT_ALLOW_PROTOCOL": "file",
+	"GOPROXY":            "off",
+	"GOTOOLCHAIN":        "local",
+	"CARGO_NET_OFFLINE":  "true",
+	"npm_config_offline": "true",
+	"PIP_NO_INDEX":       "1",
+}
+
+func setOffline() {
+	offline = true
+	for k, v := range offlineEnv {
+		os.Setenv(k, v)
+	}
+	http.DefaultTransport = offlineTransport{}
+	downloadClient.Transport = offlineTransport{}
+}
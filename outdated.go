@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// checkOutdated fetches the package's remote and compares the checked out
+// commit with the upstream branch. Packages pinned to a tag or commit are
+// compared with the remote's default branch.
+func checkOutdated(m Manifest) outdatedRecord {
+	rec := outdatedRecord{Name: m.Name, Repo: m.Repo, CurrentVersion: m.Version}
+	pkgPath := filepath.Join(packagesDir, m.Name)
+	if m.Source != "" {
+		// A local package has no upstream; update rebuilds it from its
+		// directory.
+		rec.CurrentCommit = m.Commit
+		return rec
+	}
+
+	// Fetching every tag into a shallow clone would fetch their history;
+	// only tags on the new commits come along.
+	args := []string{"fetch", "--quiet", "--tags"}
+	if isShallow(pkgPath) {
+		args = args[:2]
+	}
+	if _, err := gitOutput(pkgPath, args...); err != nil {
+		rec.Error = "git fetch failed: " + err.Error()
+		return rec
+	}
+	rec.CurrentCommit, _ = gitOutput(pkgPath, "rev-parse", "HEAD")
+
+	upstream := "@{u}"
+	latest, err := gitOutput(pkgPath, "rev-parse", upstream)
+	if err != nil {
+		upstream = "origin/HEAD"
+		if latest, err = gitOutput(pkgPath, "rev-parse", upstream); err != nil {
+			rec.Error = "no upstream branch to compare with"
+			return rec
+		}
+	}
+	rec.LatestCommit = latest
+	rec.LatestVersion, _ = gitOutput(pkgPath, "describe", "--tags", "--abbrev=0", upstream)
+
+	count, _ := gitOutput(pkgPath, "rev-list", "--count", "HEAD.."+upstream)
+	rec.Behind, _ = strconv.Atoi(count)
+	rec.Outdated = rec.Behind > 0
+	return rec
+}
+
+// outdatedCommand implements "ghpm outdated [name...]".
+func outdatedCommand(names []string, out outputMode) error {
+	var manifests []Manifest
+	if len(names) == 0 {
+		manifests = loadAllManifests()
+	} else {
+		for _, name := range names {
+			m, err := loadManifest(name)
+			if err != nil {
+				return notFoundError("package not found: %s", name)
+			}
+			manifests = append(manifests, m)
+		}
+	}
+
+	records := []outdatedRecord{}
+	var failed []string
+	for _, m := range manifests {
+		r := checkOutdated(m)
+		records = append(records, r)
+		if r.Error != "" {
+			failed = append(failed, r.Name)
+		}
+	}
+	var err error
+	if len(failed) > 0 {
+		err = networkError("could not check %s", strings.Join(failed, ", "))
+	}
+
+	if out.machine() {
+		if werr := out.write(records); werr != nil {
+			return werr
+		}
+		return err
+	}
+
+	found := false
+	for _, r := range records {
+		switch {
+		case r.Error != "":
+			fmt.Printf("%s: %s\n", r.Name, r.Error)
+		case r.Outdated:
+			found = true
+			current, latest := r.CurrentVersion, r.LatestVersion
+			if current == "" || current == latest {
+				current, latest = shortCommit(r.CurrentCommit), shortCommit(r.LatestCommit)
+			}
+			fmt.Printf("%s  %s -> %s  (%d commits behind)\n", r.Name, current, latest, r.Behind)
+		}
+	}
+	if !found && err == nil {
+		fmt.Println("All packages are up to date.")
+	}
+	return err
+}
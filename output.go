@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Read commands (list, info, search, outdated) print text for people by
+// default. --json prints the records below instead, and --format executes a
+// Go template once per record. Field names are part of the documented
+// schema: new fields may be added, existing ones are not renamed or removed.
+
+// outputMode says how a read command should print its result.
+type outputMode struct {
+	JSON   bool
+	Format *template.Template
+}
+
+// outputFlags defines --json and --format on fs. The returned function
+// gives the output mode once fs is parsed.
+func outputFlags(fs *flag.FlagSet) func() (outputMode, error) {
+	jsonOut := fs.Bool("json", false, "print the result as JSON")
+	format := fs.String("format", "", "print each record through a Go `template`")
+	return func() (outputMode, error) {
+		return newOutputMode(*jsonOut, *format)
+	}
+}
+
+func newOutputMode(jsonOut bool, text string) (outputMode, error) {
+	out := outputMode{JSON: jsonOut}
+	if text != "" {
+		tmpl, err := template.New("format").Funcs(template.FuncMap{
+			"json": func(v any) (string, error) {
+				data, err := json.Marshal(v)
+				return string(data), err
+			},
+			"join": func(items []string, sep string) string { return strings.Join(items, sep) },
+		}).Parse(text)
+		if err != nil {
+			return out, usageError("invalid --format template: %v", err)
+		}
+		out.Format = tmpl
+	}
+	if out.JSON && out.Format != nil {
+		return out, usageError("use either --json or --format, not both")
+	}
+	return out, nil
+}
+
+// machine reports whether text output for people should be skipped.
+func (o outputMode) machine() bool {
+	return o.JSON || o.Format != nil
+}
+
+// write prints v as JSON or through the template. A slice runs the
+// template once per element, each followed by a newline.
+func (o outputMode) write(v any) error {
+	if o.JSON {
+		enc := json.NewEncoder(resultOut)
+		enc.SetEscapeHTML(false)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	}
+
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice {
+		rv = reflect.ValueOf([]any{v})
+	}
+	for i := 0; i < rv.Len(); i++ {
+		if err := o.Format.Execute(resultOut, rv.Index(i).Interface()); err != nil {
+			return err
+		}
+		fmt.Fprintln(resultOut)
+	}
+	return nil
+}
+
+// packageRecord is the schema of an installed package in list and info.
+type packageRecord struct {
+	Name          string    `json:"name"`
+	Repo          string    `json:"repo"`
+	URL           string    `json:"url"`
+	Version       string    `json:"version"`
+	Commit        string    `json:"commit"`
+	Language      string    `json:"language"`
+	BuildSystem   string    `json:"build_system"`
+	Built         bool      `json:"built"`
+	BuildCmd      string    `json:"build_cmd"`
+	RecipeSource  string    `json:"recipe_source"`
+	Binaries      []string  `json:"binaries"`
+	Depends       []string  `json:"depends"`
+	RequiredBy    []string  `json:"required_by"`
+	AsDependency  bool      `json:"as_dependency"`
+	InstalledAt   time.Time `json:"installed_at"`
+	Location      string    `json:"location"`
+	LastFailedLog string    `json:"last_failed_log"`
+	Stars         int       `json:"stars"`
+	Warnings      []string  `json:"warnings"`
+	License       string    `json:"license"`
+	LicenseFiles  []string  `json:"license_files"`
+	Shallow       bool      `json:"shallow"`
+	SizeBytes     int64     `json:"size_bytes"`
+	Source        string    `json:"source"`
+	Linked        bool      `json:"linked"`
+}
+
+func newPackageRecord(m Manifest) packageRecord {
+	r := packageRecord{
+		Name:          m.Name,
+		Repo:          m.Repo,
+		URL:           m.URL,
+		Version:       m.Version,
+		Commit:        m.Commit,
+		Language:      m.Language,
+		BuildSystem:   m.BuildSystem,
+		Built:         m.Built,
+		BuildCmd:      m.BuildCmd,
+		RecipeSource:  m.RecipeSource,
+		Binaries:      nonNil(m.Binaries),
+		Depends:       nonNil(m.Depends),
+		RequiredBy:    []string{},
+		AsDependency:  m.AsDependency,
+		InstalledAt:   m.InstalledAt,
+		LastFailedLog: lastFailedLog(m.Name),
+		Warnings:      nonNil(m.Health.warnings()),
+		Source:        m.Source,
+		Linked:        m.Linked,
+	}
+	license, files := packageLicense(m)
+	r.License, r.LicenseFiles = license, nonNil(files)
+	if m.Health != nil {
+		r.Stars = m.Health.Stars
+	}
+	for _, d := range dependents(m) {
+		r.RequiredBy = append(r.RequiredBy, d.Name)
+	}
+	pkgPath := filepath.Join(packagesDir, m.Name)
+	if _, err := os.Stat(pkgPath); err == nil {
+		r.Location = pkgPath
+		r.Shallow = isShallow(pkgPath)
+		r.SizeBytes = diskUsage(pkgPath, packageBinDir(m.Name))
+	}
+	return r
+}
+
+// nonNil keeps empty lists as [] rather than null in JSON.
+func nonNil(items []string) []string {
+	if items == nil {
+		return []string{}
+	}
+	return items
+}
+
+// searchRecord is the schema of a search result.
+type searchRecord struct {
+	FullName    string    `json:"full_name"`
+	Description string    `json:"description"`
+	Stars       int       `json:"stars"`
+	Language    string    `json:"language"`
+	URL         string    `json:"url"`
+	PushedAt    time.Time `json:"pushed_at"`
+	Archived    bool      `json:"archived"`
+	License     string    `json:"license"`
+}
+
+func newSearchRecord(r ghRepoItem) searchRecord {
+	rec := searchRecord{
+		FullName:    r.FullName,
+		Description: r.Description,
+		Stars:       r.StargazersCount,
+		URL:         r.HTMLURL,
+		PushedAt:    r.PushedAt,
+		Archived:    r.Archived,
+	}
+	if r.Language != nil {
+		rec.Language = *r.Language
+	}
+	if r.License != nil {
+		rec.License = r.License.SPDXID
+	}
+	return rec
+}
+
+// licenseRecord is the schema of a package in "ghpm licenses".
+type licenseRecord struct {
+	Name      string   `json:"name"`
+	Repo      string   `json:"repo"`
+	Version   string   `json:"version"`
+	License   string   `json:"license"`
+	Files     []string `json:"files"`
+	Violation string   `json:"violation"`
+}
+
+// outdatedRecord is the schema of a package in "ghpm outdated".
+type outdatedRecord struct {
+	Name           string `json:"name"`
+	Repo           string `json:"repo"`
+	CurrentCommit  string `json:"current_commit"`
+	LatestCommit   string `json:"latest_commit"`
+	CurrentVersion string `json:"current_version"`
+	LatestVersion  string `json:"latest_version"`
+	Behind         int    `json:"behind"`
+	Outdated       bool   `json:"outdated"`
+	Error          string `json:"error"`
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+)
+
+// Installs and updates of several packages run as separate ghpm processes,
+// one per package, so each keeps its own working directory, environment
+// and output. GHPM_WORKER marks those child processes.
+
+// jobsFlag defines -j N / --jobs N on fs. Without it packages are handled
+// one at a time.
+func jobsFlag(fs *flag.FlagSet) func() (int, error) {
+	jobs := fs.Int("j", 1, "handle up to `n` packages at a time")
+	fs.IntVar(jobs, "jobs", 1, "same as -j")
+	return func() (int, error) {
+		if *jobs < 1 {
+			return 0, usageError("-j wants a positive number, got %d", *jobs)
+		}
+		return *jobs, nil
+	}
+}
+
+func isWorker() bool {
+	return os.Getenv("GHPM_WORKER") != ""
+}
+
+// prefixWriter writes complete lines to the shared output, each starting
+// with prefix, so concurrent workers do not interleave mid-line.
+type prefixWriter struct {
+	mu     *sync.Mutex
+	prefix string
+	buf    []byte
+}
+
+func (w *prefixWriter) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	for {
+		i := bytes.IndexByte(w.buf, '\n')
+		if i < 0 {
+			break
+		}
+		w.emit(w.buf[:i])
+		w.buf = w.buf[i+1:]
+	}
+	return len(p), nil
+}
+
+func (w *prefixWriter) emit(line []byte) {
+	line = bytes.TrimRight(line, "\r")
+	if i := bytes.LastIndexByte(line, '\r'); i >= 0 {
+		// Keep only the final state of progress lines.
+		line = line[i+1:]
+	}
+	w.mu.Lock()
+	fmt.Fprintf(os.Stdout, "%s %s\n", w.prefix, line)
+	w.mu.Unlock()
+}
+
+func (w *prefixWriter) flush() {
+	if len(w.buf) > 0 {
+		w.emit(w.buf)
+		w.buf = nil
+	}
+}
+
+type jobResult struct {
+	Target  string
+	Code    int
+	Elapsed time.Duration
+}
+
+// runJobs runs "ghpm <args(target)...>" for every target, at most jobs at a
+// time, and returns the results in target order.
+func runJobs(targets []string, jobs int, args func(target string) []string) []jobResult {
+	exe, err := os.Executable()
+	if err != nil {
+		exe = os.Args[0]
+	}
+
+	width := 0
+	for _, t := range targets {
+		if len(t) > width {
+			width = len(t)
+		}
+	}
+
+	var mu sync.Mutex
+	results := make([]jobResult, len(targets))
+	sem := make(chan struct{}, jobs)
+	var wg sync.WaitGroup
+	for i, target := range targets {
+		wg.Add(1)
+		go func(i int, target string) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			out := &prefixWriter{mu: &mu, prefix: fmt.Sprintf("[%-*s]", width, target)}
+			cmd := exec.Command(exe, args(target)...)
+			cmd.Env = append(os.Environ(), "GHPM_WORKER=1")
+			cmd.Stdout = out
+			cmd.Stderr = out
+			start := time.Now()
+			err := cmd.Run()
+			out.flush()
+
+			res := jobResult{Target: target, Elapsed: time.Since(start)}
+			if exitErr, ok := err.(*exec.ExitError); ok {
+				res.Code = exitErr.ExitCode()
+			} else if err != nil {
+				out.emit([]byte(err.Error()))
+				res.Code = 1
+			}
+			results[i] = res
+		}(i, target)
+	}
+	wg.Wait()
+	return results
+}
+
+// printJobResults prints the per-package summary and returns an error naming
+// the failed packages. When they all failed the same way, the error carries
+// their exit code.
+func printJobResults(results []jobResult) error {
+	fmt.Println()
+	tw := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "PACKAGE\tRESULT\tTIME")
+	var failed []string
+	code := exitOK
+	for _, r := range results {
+		status := "ok"
+		if r.Code != 0 {
+			status = "failed"
+			failed = append(failed, r.Target)
+			if code == exitOK || code == r.Code {
+				code = r.Code
+			} else {
+				code = exitFailure
+			}
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\n", r.Target, status, r.Elapsed.Round(time.Second))
+	}
+	tw.Flush()
+	if len(failed) > 0 {
+		return withCode(code, "%d of %d failed: %s", len(failed), len(results), strings.Join(failed, ", "))
+	}
+	return nil
+}
+
+// installMany installs several owner/repo targets, jobs at a time, passing
+// flags on to each install.
+func installMany(targets []string, jobs int, flags []string) error {
+	for _, t := range targets {
+		if !strings.Contains(t, "/") && !isLocalPath(t) {
+			return usageError("installing several packages needs owner/repo for each; search for %s on its own first", t)
+		}
+	}
+	results := runJobs(targets, jobs, func(target string) []string {
+		return append([]string{"install", target}, flags...)
+	})
+	return printJobResults(results)
+}
+
+// updateMany updates the named packages, jobs at a time.
+func updateMany(names []string, jobs int) error {
+	results := runJobs(names, jobs, func(name string) []string {
+		return []string{"update", name}
+	})
+	return printJobResults(results)
+}
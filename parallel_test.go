@@ -0,0 +1,79 @@
+package main
+
+import (
+	"flag"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestPrefixWriter(t *testing.T) {
+	out := captureStdout(t, func() {
+		w := &prefixWriter{mu: &sync.Mutex{}, prefix: "[a/b]"}
+		w.Write([]byte("Cloning into 'b'...\nReceiving objects:  50%\rReceiving objects: 100%\r\n"))
+		w.Write([]byte("Build "))
+		w.Write([]byte("successful!\nno newline"))
+		w.flush()
+	})
+	want := "[a/b] Cloning into 'b'...\n[a/b] Receiving objects: 100%\n[a/b] Build successful!\n[a/b] no newline\n"
+	if out != want {
+		t.Errorf("printed %q, want %q", out, want)
+	}
+}
+
+func TestPrintJobResults(t *testing.T) {
+	tests := []struct {
+		name    string
+		results []jobResult
+		code    int
+	}{
+		{"all ok", []jobResult{{Target: "a/x"}, {Target: "b/y"}}, exitOK},
+		{"one failed", []jobResult{{Target: "a/x"}, {Target: "b/y", Code: exitBuild}}, exitBuild},
+		{"same failure", []jobResult{{Target: "a/x", Code: exitNetwork}, {Target: "b/y", Code: exitNetwork}}, exitNetwork},
+		{"different failures", []jobResult{{Target: "a/x", Code: exitNetwork}, {Target: "b/y", Code: exitBuild}}, exitFailure},
+	}
+	for _, tt := range tests {
+		var err error
+		captureStdout(t, func() { err = printJobResults(tt.results) })
+		if exitCode(err) != tt.code {
+			t.Errorf("%s: %v, want exit code %d", tt.name, err, tt.code)
+		}
+	}
+
+	out := captureStdout(t, func() {
+		printJobResults([]jobResult{{Target: "own/tool", Code: exitBuild, Elapsed: 2 * time.Second}})
+	})
+	if want := "\nPACKAGE   RESULT  TIME\nown/tool  failed  2s\n"; out != want {
+		t.Errorf("printed %q, want %q", out, want)
+	}
+}
+
+func TestInstallManyNeedsOwners(t *testing.T) {
+	if err := installMany([]string{"own/a", "tool"}, 2, nil); exitCode(err) != exitUsage {
+		t.Errorf("installMany without an owner: %v", err)
+	}
+}
+
+func TestJobsFlag(t *testing.T) {
+	tests := []struct {
+		args []string
+		want int
+		code int
+	}{
+		{nil, 1, exitOK},
+		{[]string{"-j", "4"}, 4, exitOK},
+		{[]string{"--jobs", "3"}, 3, exitOK},
+		{[]string{"-j", "0"}, 0, exitUsage},
+	}
+	for _, tt := range tests {
+		fs := flag.NewFlagSet("test", flag.ContinueOnError)
+		jobs := jobsFlag(fs)
+		if err := fs.Parse(tt.args); err != nil {
+			t.Fatal(err)
+		}
+		n, err := jobs()
+		if n != tt.want || exitCode(err) != tt.code {
+			t.Errorf("%v: %d, %v", tt.args, n, err)
+		}
+	}
+}
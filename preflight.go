@@ -0,0 +1,308 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// buildSystemTools lists the commands each build system needs on PATH.
+var buildSystemTools = map[string][]string{
+	"go":        {"go"},
+	"cargo":     {"cargo", "rust"},
+	"npm":       {"npm", "node"},
+	"deno":      {"deno"},
+	"pip":       {"python"},
+	"ruby":      {"ruby"},
+	"stack":     {"stack"},
+	"mix":       {"mix"},
+	"composer":  {"composer"},
+	"dotnet":    {"dotnet"},
+	"dune":      {"dune"},
+	"zig":       {"zig"},
+	"meson":     {"meson"},
+	"cmake":     {"cmake", "make"},
+	"autotools": {"make"},
+	"make":      {"make"},
+	"just":      {"just"},
+	"shell":     {"sh"},
+}
+
+// toolInstallHints tell the user where to get a missing tool.
+var toolInstallHints = map[string]string{
+	"go":       "https://go.dev/dl/",
+	"rust":     "https://rustup.rs",
+	"cargo":    "https://rustup.rs",
+	"node":     "https://nodejs.org/en/download",
+	"npm":      "https://nodejs.org/en/download",
+	"python":   "https://www.python.org/downloads/",
+	"ruby":     "https://www.ruby-lang.org/en/downloads/",
+	"zig":      "https://ziglang.org/download/",
+	"deno":     "https://deno.com",
+	"dotnet":   "https://dotnet.microsoft.com/download",
+	"stack":    "https://docs.haskellstack.org",
+	"mix":      "https://elixir-lang.org/install.html",
+	"composer": "https://getcomposer.org/download/",
+	"dune":     "https://ocaml.org/install",
+	"cmake":    "https://cmake.org/download/ or your package manager",
+	"meson":    "pip install meson ninja, or your package manager",
+	"make":     "your package manager (build-essential, base-devel, Xcode CLT)",
+	"just":     "https://just.systems",
+}
+
+var (
+	goToolchainLine = regexp.MustCompile(`(?m)^toolchain\s+go(\S+)`)
+	goDirectiveLine = regexp.MustCompile(`(?m)^go\s+(\S+)`)
+	rustVersionLine = regexp.MustCompile(`(?m)^\s*rust-version\s*=\s*"([^"]+)"`)
+	engineVersion   = regexp.MustCompile(`\d+(\.\d+)*`)
+)
+
+// declaredVersions reads the minimum toolchain versions a repo declares in
+// go.mod, Cargo.toml and package.json.
+func declaredVersions(read func(name string) []byte) map[string]string {
+	versions := map[string]string{}
+	if data := read("go.mod"); data != nil {
+		if m := goToolchainLine.FindSubmatch(data); m != nil {
+			versions["go"] = string(m[1])
+		} else if m := goDirectiveLine.FindSubmatch(data); m != nil {
+			versions["go"] = string(m[1])
+		}
+	}
+	if data := read("Cargo.toml"); data != nil {
+		if m := rustVersionLine.FindSubmatch(data); m != nil {
+			versions["rust"] = string(m[1])
+		}
+	}
+	if data := read("package.json"); data != nil {
+		var pkg struct {
+			Engines map[string]string `json:"engines"`
+		}
+		if json.Unmarshal(data, &pkg) == nil && pkg.Engines["node"] != "" {
+			// Only the first alternative of "^18 || ^20" is checked.
+			first, _, _ := strings.Cut(pkg.Engines["node"], "||")
+			versions["node"] = engineVersion.FindString(first)
+		}
+	}
+	return versions
+}
+
+// repoSnapshot is a view of a repo's root without a full clone: the file
+// names there and a way to read them.
+type repoSnapshot struct {
+	names []string
+	read  func(name string) []byte
+	from  string
+}
+
+// snapshotFromAPI lists the repo root through the contents API and fetches
+// files on demand from raw.githubusercontent.com.
+func snapshotFromAPI(repo string) (*repoSnapshot, error) {
+	var entries []struct {
+		Name string `json:"name"`
+		Type string `json:"type"`
+	}
+	if err := githubGet("/repos/"+repo+"/contents/", &entries); err != nil {
+		return nil, err
+	}
+	snap := &repoSnapshot{from: "GitHub API"}
+	present := map[string]bool{}
+	for _, e := range entries {
+		if e.Type == "file" {
+			snap.names = append(snap.names, e.Name)
+			present[e.Name] = true
+		}
+	}
+	cache := map[string][]byte{}
+	snap.read = func(name string) []byte {
+		if !present[name] {
+			return nil
+		}
+		if data, ok := cache[name]; ok {
+			return data
+		}
+		data, _ := githubFile(repo, name)
+		cache[name] = data
+		return data
+	}
+	return snap, nil
+}
+
+// snapshotFromClone makes a depth-1 clone into a temp directory. The caller
+// must call cleanup.
+func snapshotFromClone(url string) (*repoSnapshot, func(), error) {
+	tmp, err := os.MkdirTemp("", "ghpm-preflight-")
+	if err != nil {
+		return nil, nil, err
+	}
+	cleanup := func() { os.RemoveAll(tmp) }
+	cmd := exec.Command("git", "clone", "--quiet", "--depth", "1", url, tmp)
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+
+	snap := &repoSnapshot{from: "shallow clone"}
+	entries, _ := os.ReadDir(tmp)
+	for _, e := range entries {
+		if !e.IsDir() {
+			snap.names = append(snap.names, e.Name())
+		}
+	}
+	snap.read = func(name string) []byte {
+		data, err := os.ReadFile(filepath.Join(tmp, name))
+		if err != nil {
+			return nil
+		}
+		return data
+	}
+	return snap, cleanup, nil
+}
+
+// printLanguages shows GitHub's language breakdown for repo, largest first.
+func printLanguages(repo string) {
+	var langs map[string]int
+	if err := githubGet("/repos/"+repo+"/languages", &langs); err != nil || len(langs) == 0 {
+		return
+	}
+	total := 0
+	var names []string
+	for name, bytes := range langs {
+		total += bytes
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return langs[names[i]] > langs[names[j]] })
+	var parts []string
+	for i, name := range names {
+		if i == 4 {
+			break
+		}
+		parts = append(parts, fmt.Sprintf("%s %d%%", name, langs[name]*100/total))
+	}
+	fmt.Println("GitHub languages:", strings.Join(parts, ", "))
+}
+
+// preflight checks, before cloning, that the toolchain repo needs is
+// installed and new enough. It returns an error, after explaining what is
+// missing, when the build could not succeed.
+func preflight(repo, url string, opts installOptions) error {
+	if opts.NoBuild || opts.SkipPreflight {
+		return nil
+	}
+	if offline {
+		fmt.Println("Preflight skipped: offline")
+		return nil
+	}
+
+	snap, err := snapshotFromAPI(repo)
+	if err != nil {
+		fmt.Println("Preflight: GitHub API unavailable (" + err.Error() + "); using a shallow clone")
+		var cleanup func()
+		snap, cleanup, err = snapshotFromClone(url)
+		if err != nil {
+			fmt.Println("Preflight skipped:", err)
+			return nil
+		}
+		defer cleanup()
+	} else {
+		printLanguages(repo)
+	}
+
+	reqs := map[string]string{}
+	var upstream *Recipe
+	for _, name := range packageRecipeFiles {
+		if data := snap.read(name); data != nil {
+			var r Recipe
+			if decodeYAML(data, &r) == nil {
+				upstream = &r
+			}
+			break
+		}
+	}
+	indexed, _ := lookupIndexRecipe(repo)
+	recipe := mergeRecipe(mergeRecipe(upstream, indexed), opts.Recipe)
+
+	if recipe == nil || len(recipe.Build) == 0 {
+		ranked := detectFrom(snap.names, snap.read)
+		system := opts.BuildSystem
+		if system == "" && len(ranked) > 0 {
+			system = ranked[0].BuildSystem
+		}
+		if system == "" {
+			return nil
+		}
+		fmt.Println("Preflight: build system", system, "(from "+snap.from+")")
+		for _, tool := range buildSystemTools[system] {
+			reqs[tool] = ""
+		}
+		for tool, version := range declaredVersions(snap.read) {
+			if _, needed := reqs[tool]; needed {
+				reqs[tool] = version
+			}
+		}
+	}
+	if recipe != nil {
+		for tool, version := range recipe.Requires {
+			reqs[tool] = version
+		}
+	}
+
+	// Go 1.21+ downloads the toolchain go.mod asks for by itself.
+	if want, ok := reqs["go"]; ok && want != "" && os.Getenv("GOTOOLCHAIN") != "local" {
+		if have, err := toolVersion("go"); err == nil && compareVersions(have, "1.21") >= 0 {
+			reqs["go"] = ""
+		}
+	}
+
+	// Managed toolchains fetch any declared Go, Node or Rust version at
+	// build time.
+	if loadConfig().Toolchains {
+		pinned := map[string]bool{}
+		for tool, want := range reqs {
+			if t := managedToolFor(tool); t != "" && minimumVersion(want) != "" {
+				pinned[t] = true
+			}
+		}
+		for tool := range reqs {
+			if pinned[managedToolFor(tool)] {
+				delete(reqs, tool)
+			}
+		}
+	}
+
+	problems := checkRequirements(reqs)
+	if len(problems) == 0 {
+		return nil
+	}
+
+	fmt.Println("Preflight failed for", repo+":")
+	for _, p := range problems {
+		fmt.Println("  -", p)
+	}
+	var tools []string
+	for tool := range reqs {
+		tools = append(tools, tool)
+	}
+	sort.Strings(tools)
+	for _, tool := range tools {
+		if hint, ok := toolInstallHints[tool]; ok && mentionsTool(problems, tool) {
+			fmt.Printf("Install %s: %s\n", tool, hint)
+		}
+	}
+	fmt.Println("Nothing was cloned. Install the missing tools and retry, or pass --skip-preflight or --no-build.")
+	return verifyError("preflight failed for %s: %s", repo, strings.Join(problems, "; "))
+}
+
+func mentionsTool(problems []string, tool string) bool {
+	for _, p := range problems {
+		if strings.HasPrefix(p, tool+" ") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,434 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// Recipe is an explicit build description that replaces guessing. Build
+// holds shell commands run from the repo root and Bin holds paths (or globs)
+// relative to the repo root to link afterwards. Either may be left empty to
+// keep the detected behaviour for that step. Index recipes and .ghpm.yml
+// files may also list dependencies, supported platforms, man pages, shell
+// completions (keyed by shell) and minimum tool versions (keyed by tool).
+type Recipe struct {
+	Build       stringList        `json:"build,omitempty"`
+	Bin         stringList        `json:"bin,omitempty"`
+	Depends     stringList        `json:"depends,omitempty"`
+	Platforms   stringList        `json:"platforms,omitempty"`
+	Man         stringList        `json:"man,omitempty"`
+	Completions map[string]string `json:"completions,omitempty"`
+	Requires    map[string]string `json:"requires,omitempty"`
+}
+
+// packageRecipeFiles are the names a repo can use to describe its own build.
+var packageRecipeFiles = []string{".ghpm.yml", ".ghpm.yaml"}
+
+// loadPackageRecipe reads the .ghpm.yml shipped at the root of a repo.
+func loadPackageRecipe(repoPath string) (*Recipe, string) {
+	for _, name := range packageRecipeFiles {
+		path := filepath.Join(repoPath, name)
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		r, err := loadRecipeFile(path)
+		if err != nil {
+			fmt.Println("Ignoring invalid", name+":", err)
+			return nil, ""
+		}
+		return r, name
+	}
+	return nil, ""
+}
+
+// mergeRecipe layers over on top of base: every field set in over replaces
+// the one in base.
+func mergeRecipe(base, over *Recipe) *Recipe {
+	if base == nil {
+		return over
+	}
+	if over == nil {
+		return base
+	}
+	merged := *base
+	if len(over.Build) > 0 {
+		merged.Build = over.Build
+	}
+	if len(over.Bin) > 0 {
+		merged.Bin = over.Bin
+	}
+	if len(over.Depends) > 0 {
+		merged.Depends = over.Depends
+	}
+	if len(over.Platforms) > 0 {
+		merged.Platforms = over.Platforms
+	}
+	if len(over.Man) > 0 {
+		merged.Man = over.Man
+	}
+	if len(over.Completions) > 0 {
+		merged.Completions = over.Completions
+	}
+	if len(over.Requires) > 0 {
+		merged.Requires = over.Requires
+	}
+	return &merged
+}
+
+// stringList decodes from either a single string or a list of strings, so
+// recipe authors can write "build: make" as well as a list of steps.
+type stringList []string
+
+func (l *stringList) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*l = stringList{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*l = list
+	return nil
+}
+
+func (r *Recipe) empty() bool {
+	return r == nil || (len(r.Build) == 0 && len(r.Bin) == 0)
+}
+
+// buildResult is what buildPackage records in the manifest.
+type buildResult struct {
+	Built    bool
+	BuildCmd string
+	Binaries []string
+	Links    []string
+	Log      string
+}
+
+// err returns the error for a build that should have produced something
+// but did not, or nil.
+func (r buildResult) err(det detection, recipe *Recipe) error {
+	if r.Built || r.BuildCmd == "skipped" {
+		return nil
+	}
+	if r.BuildCmd == "requirements not met" {
+		return verifyError("build requirements not met")
+	}
+	if det.BuildSystem == "" && (recipe == nil || len(recipe.Build) == 0) {
+		return nil
+	}
+	if r.Log != "" {
+		return buildError("build failed (%s); see %s", r.BuildCmd, r.Log)
+	}
+	return buildError("build failed (%s)", r.BuildCmd)
+}
+
+// buildPackage builds the package at repoPath and links its binaries, using
+// the recipe for whichever steps it covers and detection for the rest. With
+// noBuild the binaries already in the clone are linked without building.
+func buildPackage(repoPath, name string, det detection, recipe *Recipe, noBuild bool) buildResult {
+	var res buildResult
+	if !noBuild {
+		defer activateToolchains(buildVersions(repoPath, recipe))()
+		if l := startBuildLog(name, repoPath); l != nil {
+			res.Log = l.path
+			defer func() { l.finish(res) }()
+		}
+	}
+	if recipe != nil && len(recipe.Requires) > 0 && !noBuild {
+		if problems := checkRequirements(recipe.Requires); len(problems) > 0 {
+			fmt.Println("Build requirements not met:")
+			for _, p := range problems {
+				fmt.Println("  -", p)
+			}
+			res.BuildCmd = "requirements not met"
+			return res
+		}
+	}
+
+	switch {
+	case noBuild:
+		fmt.Println("Skipping build (--no-build flag)")
+		res.BuildCmd = "skipped"
+	case recipe != nil && len(recipe.Build) > 0:
+		res.Built, res.BuildCmd = runRecipeBuild(repoPath, name, recipe.Build)
+	default:
+		res.Built, res.BuildCmd = autoBuildRepo(repoPath, det)
+	}
+
+	if recipe != nil && len(recipe.Bin) > 0 {
+		res.Binaries = linkRecipeBinaries(repoPath, name, recipe.Bin)
+	} else {
+		res.Binaries = linkBinaries(repoPath, name, det.Language)
+	}
+
+	if recipe != nil {
+		cmdName := name
+		if len(res.Binaries) > 0 {
+			cmdName = strings.TrimSuffix(filepath.Base(res.Binaries[0]), ".exe")
+		}
+		res.Links = append(res.Links, linkManPages(repoPath, recipe.Man)...)
+		res.Links = append(res.Links, linkCompletions(repoPath, cmdName, recipe.Completions)...)
+	}
+	return res
+}
+
+// linkManPages symlinks man pages into ~/.local/share/man/man<section>,
+// taking the section from the file extension (tool.1 or tool.1.gz).
+func linkManPages(repoPath string, pages []string) []string {
+	manDir := filepath.Join(os.Getenv("HOME"), ".local", "share", "man")
+	var links []string
+	for _, rel := range pages {
+		src := filepath.Join(repoPath, rel)
+		if _, err := os.Stat(src); err != nil {
+			fmt.Println("Man page not found:", rel)
+			continue
+		}
+		if !withinDirs(src, repoPath) {
+			fmt.Println("Not linking man page", rel+": it is outside the package")
+			continue
+		}
+		base := strings.TrimSuffix(filepath.Base(src), ".gz")
+		section := strings.TrimPrefix(filepath.Ext(base), ".")
+		if section == "" {
+			fmt.Println("Cannot tell the section of man page", rel)
+			continue
+		}
+		dir := filepath.Join(manDir, "man"+section[:1])
+		if link := symlinkInto(src, dir, filepath.Base(src)); link != "" {
+			links = append(links, link)
+		}
+	}
+	if len(links) > 0 {
+		fmt.Println("Linked", len(links), "man page(s) to", manDir)
+	}
+	return links
+}
+
+// completionDirs gives where each shell looks for user completions and the
+// file name it expects for a command.
+var completionDirs = map[string]func(cmd string) (string, string){
+	"bash": func(cmd string) (string, string) {
+		return filepath.Join(os.Getenv("HOME"), ".local", "share", "bash-completion", "completions"), cmd
+	},
+	"zsh": func(cmd string) (string, string) {
+		return filepath.Join(os.Getenv("HOME"), ".local", "share", "zsh", "site-functions"), "_" + cmd
+	},
+	"fish": func(cmd string) (string, string) {
+		return filepath.Join(os.Getenv("HOME"), ".config", "fish", "completions"), cmd + ".fish"
+	},
+}
+
+func linkCompletions(repoPath, cmdName string, completions map[string]string) []string {
+	var links []string
+	for shell, rel := range completions {
+		where, ok := completionDirs[shell]
+		if !ok {
+			fmt.Println("Unsupported completion shell:", shell)
+			continue
+		}
+		src := filepath.Join(repoPath, rel)
+		if _, err := os.Stat(src); err != nil {
+			fmt.Println("Completion file not found:", rel)
+			continue
+		}
+		if !withinDirs(src, repoPath) {
+			fmt.Println("Not linking completion file", rel+": it is outside the package")
+			continue
+		}
+		dir, file := where(cmdName)
+		if link := symlinkInto(src, dir, file); link != "" {
+			fmt.Println("Linked", shell, "completion to", dir)
+			links = append(links, link)
+		}
+	}
+	return links
+}
+
+// withinDirs reports whether path, with symlinks resolved, is inside one of
+// dirs.
+func withinDirs(path string, dirs ...string) bool {
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return false
+	}
+	for _, dir := range dirs {
+		d, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(d, real)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// symlinkInto creates dir/name pointing at src and returns the link path,
+// or "" on failure.
+func symlinkInto(src, dir, name string) string {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		fmt.Println("Failed to create", dir+":", err)
+		return ""
+	}
+	link := filepath.Join(dir, name)
+	os.Remove(link)
+	if err := os.Symlink(src, link); err != nil {
+		fmt.Println("Failed to link", src, ":", err)
+		return ""
+	}
+	return link
+}
+
+// runRecipeBuild runs user-supplied build commands through the shell.
+// GHPM_PACKAGE_DIR and GHPM_BIN_DIR are exported so commands can refer to
+// the clone and to the package's private bin directory.
+func runRecipeBuild(repoPath, name string, steps []string) (bool, string) {
+	cmdDesc := strings.Join(steps, " && ")
+
+	binDir := packageBinDir(name)
+	os.MkdirAll(binDir, 0755)
+
+	for _, step := range steps {
+		fmt.Println("Running", step, "...")
+		var cmd *exec.Cmd
+		if runtime.GOOS == "windows" {
+			cmd = exec.Command("cmd", "/C", step)
+		} else {
+			cmd = exec.Command("sh", "-c", step)
+		}
+		cmd.Dir = repoPath
+		cmd.Env = append(os.Environ(), "GHPM_PACKAGE_DIR="+repoPath, "GHPM_BIN_DIR="+binDir)
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := runLogged(cmd); err != nil {
+			fmt.Println("Build command failed:", step)
+			return false, cmdDesc
+		}
+	}
+	fmt.Println("Build successful!")
+	return true, cmdDesc
+}
+
+// linkRecipeBinaries links the files named by a recipe instead of guessing.
+// A recipe can come from the repository itself, so only $GHPM_BIN_DIR and
+// $GHPM_PACKAGE_DIR are expanded, and files that turn out to be elsewhere
+// (through an absolute path, "..", or a symlink) are neither made
+// executable nor linked.
+func linkRecipeBinaries(repoPath, name string, patterns []string) []string {
+	binDir := packageBinDir(name)
+	var binaries []string
+	for _, pattern := range patterns {
+		pattern = os.Expand(pattern, func(key string) string {
+			switch key {
+			case "GHPM_BIN_DIR":
+				return binDir
+			case "GHPM_PACKAGE_DIR":
+				return repoPath
+			}
+			return ""
+		})
+		if !filepath.IsAbs(pattern) {
+			pattern = filepath.Join(repoPath, pattern)
+		}
+		matches, _ := filepath.Glob(pattern)
+		if len(matches) == 0 {
+			fmt.Println("Binary not found:", pattern)
+			continue
+		}
+		for _, m := range matches {
+			if !withinDirs(m, repoPath, binDir) {
+				fmt.Println("Not linking", m+": it is outside the package")
+				continue
+			}
+			if info, err := os.Stat(m); err == nil && !info.IsDir() {
+				os.Chmod(m, 0755)
+				binaries = append(binaries, m)
+			}
+		}
+	}
+	return linkFiles(binaries, name)
+}
+
+// editPackage changes the stored build recipe of an installed package. With
+// nothing to change it prints the current settings.
+func editPackage(name string, builds, bins []string, system string, clear bool) error {
+	lock, err := lockPackageCleanly(name)
+	if err != nil {
+		return err
+	}
+	defer lock.unlock()
+
+	m, err := loadManifest(name)
+	if err != nil {
+		return notFoundError("package not found: %s", name)
+	}
+
+	if len(builds) == 0 && len(bins) == 0 && system == "" && !clear {
+		fmt.Println("Package:", m.Name)
+		printRecipe(m)
+		fmt.Println("")
+		fmt.Println("Usage: ghpm edit <name> [--build <cmd>]... [--bin <path>]... [--build-system <name>] [--clear]")
+		return nil
+	}
+
+	if system != "" && !knownBuildSystem(system) {
+		return usageError("unknown build system %s (build systems: %s)", system, strings.Join(buildSystemNames(), ", "))
+	}
+
+	if clear {
+		m.Recipe = nil
+		m.BuildSystemOverride = ""
+	}
+	if len(builds) > 0 || len(bins) > 0 {
+		if m.Recipe == nil {
+			m.Recipe = &Recipe{}
+		}
+		if len(builds) > 0 {
+			m.Recipe.Build = builds
+		}
+		if len(bins) > 0 {
+			m.Recipe.Bin = bins
+		}
+	}
+	if system != "" {
+		m.BuildSystemOverride = system
+	}
+	if m.Recipe.empty() {
+		m.Recipe = nil
+	}
+
+	saveManifest(m)
+	fmt.Println("Updated build settings for", m.Name)
+	printRecipe(m)
+	fmt.Println("Run 'ghpm update " + m.Name + "' to rebuild with them.")
+	return nil
+}
+
+func printRecipe(m Manifest) {
+	if m.BuildSystemOverride != "" {
+		fmt.Println("Build System Override:", m.BuildSystemOverride)
+	}
+	if m.Recipe == nil {
+		if m.BuildSystemOverride == "" {
+			fmt.Println("No build overrides; the build is detected automatically.")
+		}
+		return
+	}
+	for _, b := range m.Recipe.Build {
+		fmt.Println("Build:", b)
+	}
+	for _, b := range m.Recipe.Bin {
+		fmt.Println("Bin:", b)
+	}
+}
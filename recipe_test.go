@@ -0,0 +1,154 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestLinkRecipeBinariesStaysInPackage(t *testing.T) {
+	home := testHome(t)
+	repoPath := filepath.Join(packagesDir, "tool")
+	secret := filepath.Join(home, ".ssh", "id_ed25519")
+	for path, mode := range map[string]os.FileMode{
+		filepath.Join(repoPath, "bin", "tool"):      0644,
+		filepath.Join(packageBinDir("tool"), "aux"): 0755,
+		secret: 0600,
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte("x"), mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink(filepath.Dir(secret), filepath.Join(repoPath, "keys")); err != nil {
+		t.Fatal(err)
+	}
+
+	got := linkRecipeBinaries(repoPath, "tool", []string{
+		"bin/*",
+		"$GHPM_BIN_DIR/aux",
+		secret,
+		"$HOME/.ssh/*",
+		"../../../.ssh/*",
+		"keys/*",
+	})
+	want := []string{filepath.Join(repoPath, "bin", "tool"), filepath.Join(packageBinDir("tool"), "aux")}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("linked %v, want %v", got, want)
+	}
+	if info, err := os.Stat(secret); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("file outside the package changed: %v %v", info.Mode(), err)
+	}
+	if info, _ := os.Stat(want[0]); info.Mode().Perm() != 0755 {
+		t.Errorf("binary mode %v", info.Mode())
+	}
+}
+
+func TestWithinDirs(t *testing.T) {
+	dir := t.TempDir()
+	inside := filepath.Join(dir, "pkg", "a")
+	outside := filepath.Join(dir, "other")
+	for _, p := range []string{inside, outside} {
+		os.MkdirAll(filepath.Dir(p), 0755)
+		os.WriteFile(p, nil, 0644)
+	}
+	os.Symlink(outside, filepath.Join(dir, "pkg", "link"))
+	os.Symlink(inside, filepath.Join(dir, "in-link"))
+
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{inside, true},
+		{filepath.Join(dir, "pkg", "..", "other"), false},
+		{filepath.Join(dir, "pkg", "link"), false},
+		{filepath.Join(dir, "in-link"), true},
+		{filepath.Join(dir, "pkg", "missing"), false},
+		{outside, false},
+	}
+	for _, tt := range tests {
+		if got := withinDirs(tt.path, filepath.Join(dir, "pkg")); got != tt.want {
+			t.Errorf("withinDirs(%s) = %v", tt.path, got)
+		}
+	}
+}
+
+// testPackage installs a package named tool whose only build is a Makefile
+// next to a package.json, so detection guesses npm.
+func testPackage(t *testing.T, m Manifest) string {
+	t.Helper()
+	testHome(t)
+	pkgPath := filepath.Join(packagesDir, "tool")
+	os.MkdirAll(pkgPath, 0755)
+	files := map[string]string{
+		"package.json": `{"name": "tool"}`,
+		"Makefile":     "all:\n\tprintf '#!/bin/sh\\n' > tool && chmod +x tool\ninstall:\n\ttrue\n",
+	}
+	for name, data := range files {
+		if err := os.WriteFile(filepath.Join(pkgPath, name), []byte(data), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	m.Name, m.Repo = "tool", "own/tool"
+	saveManifest(m)
+	return pkgPath
+}
+
+func TestEditPackage(t *testing.T) {
+	testPackage(t, Manifest{Built: true})
+	tests := []struct {
+		name     string
+		builds   []string
+		bins     []string
+		system   string
+		clear    bool
+		code     int
+		override string
+		recipe   *Recipe
+	}{
+		{name: "show only"},
+		{name: "unknown build system", system: "ant", code: exitUsage},
+		{name: "build system", system: "make", override: "make"},
+		{name: "build and bin", builds: []string{"make all"}, bins: []string{"tool"}, override: "make",
+			recipe: &Recipe{Build: []string{"make all"}, Bin: []string{"tool"}}},
+		{name: "bin only keeps build", bins: []string{"out/tool"}, override: "make",
+			recipe: &Recipe{Build: []string{"make all"}, Bin: []string{"out/tool"}}},
+		{name: "clear", clear: true},
+	}
+	for _, tt := range tests {
+		err := editPackage("tool", tt.builds, tt.bins, tt.system, tt.clear)
+		if exitCode(err) != tt.code {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		m, _ := loadManifest("tool")
+		if m.BuildSystemOverride != tt.override || !reflect.DeepEqual(m.Recipe, tt.recipe) {
+			t.Errorf("%s: override %q, recipe %+v", tt.name, m.BuildSystemOverride, m.Recipe)
+		}
+	}
+	if err := editPackage("missing", nil, nil, "make", false); exitCode(err) != exitNotFound {
+		t.Errorf("missing package: %v", err)
+	}
+}
+
+func TestUpdateAfterEditRebuilds(t *testing.T) {
+	if !commandExists("make") {
+		t.Skip("make is not installed")
+	}
+	pkgPath := testPackage(t, Manifest{Built: false, BuildCmd: "npm install"})
+	if err := editPackage("tool", nil, nil, "make", false); err != nil {
+		t.Fatal(err)
+	}
+	m, _ := loadManifest("tool")
+	if err := rebuildPackage(&m, pkgPath); err != nil {
+		t.Fatal(err)
+	}
+	if !m.Built || m.BuildSystem != "make" {
+		t.Errorf("built %v with %q", m.Built, m.BuildSystem)
+	}
+	if _, err := os.Stat(filepath.Join(pkgPath, "tool")); err != nil {
+		t.Error("the Makefile did not run")
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// The recipe index is a plain git repo (or local directory) with one file
+// per package at <owner>/<repo>.json, .yml or .yaml. Recipes are consulted
+// before build system detection, the way Homebrew formulae are, and take
+// precedence over a .ghpm.yml shipped by the repo itself.
+
+var recipeExtensions = []string{".json", ".yml", ".yaml"}
+
+func expandHome(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[1:])
+		}
+	}
+	return path
+}
+
+// localIndexDir returns the directory of a recipe index that lives on disk,
+// or "" when the index location is a git URL.
+func localIndexDir(location string) string {
+	dir := expandHome(location)
+	if info, err := os.Stat(dir); err == nil && info.IsDir() {
+		abs, err := filepath.Abs(dir)
+		if err == nil {
+			return abs
+		}
+		return dir
+	}
+	return ""
+}
+
+func recipeIndexDir(cfg Config) string {
+	if dir := localIndexDir(cfg.RecipeIndex); dir != "" {
+		return dir
+	}
+	return filepath.Join(baseDir, "recipes")
+}
+
+// syncRecipeIndex clones or pulls the configured index into ~/.ghpm/recipes.
+// A local directory is used in place and needs no syncing.
+func syncRecipeIndex(cfg Config) error {
+	if cfg.RecipeIndex == "" {
+		return fmt.Errorf("no recipe index configured; set one with 'ghpm config recipe_index <git-url|dir>'")
+	}
+	if dir := localIndexDir(cfg.RecipeIndex); dir != "" {
+		fmt.Println("Using local recipe index at", dir)
+		return nil
+	}
+
+	dir := filepath.Join(baseDir, "recipes")
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+		out, _ := exec.Command("git", "-C", dir, "remote", "get-url", "origin").Output()
+		if strings.TrimSpace(string(out)) == cfg.RecipeIndex {
+			fmt.Println("Updating recipe index from", cfg.RecipeIndex)
+			cmd := exec.Command("git", "pull", "--ff-only")
+			cmd.Dir = dir
+			cmd.Stdout = os.Stdout
+			cmd.Stderr = os.Stderr
+			return cmd.Run()
+		}
+		fmt.Println("Recipe index location changed; cloning again")
+		os.RemoveAll(dir)
+	}
+
+	fmt.Println("Cloning recipe index", cfg.RecipeIndex)
+	cmd := exec.Command("git", "clone", "--depth", "1", cfg.RecipeIndex, dir)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+// findRecipeFile locates the recipe for owner/repo, matching names without
+// regard to case.
+func findRecipeFile(indexDir, repo string) string {
+	owner, name, ok := strings.Cut(repo, "/")
+	if !ok {
+		return ""
+	}
+	owners, _ := os.ReadDir(indexDir)
+	for _, o := range owners {
+		if !o.IsDir() || !strings.EqualFold(o.Name(), owner) {
+			continue
+		}
+		files, _ := os.ReadDir(filepath.Join(indexDir, o.Name()))
+		for _, f := range files {
+			ext := filepath.Ext(f.Name())
+			base := strings.TrimSuffix(f.Name(), ext)
+			for _, want := range recipeExtensions {
+				if ext == want && strings.EqualFold(base, name) {
+					return filepath.Join(indexDir, o.Name(), f.Name())
+				}
+			}
+		}
+	}
+	return ""
+}
+
+func loadRecipeFile(path string) (*Recipe, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var r Recipe
+	if filepath.Ext(path) == ".json" {
+		err = json.Unmarshal(data, &r)
+	} else {
+		err = decodeYAML(data, &r)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return &r, nil
+}
+
+// lookupIndexRecipe returns the index recipe for repo and the file it came
+// from. The index is cloned on first use if it has never been synced.
+func lookupIndexRecipe(repo string) (*Recipe, string) {
+	cfg := loadConfig()
+	if cfg.RecipeIndex == "" {
+		return nil, ""
+	}
+	dir := recipeIndexDir(cfg)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err := syncRecipeIndex(cfg); err != nil {
+			fmt.Println("Recipe index sync failed:", err)
+			return nil, ""
+		}
+	}
+
+	path := findRecipeFile(dir, repo)
+	if path == "" {
+		return nil, ""
+	}
+	r, err := loadRecipeFile(path)
+	if err != nil {
+		fmt.Println("Ignoring invalid recipe:", err)
+		return nil, ""
+	}
+	return r, path
+}
+
+// supportsPlatform reports whether the recipe lists the current platform.
+// Entries are either an OS ("linux") or OS/arch ("darwin/arm64"); an empty
+// list means every platform.
+func (r *Recipe) supportsPlatform() bool {
+	if len(r.Platforms) == 0 {
+		return true
+	}
+	for _, p := range r.Platforms {
+		goos, goarch, hasArch := strings.Cut(p, "/")
+		if goos == runtime.GOOS && (!hasArch || goarch == runtime.GOARCH) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveRecipe combines, from lowest to highest precedence, the repo's own
+// .ghpm.yml, the index recipe for repo and the user's override (from flags
+// or the manifest). It returns nil when none applies, along with a
+// description of where the recipe came from.
+func resolveRecipe(repo, repoPath string, override *Recipe) (*Recipe, string) {
+	var recipe *Recipe
+	var sources []string
+	layer := func(r *Recipe, source, path string) {
+		if r == nil {
+			return
+		}
+		if !r.supportsPlatform() {
+			fmt.Printf("%s does not support %s/%s (platforms: %s); ignoring it\n",
+				path, runtime.GOOS, runtime.GOARCH, strings.Join(r.Platforms, ", "))
+			return
+		}
+		if path != "" {
+			fmt.Println("Using recipe from", path)
+		}
+		recipe = mergeRecipe(recipe, r)
+		sources = append([]string{source}, sources...)
+	}
+
+	upstream, upstreamFile := loadPackageRecipe(repoPath)
+	layer(upstream, upstreamFile, upstreamFile)
+	indexed, path := lookupIndexRecipe(repo)
+	layer(indexed, "index", path)
+	layer(override, "override", "")
+
+	return recipe, strings.Join(sources, "+")
+}
+
+// recipesCommand implements "ghpm recipes [sync|show <owner/repo>]".
+func recipesCommand(args []string) error {
+	cfg := loadConfig()
+	if len(args) == 0 {
+		if cfg.RecipeIndex == "" {
+			fmt.Println("No recipe index configured.")
+			fmt.Println("Set one with: ghpm config recipe_index <git-url|dir>")
+			return nil
+		}
+		dir := recipeIndexDir(cfg)
+		count := 0
+		filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() && d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			for _, ext := range recipeExtensions {
+				if !d.IsDir() && filepath.Ext(path) == ext {
+					count++
+				}
+			}
+			return nil
+		})
+		fmt.Println("Recipe index:", cfg.RecipeIndex)
+		fmt.Println("Location:", dir)
+		fmt.Println("Recipes:", count)
+		return nil
+	}
+
+	switch args[0] {
+	case "sync":
+		if err := syncRecipeIndex(cfg); err != nil {
+			return networkError("recipe index sync failed: %v", err)
+		}
+		fmt.Println("Recipe index is up to date")
+	case "show":
+		if len(args) < 2 {
+			return usageError("Usage: ghpm recipes show owner/repo")
+		}
+		r, path := lookupIndexRecipe(args[1])
+		if r == nil {
+			return notFoundError("no recipe for %s", args[1])
+		}
+		fmt.Println("Recipe:", path)
+		for _, b := range r.Build {
+			fmt.Println("Build:", b)
+		}
+		for _, b := range r.Bin {
+			fmt.Println("Bin:", b)
+		}
+		if len(r.Depends) > 0 {
+			fmt.Println("Depends:", strings.Join(r.Depends, ", "))
+		}
+		if len(r.Platforms) > 0 {
+			fmt.Println("Platforms:", strings.Join(r.Platforms, ", "))
+		}
+	default:
+		return usageError("Usage: ghpm recipes [sync|show owner/repo]")
+	}
+	return nil
+}
@@ -0,0 +1,610 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+)
+
+// "ghpm sbom" describes everything installed in ~/.ghpm as a CycloneDX 1.5
+// or SPDX 2.3 JSON document: each package with its repository, commit,
+// version and license, the SHA-256 of each linked binary, and the
+// libraries its build resolved, read from go.sum, Cargo.lock,
+// package-lock.json and requirements.txt in the clone.
+
+var sbomFormats = []string{"cyclonedx", "spdx"}
+
+// sbomPackage is what both formats are written from.
+type sbomPackage struct {
+	Manifest
+	License   string
+	Files     []sbomFile
+	Libraries []sbomLibrary
+}
+
+type sbomFile struct {
+	Path   string
+	SHA256 string
+}
+
+// sbomLibrary is a dependency resolved by a language build, named by its
+// package URL. Ecosystem is the OSV name of its registry.
+type sbomLibrary struct {
+	Ecosystem string
+	Name      string
+	Version   string
+	PURL      string
+}
+
+func collectSBOM() []sbomPackage {
+	var pkgs []sbomPackage
+	for _, m := range loadAllManifests() {
+		p := sbomPackage{Manifest: m}
+		p.License, _ = packageLicense(m)
+		for _, bin := range m.Binaries {
+			if digest, err := fileSHA256(bin); err == nil {
+				p.Files = append(p.Files, sbomFile{Path: bin, SHA256: digest})
+			}
+		}
+		p.Libraries = resolvedLibraries(filepath.Join(packagesDir, m.Name))
+		pkgs = append(pkgs, p)
+	}
+	return pkgs
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// purl returns the package URL of an installed package. A local package
+// is not on GitHub, so it gets a generic one.
+func (p sbomPackage) purl() string {
+	purl := "pkg:github/" + strings.ToLower(p.Repo)
+	if p.Source != "" {
+		purl = "pkg:generic/" + strings.ToLower(p.Name)
+	}
+	if p.Commit != "" {
+		purl += "@" + p.Commit
+	}
+	return purl
+}
+
+func (p sbomPackage) version() string {
+	if p.Version != "" {
+		return p.Version
+	}
+	return p.Commit
+}
+
+// resolvedLibraries reads the lock files at the top of a clone.
+func resolvedLibraries(repoPath string) []sbomLibrary {
+	var libs []sbomLibrary
+	libs = append(libs, goSumLibraries(filepath.Join(repoPath, "go.sum"))...)
+	libs = append(libs, cargoLockLibraries(filepath.Join(repoPath, "Cargo.lock"))...)
+	libs = append(libs, npmLockLibraries(filepath.Join(repoPath, "package-lock.json"))...)
+	libs = append(libs, requirementsLibraries(filepath.Join(repoPath, "requirements.txt"))...)
+	return libs
+}
+
+// goSumLibraries lists the modules in go.sum whose code was checksummed,
+// skipping the lines that only cover a go.mod file.
+func goSumLibraries(path string) []sbomLibrary {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var libs []sbomLibrary
+	seen := map[string]bool{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || strings.HasSuffix(fields[1], "/go.mod") {
+			continue
+		}
+		key := fields[0] + "@" + fields[1]
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		libs = append(libs, sbomLibrary{Ecosystem: "Go", Name: fields[0], Version: fields[1], PURL: "pkg:golang/" + fields[0] + "@" + fields[1]})
+	}
+	return libs
+}
+
+var cargoField = regexp.MustCompile(`^(name|version|source)\s*=\s*"([^"]*)"`)
+
+// cargoLockLibraries lists the registry and git packages in Cargo.lock;
+// the workspace's own crates have no source and are left out.
+func cargoLockLibraries(path string) []sbomLibrary {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var libs []sbomLibrary
+	var cur map[string]string
+	flush := func() {
+		if cur != nil && cur["name"] != "" && cur["source"] != "" {
+			libs = append(libs, sbomLibrary{Ecosystem: "crates.io", Name: cur["name"], Version: cur["version"], PURL: "pkg:cargo/" + cur["name"] + "@" + cur["version"]})
+		}
+		cur = nil
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "[") {
+			flush()
+			if line == "[[package]]" {
+				cur = map[string]string{}
+			}
+			continue
+		}
+		if m := cargoField.FindStringSubmatch(line); m != nil && cur != nil {
+			cur[m[1]] = m[2]
+		}
+	}
+	flush()
+	return libs
+}
+
+// npmLockLibraries lists the packages in package-lock.json, from the
+// "packages" map of lockfile v2 and v3 or the "dependencies" tree of v1.
+func npmLockLibraries(path string) []sbomLibrary {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	type npmDep struct {
+		Version      string            `json:"version"`
+		Link         bool              `json:"link"`
+		Dependencies map[string]npmDep `json:"dependencies"`
+	}
+	var lock struct {
+		Packages     map[string]npmDep `json:"packages"`
+		Dependencies map[string]npmDep `json:"dependencies"`
+	}
+	if err := json.Unmarshal(data, &lock); err != nil {
+		return nil
+	}
+	seen := map[string]bool{}
+	var libs []sbomLibrary
+	add := func(name, version string) {
+		key := name + "@" + version
+		if name == "" || version == "" || seen[key] {
+			return
+		}
+		seen[key] = true
+		purlName := strings.Replace(name, "@", "%40", 1)
+		libs = append(libs, sbomLibrary{Ecosystem: "npm", Name: name, Version: version, PURL: "pkg:npm/" + purlName + "@" + version})
+	}
+	if len(lock.Packages) > 0 {
+		for key, dep := range lock.Packages {
+			i := strings.LastIndex(key, "node_modules/")
+			if i < 0 || dep.Link {
+				continue
+			}
+			add(key[i+len("node_modules/"):], dep.Version)
+		}
+	} else {
+		var walk func(deps map[string]npmDep)
+		walk = func(deps map[string]npmDep) {
+			for name, dep := range deps {
+				add(name, dep.Version)
+				walk(dep.Dependencies)
+			}
+		}
+		walk(lock.Dependencies)
+	}
+	sort.Slice(libs, func(i, j int) bool { return libs[i].PURL < libs[j].PURL })
+	return libs
+}
+
+var requirementPin = regexp.MustCompile(`^([A-Za-z0-9][A-Za-z0-9._-]*)(\[[^\]]*\])?\s*===?\s*([^\s;#]+)`)
+
+// requirementsLibraries lists the packages pinned with == in
+// requirements.txt. Unpinned requirements resolve differently on every
+// install and are left out.
+func requirementsLibraries(path string) []sbomLibrary {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil
+	}
+	defer f.Close()
+	var libs []sbomLibrary
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		m := requirementPin.FindStringSubmatch(strings.TrimSpace(scanner.Text()))
+		if m == nil {
+			continue
+		}
+		name := pypiName(m[1])
+		libs = append(libs, sbomLibrary{Ecosystem: "PyPI", Name: name, Version: m[3], PURL: "pkg:pypi/" + name + "@" + m[3]})
+	}
+	return libs
+}
+
+var pypiSeparators = regexp.MustCompile(`[-_.]+`)
+
+// pypiName normalizes a Python package name as PEP 503 does.
+func pypiName(name string) string {
+	return strings.ToLower(pypiSeparators.ReplaceAllString(name, "-"))
+}
+
+// sbomCommand implements "ghpm sbom [--format cyclonedx|spdx] [-o file]".
+func sbomCommand(format, output string) error {
+	var doc any
+	switch format {
+	case "cyclonedx":
+		doc = cycloneDXDocument(collectSBOM())
+	case "spdx":
+		doc = spdxDocument(collectSBOM())
+	default:
+		return usageError("unknown SBOM format %s (formats: %s)", format, strings.Join(sbomFormats, ", "))
+	}
+	data, err := json.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	if output == "" || output == "-" {
+		_, err := resultOut.Write(data)
+		return err
+	}
+	if err := writeFileAtomic(output, data, 0644); err != nil {
+		return fmt.Errorf("failed to write %s: %v", output, err)
+	}
+	fmt.Println("Wrote", output)
+	return nil
+}
+
+func newUUID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+func ghpmVersion() string {
+	v := strings.TrimPrefix(versionString(), "ghpm ")
+	v, _, _ = strings.Cut(v, " ")
+	return v
+}
+
+func sbomHost() string {
+	host, err := os.Hostname()
+	if err != nil {
+		return "localhost"
+	}
+	return host
+}
+
+// CycloneDX 1.5
+
+type cdxDocument struct {
+	BOMFormat    string          `json:"bomFormat"`
+	SpecVersion  string          `json:"specVersion"`
+	SerialNumber string          `json:"serialNumber"`
+	Version      int             `json:"version"`
+	Metadata     cdxMetadata     `json:"metadata"`
+	Components   []cdxComponent  `json:"components"`
+	Dependencies []cdxDependency `json:"dependencies"`
+}
+
+type cdxMetadata struct {
+	Timestamp string `json:"timestamp"`
+	Tools     struct {
+		Components []cdxComponent `json:"components"`
+	} `json:"tools"`
+	Component *cdxComponent `json:"component,omitempty"`
+}
+
+type cdxComponent struct {
+	Type               string           `json:"type"`
+	BOMRef             string           `json:"bom-ref,omitempty"`
+	Name               string           `json:"name"`
+	Version            string           `json:"version,omitempty"`
+	PURL               string           `json:"purl,omitempty"`
+	Hashes             []cdxHash        `json:"hashes,omitempty"`
+	Licenses           []cdxLicense     `json:"licenses,omitempty"`
+	ExternalReferences []cdxExternalRef `json:"externalReferences,omitempty"`
+	Properties         []cdxProperty    `json:"properties,omitempty"`
+	Components         []cdxComponent   `json:"components,omitempty"`
+}
+
+type cdxHash struct {
+	Alg     string `json:"alg"`
+	Content string `json:"content"`
+}
+
+type cdxLicense struct {
+	License *struct {
+		ID string `json:"id"`
+	} `json:"license,omitempty"`
+	Expression string `json:"expression,omitempty"`
+}
+
+type cdxExternalRef struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+}
+
+type cdxProperty struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type cdxDependency struct {
+	Ref       string   `json:"ref"`
+	DependsOn []string `json:"dependsOn"`
+}
+
+func cdxLicenses(license string) []cdxLicense {
+	ids := licenseIDs(license)
+	switch {
+	case license == "" || license == noAssertion:
+		return nil
+	case len(ids) == 1:
+		l := cdxLicense{License: &struct {
+			ID string `json:"id"`
+		}{ID: ids[0]}}
+		return []cdxLicense{l}
+	default:
+		return []cdxLicense{{Expression: license}}
+	}
+}
+
+func cycloneDXDocument(pkgs []sbomPackage) cdxDocument {
+	doc := cdxDocument{
+		BOMFormat:    "CycloneDX",
+		SpecVersion:  "1.5",
+		SerialNumber: "urn:uuid:" + newUUID(),
+		Version:      1,
+		Components:   []cdxComponent{},
+		Dependencies: []cdxDependency{},
+	}
+	doc.Metadata.Timestamp = time.Now().UTC().Format(time.RFC3339)
+	doc.Metadata.Tools.Components = []cdxComponent{{Type: "application", Name: "ghpm", Version: ghpmVersion()}}
+	doc.Metadata.Component = &cdxComponent{Type: "device", Name: sbomHost()}
+
+	refs := map[string]string{}
+	for _, p := range pkgs {
+		refs[strings.ToLower(p.Repo)] = p.purl()
+	}
+	libRefs := map[string]bool{}
+	for _, p := range pkgs {
+		c := cdxComponent{
+			Type:     "application",
+			BOMRef:   p.purl(),
+			Name:     p.Name,
+			Version:  p.version(),
+			PURL:     p.purl(),
+			Licenses: cdxLicenses(p.License),
+			ExternalReferences: []cdxExternalRef{
+				{Type: "vcs", URL: p.URL},
+			},
+			Properties: []cdxProperty{
+				{Name: "ghpm:repo", Value: p.Repo},
+				{Name: "ghpm:commit", Value: p.Commit},
+				{Name: "ghpm:installed_at", Value: p.InstalledAt.UTC().Format(time.RFC3339)},
+			},
+		}
+		if p.Source == "" {
+			c.ExternalReferences = append(c.ExternalReferences, cdxExternalRef{Type: "website", URL: "https://github.com/" + p.Repo})
+		}
+		for _, f := range p.Files {
+			c.Components = append(c.Components, cdxComponent{
+				Type:   "file",
+				BOMRef: p.purl() + "#" + f.Path,
+				Name:   f.Path,
+				Hashes: []cdxHash{{Alg: "SHA-256", Content: f.SHA256}},
+			})
+		}
+		dep := cdxDependency{Ref: p.purl(), DependsOn: []string{}}
+		for _, raw := range p.Depends {
+			if d, err := parseDependency(raw); err == nil && refs[strings.ToLower(d.Repo)] != "" {
+				dep.DependsOn = append(dep.DependsOn, refs[strings.ToLower(d.Repo)])
+			}
+		}
+		for _, lib := range p.Libraries {
+			dep.DependsOn = append(dep.DependsOn, lib.PURL)
+			if libRefs[lib.PURL] {
+				continue
+			}
+			libRefs[lib.PURL] = true
+			doc.Components = append(doc.Components, cdxComponent{
+				Type:    "library",
+				BOMRef:  lib.PURL,
+				Name:    lib.Name,
+				Version: lib.Version,
+				PURL:    lib.PURL,
+			})
+		}
+		doc.Components = append(doc.Components, c)
+		doc.Dependencies = append(doc.Dependencies, dep)
+	}
+	return doc
+}
+
+// SPDX 2.3
+
+type spdxDoc struct {
+	SPDXVersion       string             `json:"spdxVersion"`
+	DataLicense       string             `json:"dataLicense"`
+	SPDXID            string             `json:"SPDXID"`
+	Name              string             `json:"name"`
+	DocumentNamespace string             `json:"documentNamespace"`
+	CreationInfo      spdxCreationInfo   `json:"creationInfo"`
+	Packages          []spdxPackage      `json:"packages"`
+	Files             []spdxFile         `json:"files"`
+	Relationships     []spdxRelationship `json:"relationships"`
+}
+
+type spdxCreationInfo struct {
+	Created  string   `json:"created"`
+	Creators []string `json:"creators"`
+}
+
+type spdxPackage struct {
+	Name             string            `json:"name"`
+	SPDXID           string            `json:"SPDXID"`
+	VersionInfo      string            `json:"versionInfo,omitempty"`
+	DownloadLocation string            `json:"downloadLocation"`
+	FilesAnalyzed    bool              `json:"filesAnalyzed"`
+	LicenseConcluded string            `json:"licenseConcluded"`
+	LicenseDeclared  string            `json:"licenseDeclared"`
+	CopyrightText    string            `json:"copyrightText"`
+	ExternalRefs     []spdxExternalRef `json:"externalRefs,omitempty"`
+}
+
+type spdxExternalRef struct {
+	ReferenceCategory string `json:"referenceCategory"`
+	ReferenceType     string `json:"referenceType"`
+	ReferenceLocator  string `json:"referenceLocator"`
+}
+
+type spdxFile struct {
+	FileName           string         `json:"fileName"`
+	SPDXID             string         `json:"SPDXID"`
+	Checksums          []spdxChecksum `json:"checksums"`
+	LicenseConcluded   string         `json:"licenseConcluded"`
+	CopyrightText      string         `json:"copyrightText"`
+	LicenseInfoInFiles []string       `json:"licenseInfoInFiles"`
+}
+
+type spdxChecksum struct {
+	Algorithm     string `json:"algorithm"`
+	ChecksumValue string `json:"checksumValue"`
+}
+
+type spdxRelationship struct {
+	Element string `json:"spdxElementId"`
+	Type    string `json:"relationshipType"`
+	Related string `json:"relatedSpdxElement"`
+}
+
+var spdxIDChars = regexp.MustCompile(`[^A-Za-z0-9.-]+`)
+
+func spdxID(kind, name string) string {
+	return "SPDXRef-" + kind + "-" + strings.Trim(spdxIDChars.ReplaceAllString(name, "-"), "-")
+}
+
+// libraryID returns the SPDX ID of a library. Replacing the characters IDs
+// cannot hold makes names such as @a/b and a-b alike, so the readable part
+// is followed by a hash of the PURL, which also names the ecosystem.
+func libraryID(lib sbomLibrary) string {
+	sum := sha256.Sum256([]byte(lib.PURL))
+	return spdxID("Library", lib.Ecosystem+"-"+lib.Name+"-"+lib.Version+"-"+hex.EncodeToString(sum[:4]))
+}
+
+func spdxLicense(license string) string {
+	switch license {
+	case "":
+		return "NONE"
+	case noAssertion:
+		return noAssertion
+	}
+	return license
+}
+
+func spdxDocument(pkgs []sbomPackage) spdxDoc {
+	host := sbomHost()
+	doc := spdxDoc{
+		SPDXVersion:       "SPDX-2.3",
+		DataLicense:       "CC0-1.0",
+		SPDXID:            "SPDXRef-DOCUMENT",
+		Name:              "ghpm packages on " + host,
+		DocumentNamespace: "https://spdx.org/spdxdocs/ghpm-" + spdxIDChars.ReplaceAllString(host, "-") + "-" + newUUID(),
+		CreationInfo: spdxCreationInfo{
+			Created:  time.Now().UTC().Format(time.RFC3339),
+			Creators: []string{"Tool: ghpm-" + ghpmVersion()},
+		},
+		Packages:      []spdxPackage{},
+		Files:         []spdxFile{},
+		Relationships: []spdxRelationship{},
+	}
+
+	ids := map[string]string{}
+	for _, p := range pkgs {
+		ids[strings.ToLower(p.Repo)] = spdxID("Package", p.Name)
+	}
+	libIDs := map[string]bool{}
+	for _, p := range pkgs {
+		id := spdxID("Package", p.Name)
+		location := "git+" + p.URL
+		if p.Commit != "" {
+			location += "@" + p.Commit
+		}
+		doc.Packages = append(doc.Packages, spdxPackage{
+			Name:             p.Name,
+			SPDXID:           id,
+			VersionInfo:      p.version(),
+			DownloadLocation: location,
+			LicenseConcluded: noAssertion,
+			LicenseDeclared:  spdxLicense(p.License),
+			CopyrightText:    noAssertion,
+			ExternalRefs: []spdxExternalRef{
+				{ReferenceCategory: "PACKAGE-MANAGER", ReferenceType: "purl", ReferenceLocator: p.purl()},
+			},
+		})
+		doc.Relationships = append(doc.Relationships, spdxRelationship{Element: "SPDXRef-DOCUMENT", Type: "DESCRIBES", Related: id})
+
+		for _, f := range p.Files {
+			fileID := spdxID("File", p.Name+"-"+filepath.Base(f.Path))
+			doc.Files = append(doc.Files, spdxFile{
+				FileName:           f.Path,
+				SPDXID:             fileID,
+				Checksums:          []spdxChecksum{{Algorithm: "SHA256", ChecksumValue: f.SHA256}},
+				LicenseConcluded:   noAssertion,
+				CopyrightText:      noAssertion,
+				LicenseInfoInFiles: []string{noAssertion},
+			})
+			doc.Relationships = append(doc.Relationships, spdxRelationship{Element: id, Type: "CONTAINS", Related: fileID})
+		}
+		for _, raw := range p.Depends {
+			if d, err := parseDependency(raw); err == nil && ids[strings.ToLower(d.Repo)] != "" {
+				doc.Relationships = append(doc.Relationships, spdxRelationship{Element: id, Type: "DEPENDS_ON", Related: ids[strings.ToLower(d.Repo)]})
+			}
+		}
+		for _, lib := range p.Libraries {
+			libID := libraryID(lib)
+			if !libIDs[libID] {
+				libIDs[libID] = true
+				doc.Packages = append(doc.Packages, spdxPackage{
+					Name:             lib.Name,
+					SPDXID:           libID,
+					VersionInfo:      lib.Version,
+					DownloadLocation: noAssertion,
+					LicenseConcluded: noAssertion,
+					LicenseDeclared:  noAssertion,
+					CopyrightText:    noAssertion,
+					ExternalRefs: []spdxExternalRef{
+						{ReferenceCategory: "PACKAGE-MANAGER", ReferenceType: "purl", ReferenceLocator: lib.PURL},
+					},
+				})
+			}
+			doc.Relationships = append(doc.Relationships, spdxRelationship{Element: id, Type: "DEPENDS_ON", Related: libID})
+		}
+	}
+	return doc
+}
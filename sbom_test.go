@@ -0,0 +1,167 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeTemp writes data to a file named name in a new temporary directory
+// and returns its path.
+func writeTemp(t *testing.T, name, data string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func libraryPURLs(libs []sbomLibrary) []string {
+	var purls []string
+	for _, l := range libs {
+		purls = append(purls, l.PURL)
+	}
+	return purls
+}
+
+func TestSPDXLibraryIDs(t *testing.T) {
+	libs := []sbomLibrary{
+		{Ecosystem: "npm", Name: "a-b", Version: "1.0.0", PURL: "pkg:npm/a-b@1.0.0"},
+		{Ecosystem: "npm", Name: "@a/b", Version: "1.0.0", PURL: "pkg:npm/%40a/b@1.0.0"},
+		{Ecosystem: "PyPI", Name: "a-b", Version: "1.0.0", PURL: "pkg:pypi/a-b@1.0.0"},
+		{Ecosystem: "Go", Name: "example.com/a/b", Version: "v1.0.0", PURL: "pkg:golang/example.com/a/b@v1.0.0"},
+		{Ecosystem: "Go", Name: "example.com/a-b", Version: "v1.0.0", PURL: "pkg:golang/example.com/a-b@v1.0.0"},
+	}
+	pkgs := []sbomPackage{
+		{Manifest: Manifest{Name: "one", Repo: "own/one"}, Libraries: libs},
+		{Manifest: Manifest{Name: "two", Repo: "own/two"}, Libraries: libs[:1]},
+	}
+	doc := spdxDocument(pkgs)
+
+	ids := map[string]bool{}
+	libraries := 0
+	for _, p := range doc.Packages {
+		if ids[p.SPDXID] {
+			t.Errorf("duplicate SPDX ID %s", p.SPDXID)
+		}
+		ids[p.SPDXID] = true
+		if p.Name != "one" && p.Name != "two" {
+			libraries++
+		}
+	}
+	if libraries != len(libs) {
+		t.Errorf("%d library packages, want %d (shared ones listed once)", libraries, len(libs))
+	}
+	for _, r := range doc.Relationships {
+		if r.Element != "SPDXRef-DOCUMENT" && !ids[r.Related] {
+			t.Errorf("relationship to unknown %s", r.Related)
+		}
+	}
+}
+
+func TestGoSumLibraries(t *testing.T) {
+	path := writeTemp(t, "go.sum", `golang.org/x/net v0.1.0 h1:abc=
+golang.org/x/net v0.1.0/go.mod h1:def=
+golang.org/x/text v0.3.0/go.mod h1:ghi=
+github.com/Some/Mod v1.2.3-pre h1:jkl=
+github.com/Some/Mod v1.2.3-pre h1:jkl=
+
+broken
+`)
+	libs := goSumLibraries(path)
+	want := []string{"pkg:golang/golang.org/x/net@v0.1.0", "pkg:golang/github.com/Some/Mod@v1.2.3-pre"}
+	if got := libraryPURLs(libs); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if libs[0].Ecosystem != "Go" || libs[0].Name != "golang.org/x/net" || libs[0].Version != "v0.1.0" {
+		t.Errorf("first library %+v", libs[0])
+	}
+	if goSumLibraries(filepath.Join(t.TempDir(), "missing")) != nil {
+		t.Error("a missing go.sum gave libraries")
+	}
+}
+
+func TestCargoLockLibraries(t *testing.T) {
+	path := writeTemp(t, "Cargo.lock", `# This file is automatically @generated by Cargo.
+version = 3
+
+[[package]]
+name = "mytool"
+version = "0.1.0"
+dependencies = [
+ "serde",
+]
+
+[[package]]
+name = "serde"
+version = "1.0.200"
+source = "registry+https://github.com/rust-lang/crates.io-index"
+checksum = "abc"
+
+[[package]]
+name = "forked"
+version = "0.2.0"
+source = "git+https://github.com/own/forked#0123456"
+
+[metadata]
+name = "not-a-package"
+source = "x"
+`)
+	libs := cargoLockLibraries(path)
+	want := []string{"pkg:cargo/serde@1.0.200", "pkg:cargo/forked@0.2.0"}
+	if got := libraryPURLs(libs); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+	if libs[0].Ecosystem != "crates.io" {
+		t.Errorf("ecosystem %q", libs[0].Ecosystem)
+	}
+}
+
+func TestNPMLockLibraries(t *testing.T) {
+	v3 := writeTemp(t, "package-lock.json", `{
+  "lockfileVersion": 3,
+  "packages": {
+    "": {"name": "mytool", "version": "1.0.0"},
+    "node_modules/left-pad": {"version": "1.3.0"},
+    "node_modules/@scope/pkg": {"version": "2.0.0"},
+    "node_modules/@scope/pkg/node_modules/left-pad": {"version": "1.1.0"},
+    "node_modules/linked": {"resolved": "../linked", "link": true},
+    "packages/workspace": {"version": "0.0.1"}
+  }
+}`)
+	want := []string{"pkg:npm/%40scope/pkg@2.0.0", "pkg:npm/left-pad@1.1.0", "pkg:npm/left-pad@1.3.0"}
+	if got := libraryPURLs(npmLockLibraries(v3)); !reflect.DeepEqual(got, want) {
+		t.Errorf("v3: got %v, want %v", got, want)
+	}
+
+	v1 := writeTemp(t, "package-lock.json", `{
+  "lockfileVersion": 1,
+  "dependencies": {
+    "left-pad": {"version": "1.3.0"},
+    "@scope/pkg": {"version": "2.0.0", "dependencies": {"left-pad": {"version": "1.1.0"}}}
+  }
+}`)
+	if got := libraryPURLs(npmLockLibraries(v1)); !reflect.DeepEqual(got, want) {
+		t.Errorf("v1: got %v, want %v", got, want)
+	}
+
+	if npmLockLibraries(writeTemp(t, "package-lock.json", "not json")) != nil {
+		t.Error("invalid JSON gave libraries")
+	}
+}
+
+func TestRequirementsLibraries(t *testing.T) {
+	path := writeTemp(t, "requirements.txt", `# pinned
+Requests==2.31.0
+zope.interface[test] === 6.0 ; python_version >= "3.8"
+Flask_SQLAlchemy==3.1.1  # comment
+unpinned>=1.0
+-r other.txt
+`)
+	want := []string{"pkg:pypi/requests@2.31.0", "pkg:pypi/zope-interface@6.0", "pkg:pypi/flask-sqlalchemy@3.1.1"}
+	if got := libraryPURLs(requirementsLibraries(path)); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
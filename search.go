@@ -0,0 +1,133 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// searchOptions narrows a GitHub repository search and says how a result
+// is chosen without asking.
+type searchOptions struct {
+	Language string
+	Topic    string
+	MinStars int
+	Sort     string
+	Order    string
+	Limit    int
+	Page     int
+
+	// Pick chooses the nth result. Owners chooses the first result owned
+	// by the earliest listed owner, before Pick is considered.
+	Pick   int
+	Owners []string
+}
+
+var searchSorts = []string{"best-match", "stars", "forks", "updated", "help-wanted-issues"}
+
+// searchFlags defines the search filters on fs. The returned function gives
+// the search options once fs is parsed.
+func searchFlags(fs *flag.FlagSet) func() (searchOptions, error) {
+	var o searchOptions
+	fs.StringVar(&o.Language, "language", "", "only repositories in this `language`")
+	fs.StringVar(&o.Topic, "topic", "", "only repositories with this `topic`")
+	fs.IntVar(&o.MinStars, "stars", 0, "only repositories with at least `n` stars")
+	fs.StringVar(&o.Sort, "sort", "best-match", "sort by `field`: "+strings.Join(searchSorts, ", "))
+	fs.StringVar(&o.Order, "order", "desc", "sort `order`: asc or desc")
+	fs.IntVar(&o.Limit, "limit", 10, "show at most `n` results (up to 100)")
+	fs.IntVar(&o.Page, "page", 1, "show page `n` of the results")
+	fs.IntVar(&o.Pick, "pick", 0, "install result `n` without asking")
+	owners := fs.String("owner-preference", "", "install the first result owned by one of these comma-separated `owners`, without asking")
+	return func() (searchOptions, error) {
+		for _, owner := range strings.Split(*owners, ",") {
+			if owner = strings.TrimSpace(owner); owner != "" {
+				o.Owners = append(o.Owners, owner)
+			}
+		}
+		if !contains(searchSorts, o.Sort) {
+			return o, usageError("unknown sort %s (sorts: %s)", o.Sort, strings.Join(searchSorts, ", "))
+		}
+		if o.Order != "asc" && o.Order != "desc" {
+			return o, usageError("--order wants asc or desc, got %q", o.Order)
+		}
+		if o.Limit < 1 || o.Limit > 100 {
+			return o, usageError("--limit wants a number from 1 to 100, got %d", o.Limit)
+		}
+		if o.Page < 1 {
+			return o, usageError("--page wants a positive number, got %d", o.Page)
+		}
+		if o.Pick < 0 || o.MinStars < 0 {
+			return o, usageError("--pick and --stars cannot be negative")
+		}
+		return o, nil
+	}
+}
+
+func contains(items []string, s string) bool {
+	for _, item := range items {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
+
+// searchPath builds the search API path for query, with the filters added
+// as search qualifiers and every parameter URL-encoded.
+func searchPath(query string, o searchOptions) string {
+	q := []string{query}
+	if o.Language != "" {
+		q = append(q, "language:"+qualifierValue(o.Language))
+	}
+	if o.Topic != "" {
+		q = append(q, "topic:"+qualifierValue(o.Topic))
+	}
+	if o.MinStars > 0 {
+		q = append(q, "stars:>="+strconv.Itoa(o.MinStars))
+	}
+	params := url.Values{}
+	params.Set("q", strings.Join(q, " "))
+	params.Set("per_page", strconv.Itoa(o.Limit))
+	params.Set("page", strconv.Itoa(o.Page))
+	if o.Sort != "best-match" {
+		params.Set("sort", o.Sort)
+		params.Set("order", o.Order)
+	}
+	return "/search/repositories?" + params.Encode()
+}
+
+// qualifierValue quotes a qualifier value containing spaces, such as a
+// language name like "Visual Basic".
+func qualifierValue(v string) string {
+	if strings.ContainsAny(v, " \t") {
+		return `"` + v + `"`
+	}
+	return v
+}
+
+// chooseResult returns the result picked by --owner-preference or --pick,
+// or nil when neither applies and the user should be asked.
+func chooseResult(results []ghRepoItem, o searchOptions) (*ghRepoItem, error) {
+	for _, owner := range o.Owners {
+		for i, r := range results {
+			if resultOwner, _, _ := strings.Cut(r.FullName, "/"); strings.EqualFold(resultOwner, owner) {
+				fmt.Printf("Picked %s (preferred owner %s)\n", r.FullName, owner)
+				return &results[i], nil
+			}
+		}
+	}
+	if o.Pick == 0 {
+		if len(o.Owners) > 0 {
+			fmt.Println("No result is owned by", strings.Join(o.Owners, ", "))
+		}
+		return nil, nil
+	}
+	if o.Pick > len(results) {
+		return nil, usageError("--pick %d is out of range; the search returned %d results", o.Pick, len(results))
+	}
+	r := &results[o.Pick-1]
+	fmt.Printf("Picked %d) %s\n", o.Pick, r.FullName)
+	return r, nil
+}
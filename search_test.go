@@ -0,0 +1,66 @@
+package main
+
+import (
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestSearchPath(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		opts  searchOptions
+		want  url.Values
+	}{
+		{
+			name:  "defaults",
+			query: "btop",
+			opts:  searchOptions{Sort: "best-match", Order: "desc", Limit: 10, Page: 1},
+			want:  url.Values{"q": {"btop"}, "per_page": {"10"}, "page": {"1"}},
+		},
+		{
+			name:  "filters become qualifiers",
+			query: "file manager",
+			opts:  searchOptions{Language: "rust", Topic: "tui", MinStars: 500, Sort: "best-match", Limit: 5, Page: 2},
+			want:  url.Values{"q": {"file manager language:rust topic:tui stars:>=500"}, "per_page": {"5"}, "page": {"2"}},
+		},
+		{
+			name:  "language with a space is quoted",
+			query: "x",
+			opts:  searchOptions{Language: "Visual Basic", Sort: "best-match", Limit: 10, Page: 1},
+			want:  url.Values{"q": {`x language:"Visual Basic"`}, "per_page": {"10"}, "page": {"1"}},
+		},
+		{
+			name:  "sort and order",
+			query: "x",
+			opts:  searchOptions{Sort: "stars", Order: "asc", Limit: 100, Page: 3},
+			want:  url.Values{"q": {"x"}, "per_page": {"100"}, "page": {"3"}, "sort": {"stars"}, "order": {"asc"}},
+		},
+		{
+			name:  "special characters are encoded",
+			query: "c++ & go",
+			opts:  searchOptions{Sort: "best-match", Limit: 10, Page: 1},
+			want:  url.Values{"q": {"c++ & go"}, "per_page": {"10"}, "page": {"1"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := searchPath(tt.query, tt.opts)
+			base, rawQuery, ok := strings.Cut(path, "?")
+			if !ok || base != "/search/repositories" {
+				t.Fatalf("path %q", path)
+			}
+			if strings.Contains(rawQuery, " ") || strings.Count(rawQuery, "&") != len(tt.want)-1 {
+				t.Errorf("query %q is not fully encoded", rawQuery)
+			}
+			got, err := url.ParseQuery(rawQuery)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Encode() != tt.want.Encode() {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
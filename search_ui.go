@@ -0,0 +1,431 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The search browser lists results full screen. Typing filters them, the
+// arrow keys move, Tab marks several for installation and Enter installs the
+// marked ones (or the highlighted one). Details of the highlighted result,
+// its latest release and README are fetched in the background and shown
+// below the list.
+
+var errSearchCancelled = errors.New("search cancelled")
+
+// canBrowse reports whether the search browser can be used: both ends of
+// the conversation must be a terminal.
+func canBrowse() bool {
+	return isTerminal(os.Stdin) && isTerminal(os.Stdout) && os.Getenv("TERM") != "dumb"
+}
+
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	return err == nil && info.Mode()&os.ModeCharDevice != 0
+}
+
+// repoDetails is what the preview pane shows beyond the search result.
+type repoDetails struct {
+	Repo    string
+	Release string
+	Readme  []string
+}
+
+type searchBrowser struct {
+	query    string
+	results  []ghRepoItem
+	filter   []rune
+	visible  []int // indexes into results matching filter
+	cursor   int   // index into visible
+	offset   int   // first row of visible shown
+	marked   map[int]bool
+	details  map[string]*repoDetails
+	fetching map[string]bool
+	out      *bufio.Writer
+}
+
+// browseResults shows the browser and returns the results chosen. It
+// returns errSearchCancelled when the user leaves without choosing.
+func browseResults(query string, results []ghRepoItem) ([]ghRepoItem, error) {
+	fd := int(os.Stdin.Fd())
+	restore, err := makeRaw(fd)
+	if err != nil {
+		return nil, err
+	}
+	b := &searchBrowser{
+		query:    query,
+		results:  results,
+		marked:   map[int]bool{},
+		details:  map[string]*repoDetails{},
+		fetching: map[string]bool{},
+		out:      bufio.NewWriter(os.Stdout),
+	}
+	b.applyFilter()
+
+	// Alternate screen, cursor hidden.
+	fmt.Fprint(os.Stdout, "\x1b[?1049h\x1b[?25l")
+	defer func() {
+		fmt.Fprint(os.Stdout, "\x1b[?25h\x1b[?1049l")
+		restore()
+	}()
+
+	done := make(chan struct{})
+	defer close(done)
+	keys := make(chan []byte)
+	go readKeys(keys, done)
+	loaded := make(chan *repoDetails)
+
+	for {
+		b.fetchHighlighted(loaded, done)
+		b.draw()
+		select {
+		case input, ok := <-keys:
+			if !ok {
+				return nil, errSearchCancelled
+			}
+			chosen, finished := b.handleInput(input)
+			if finished {
+				if chosen == nil {
+					return nil, errSearchCancelled
+				}
+				return chosen, nil
+			}
+		case d := <-loaded:
+			b.details[d.Repo] = d
+		}
+	}
+}
+
+// readKeys sends terminal input to keys until done is closed. The terminal
+// is in raw mode with a read timeout, so reads return regularly and the
+// loop notices done.
+func readKeys(keys chan<- []byte, done <-chan struct{}) {
+	buf := make([]byte, 256)
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		n, err := os.Stdin.Read(buf)
+		if n > 0 {
+			select {
+			case keys <- append([]byte(nil), buf[:n]...):
+			case <-done:
+				return
+			}
+		}
+		if err != nil && err != io.EOF {
+			close(keys)
+			return
+		}
+	}
+}
+
+// handleInput applies the keys in input. It returns finished when the user
+// confirmed or cancelled, with the chosen results on confirmation.
+func (b *searchBrowser) handleInput(input []byte) (chosen []ghRepoItem, finished bool) {
+	for len(input) > 0 {
+		switch {
+		case hasPrefix(input, "\x1b[A"), hasPrefix(input, "\x1bOA"):
+			b.move(-1)
+			input = input[3:]
+			continue
+		case hasPrefix(input, "\x1b[B"), hasPrefix(input, "\x1bOB"):
+			b.move(1)
+			input = input[3:]
+			continue
+		case hasPrefix(input, "\x1b[5~"):
+			b.move(-b.listHeight())
+			input = input[4:]
+			continue
+		case hasPrefix(input, "\x1b[6~"):
+			b.move(b.listHeight())
+			input = input[4:]
+			continue
+		case input[0] == 0x1b && len(input) > 1 && (input[1] == '[' || input[1] == 'O'):
+			// An escape sequence we do not use: skip to its final byte.
+			i := 2
+			for i < len(input) && (input[i] < 0x40 || input[i] > 0x7e) {
+				i++
+			}
+			input = input[min(i+1, len(input)):]
+			continue
+		}
+
+		r, size := utf8.DecodeRune(input)
+		input = input[size:]
+		switch r {
+		case 0x1b, 0x03, 0x07: // Esc, Ctrl-C, Ctrl-G
+			return nil, true
+		case '\r', '\n':
+			return b.chosen(), true
+		case 0x10: // Ctrl-P
+			b.move(-1)
+		case 0x0e: // Ctrl-N
+			b.move(1)
+		case '\t':
+			if len(b.visible) > 0 {
+				i := b.visible[b.cursor]
+				if b.marked[i] {
+					delete(b.marked, i)
+				} else {
+					b.marked[i] = true
+				}
+				b.move(1)
+			}
+		case 0x7f, 0x08: // Backspace
+			if len(b.filter) > 0 {
+				b.filter = b.filter[:len(b.filter)-1]
+				b.applyFilter()
+			}
+		case 0x15: // Ctrl-U
+			b.filter = nil
+			b.applyFilter()
+		default:
+			if unicode.IsPrint(r) {
+				b.filter = append(b.filter, r)
+				b.applyFilter()
+			}
+		}
+	}
+	return nil, false
+}
+
+func hasPrefix(input []byte, prefix string) bool {
+	return strings.HasPrefix(string(input), prefix)
+}
+
+// chosen returns the marked results, or the highlighted one when none are
+// marked.
+func (b *searchBrowser) chosen() []ghRepoItem {
+	var chosen []ghRepoItem
+	for i, r := range b.results {
+		if b.marked[i] {
+			chosen = append(chosen, r)
+		}
+	}
+	if len(chosen) == 0 && len(b.visible) > 0 {
+		chosen = append(chosen, b.results[b.visible[b.cursor]])
+	}
+	return chosen
+}
+
+func (b *searchBrowser) move(delta int) {
+	b.cursor = max(0, min(b.cursor+delta, len(b.visible)-1))
+}
+
+// applyFilter keeps the results whose name or description contains the
+// filter's characters in order, ignoring case.
+func (b *searchBrowser) applyFilter() {
+	b.visible = b.visible[:0]
+	for i, r := range b.results {
+		if fuzzyMatch(r.FullName+" "+r.Description, string(b.filter)) {
+			b.visible = append(b.visible, i)
+		}
+	}
+	b.cursor, b.offset = 0, 0
+}
+
+func fuzzyMatch(text, pattern string) bool {
+	text = strings.ToLower(text)
+	for _, r := range strings.ToLower(pattern) {
+		i := strings.IndexRune(text, r)
+		if i < 0 {
+			return false
+		}
+		text = text[i+utf8.RuneLen(r):]
+	}
+	return true
+}
+
+// fetchHighlighted starts loading the details of the highlighted result
+// unless they are known or on their way.
+func (b *searchBrowser) fetchHighlighted(loaded chan<- *repoDetails, done <-chan struct{}) {
+	if len(b.visible) == 0 {
+		return
+	}
+	repo := b.results[b.visible[b.cursor]].FullName
+	if b.fetching[repo] {
+		return
+	}
+	b.fetching[repo] = true
+	go func() {
+		d := fetchRepoDetails(repo)
+		select {
+		case loaded <- d:
+		case <-done:
+		}
+	}()
+}
+
+func fetchRepoDetails(repo string) *repoDetails {
+	d := &repoDetails{Repo: repo, Release: "none"}
+	var release struct {
+		TagName     string    `json:"tag_name"`
+		PublishedAt time.Time `json:"published_at"`
+	}
+	if err := githubGet("/repos/"+repo+"/releases/latest", &release); err == nil {
+		d.Release = release.TagName + " (" + release.PublishedAt.Format("2006-01-02") + ")"
+	} else if !strings.Contains(err.Error(), "404") {
+		d.Release = "unavailable"
+	}
+
+	var readme struct {
+		Content  string `json:"content"`
+		Encoding string `json:"encoding"`
+	}
+	if err := githubGet("/repos/"+repo+"/readme", &readme); err == nil && readme.Encoding == "base64" {
+		data, err := base64.StdEncoding.DecodeString(strings.ReplaceAll(readme.Content, "\n", ""))
+		if err == nil {
+			d.Readme = strings.Split(strings.ReplaceAll(string(data), "\r", ""), "\n")
+		}
+	}
+	return d
+}
+
+func (b *searchBrowser) size() (int, int) {
+	w, h, err := terminalSize(int(os.Stdout.Fd()))
+	if err != nil || w < 20 || h < 10 {
+		return 80, 24
+	}
+	return w, h
+}
+
+// listHeight is the number of result rows: up to half the screen below
+// the two header lines.
+func (b *searchBrowser) listHeight() int {
+	_, h := b.size()
+	return max(3, min(len(b.results), (h-3)/2))
+}
+
+func (b *searchBrowser) draw() {
+	w, h := b.size()
+	rows := b.listHeight()
+	if b.cursor < b.offset {
+		b.offset = b.cursor
+	}
+	if b.cursor >= b.offset+rows {
+		b.offset = b.cursor - rows + 1
+	}
+
+	b.out.WriteString("\x1b[H\x1b[2J")
+	b.line(w, fmt.Sprintf("Search: %s — ↑/↓ move, type to filter, Tab mark, Enter install, Esc cancel", b.query), "\x1b[1m")
+	b.line(w, fmt.Sprintf("> %s   (%d/%d, %d marked)", string(b.filter), len(b.visible), len(b.results), len(b.marked)), "")
+	for row := 0; row < rows; row++ {
+		i := b.offset + row
+		if i >= len(b.visible) {
+			b.line(w, "", "")
+			continue
+		}
+		r := b.results[b.visible[i]]
+		mark := "[ ]"
+		if b.marked[b.visible[i]] {
+			mark = "[x]"
+		}
+		text := fmt.Sprintf("%s %s  ★%d  %s  pushed %s", mark, r.FullName, r.StargazersCount, r.language(), formatDate(r.PushedAt))
+		if r.Archived {
+			text += "  archived"
+		}
+		style := ""
+		if i == b.cursor {
+			style = "\x1b[7m"
+		}
+		b.line(w, text, style)
+	}
+	b.line(w, strings.Repeat("─", w), "\x1b[2m")
+
+	preview := b.preview()
+	for i := 0; i < h-rows-3 && i < len(preview); i++ {
+		b.line(w, preview[i], "")
+	}
+	b.out.Flush()
+}
+
+// line writes text cut to the screen width, in style.
+func (b *searchBrowser) line(width int, text, style string) {
+	text = strings.Map(func(r rune) rune {
+		if r == '\t' {
+			return ' '
+		}
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, text)
+	if utf8.RuneCountInString(text) > width {
+		text = string([]rune(text)[:width-1]) + "…"
+	}
+	if style != "" {
+		text = style + text + "\x1b[0m"
+	}
+	b.out.WriteString(text + "\n")
+}
+
+func (b *searchBrowser) preview() []string {
+	if len(b.visible) == 0 {
+		return []string{"No results match the filter."}
+	}
+	r := b.results[b.visible[b.cursor]]
+	lines := []string{r.FullName}
+	if r.Description != "" {
+		lines = append(lines, r.Description)
+	}
+	facts := []string{
+		fmt.Sprintf("★ %d", r.StargazersCount),
+		r.language(),
+		"license " + r.license(),
+		"last push " + formatDate(r.PushedAt),
+	}
+	d := b.details[r.FullName]
+	if d != nil {
+		facts = append(facts, "latest release "+d.Release)
+	}
+	if r.Archived {
+		facts = append(facts, "ARCHIVED")
+	}
+	lines = append(lines, strings.Join(facts, " · "), "")
+	switch {
+	case d == nil:
+		lines = append(lines, "Loading README…")
+	case len(d.Readme) == 0:
+		lines = append(lines, "No README.")
+	default:
+		lines = append(lines, d.Readme...)
+	}
+	return lines
+}
+
+func formatDate(t time.Time) string {
+	if t.IsZero() {
+		return "unknown"
+	}
+	return t.Format("2006-01-02")
+}
+
+// installChosen installs the results picked in the browser, one after the
+// other, and summarises them when there are several.
+func installChosen(chosen []ghRepoItem, opts installOptions) error {
+	if len(chosen) == 1 {
+		return installRepo(chosen[0].FullName, opts)
+	}
+	var results []jobResult
+	for _, r := range chosen {
+		fmt.Println("==>", r.FullName)
+		start := time.Now()
+		err := installRepo(r.FullName, opts)
+		if err != nil {
+			fmt.Fprintln(errOut, "Error:", err)
+		}
+		results = append(results, jobResult{Target: r.FullName, Code: exitCode(err), Elapsed: time.Since(start)})
+	}
+	return printJobResults(results)
+}
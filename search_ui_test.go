@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFuzzyMatch(t *testing.T) {
+	tests := []struct {
+		text, pattern string
+		want          bool
+	}{
+		{"junegunn/fzf A command-line fuzzy finder", "fzf", true},
+		{"junegunn/fzf A command-line fuzzy finder", "jfz", true},
+		{"junegunn/fzf A command-line fuzzy finder", "FINDER", true},
+		{"junegunn/fzf", "fzz", false},
+		{"BurntSushi/ripgrep", "rg", true},
+		{"BurntSushi/ripgrep", "gr", true},
+		{"BurntSushi/ripgrep", "pz", false},
+		{"anything", "", true},
+	}
+	for _, tt := range tests {
+		if got := fuzzyMatch(tt.text, tt.pattern); got != tt.want {
+			t.Errorf("fuzzyMatch(%q, %q) = %v", tt.text, tt.pattern, got)
+		}
+	}
+}
+
+func testBrowser(names ...string) *searchBrowser {
+	b := &searchBrowser{
+		marked:   map[int]bool{},
+		details:  map[string]*repoDetails{},
+		fetching: map[string]bool{},
+		out:      bufio.NewWriter(io.Discard),
+	}
+	for _, name := range names {
+		b.results = append(b.results, ghRepoItem{FullName: name})
+	}
+	b.applyFilter()
+	return b
+}
+
+func TestSearchBrowserKeys(t *testing.T) {
+	names := []string{"junegunn/fzf", "BurntSushi/ripgrep", "sharkdp/fd", "sharkdp/bat"}
+	tests := []struct {
+		name     string
+		input    string
+		finished bool
+		chosen   []string
+	}{
+		{"enter takes the highlighted one", "\r", true, []string{"junegunn/fzf"}},
+		{"arrow down", "\x1b[B\r", true, []string{"BurntSushi/ripgrep"}},
+		{"application mode arrows", "\x1bOB\x1bOB\x1bOA\r", true, []string{"BurntSushi/ripgrep"}},
+		{"ctrl-n and ctrl-p", "\x0e\x0e\x0e\x10\r", true, []string{"sharkdp/fd"}},
+		{"cursor stays on the list", "\x1b[A\x1b[6~\x1b[6~\r", true, []string{"sharkdp/bat"}},
+		{"tab marks several", "\t\x1b[B\t\r", true, []string{"junegunn/fzf", "sharkdp/fd"}},
+		{"tab twice unmarks", "\t\x1b[A\t\r", true, []string{"BurntSushi/ripgrep"}},
+		{"filter", "sharkbat\r", true, []string{"sharkdp/bat"}},
+		{"backspace", "fdx\x7f\r", true, []string{"sharkdp/fd"}},
+		{"ctrl-u clears the filter", "bat\x15\r", true, []string{"junegunn/fzf"}},
+		{"unused escape sequence", "\x1b[1;5C\x1b[B\r", true, []string{"BurntSushi/ripgrep"}},
+		{"nothing matches", "zzz\r", true, nil},
+		{"escape cancels", "\t\x1b", true, nil},
+		{"ctrl-c cancels", "\x03", true, nil},
+		{"still browsing", "fd", false, nil},
+	}
+	for _, tt := range tests {
+		b := testBrowser(names...)
+		chosen, finished := b.handleInput([]byte(tt.input))
+		var got []string
+		for _, r := range chosen {
+			got = append(got, r.FullName)
+		}
+		if finished != tt.finished || !reflect.DeepEqual(got, tt.chosen) {
+			t.Errorf("%s: finished %v with %v, want %v with %v", tt.name, finished, got, tt.finished, tt.chosen)
+		}
+	}
+}
+
+func TestSearchBrowserPreview(t *testing.T) {
+	b := testBrowser("sharkdp/bat")
+	b.results[0].Description = "A cat(1) clone with wings."
+	b.results[0].StargazersCount = 50000
+	b.results[0].PushedAt = time.Date(2024, 5, 1, 0, 0, 0, 0, time.UTC)
+	b.results[0].Archived = true
+
+	preview := strings.Join(b.preview(), "\n")
+	want := "sharkdp/bat\nA cat(1) clone with wings.\n★ 50000 · Unknown · license none · last push 2024-05-01 · ARCHIVED\n\nLoading README…"
+	if preview != want {
+		t.Errorf("preview before loading:\n%s\nwant:\n%s", preview, want)
+	}
+
+	b.details["sharkdp/bat"] = &repoDetails{Repo: "sharkdp/bat", Release: "v0.24.0", Readme: []string{"# bat"}}
+	preview = strings.Join(b.preview(), "\n")
+	if !strings.Contains(preview, "latest release v0.24.0") || !strings.HasSuffix(preview, "\n# bat") {
+		t.Errorf("preview after loading:\n%s", preview)
+	}
+
+	b.handleInput([]byte("zzz"))
+	if got := b.preview(); !reflect.DeepEqual(got, []string{"No results match the filter."}) {
+		t.Errorf("preview without matches: %q", got)
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !linux && !darwin && !freebsd
+
+package main
+
+import "errors"
+
+// The search browser needs a Unix terminal; elsewhere search falls back to
+// the numbered prompt.
+
+func makeRaw(fd int) (func(), error) {
+	return nil, errors.New("raw terminal mode is not supported on this platform")
+}
+
+func terminalSize(fd int) (int, int, error) {
+	return 0, 0, errors.New("terminal size is not supported on this platform")
+}
@@ -0,0 +1,44 @@
+//go:build linux || darwin || freebsd
+
+package main
+
+import (
+	"syscall"
+	"unsafe"
+)
+
+// makeRaw turns off line editing, echo and signal keys on the terminal fd,
+// so keys arrive one at a time, and returns a function that restores the
+// previous settings. Reads return after a tenth of a second without input.
+func makeRaw(fd int) (func(), error) {
+	var old syscall.Termios
+	if err := ioctl(fd, ioctlGetTermios, unsafe.Pointer(&old)); err != nil {
+		return nil, err
+	}
+	raw := old
+	raw.Iflag &^= syscall.IXON | syscall.ICRNL
+	raw.Lflag &^= syscall.ICANON | syscall.ECHO | syscall.ISIG | syscall.IEXTEN
+	raw.Cc[syscall.VMIN] = 0
+	raw.Cc[syscall.VTIME] = 1
+	if err := ioctl(fd, ioctlSetTermios, unsafe.Pointer(&raw)); err != nil {
+		return nil, err
+	}
+	return func() { ioctl(fd, ioctlSetTermios, unsafe.Pointer(&old)) }, nil
+}
+
+// terminalSize returns the width and height of the terminal fd.
+func terminalSize(fd int) (int, int, error) {
+	var ws struct{ Row, Col, X, Y uint16 }
+	if err := ioctl(fd, syscall.TIOCGWINSZ, unsafe.Pointer(&ws)); err != nil {
+		return 0, 0, err
+	}
+	return int(ws.Col), int(ws.Row), nil
+}
+
+func ioctl(fd int, req uintptr, arg unsafe.Pointer) error {
+	_, _, errno := syscall.Syscall(syscall.SYS_IOCTL, uintptr(fd), req, uintptr(arg))
+	if errno != 0 {
+		return errno
+	}
+	return nil
+}
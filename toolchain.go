@@ -0,0 +1,143 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// toolCommands maps the tool names used in requirements to the command that
+// reports their version. The first command found on PATH is used.
+var toolCommands = map[string][][]string{
+	"go":     {{"go", "version"}},
+	"rust":   {{"rustc", "--version"}},
+	"rustc":  {{"rustc", "--version"}},
+	"cargo":  {{"cargo", "--version"}},
+	"node":   {{"node", "--version"}},
+	"npm":    {{"npm", "--version"}},
+	"python": {{"python3", "--version"}, {"python", "--version"}},
+	"ruby":   {{"ruby", "--version"}},
+	"cmake":  {{"cmake", "--version"}},
+	"zig":    {{"zig", "version"}},
+	"deno":   {{"deno", "--version"}},
+	"dotnet": {{"dotnet", "--version"}},
+}
+
+var versionPattern = regexp.MustCompile(`\d+(\.\d+)+`)
+
+// toolVersion runs the tool's version command and extracts the first
+// dotted version number from its output.
+func toolVersion(tool string) (string, error) {
+	cmds, ok := toolCommands[tool]
+	if !ok {
+		cmds = [][]string{{tool, "--version"}}
+	}
+	for _, c := range cmds {
+		if !commandExists(c[0]) {
+			continue
+		}
+		out, err := withBuildEnv(exec.Command(c[0], c[1:]...)).CombinedOutput()
+		if err != nil {
+			return "", fmt.Errorf("%s failed: %v", strings.Join(c, " "), err)
+		}
+		if v := versionPattern.FindString(string(out)); v != "" {
+			return v, nil
+		}
+		return "", fmt.Errorf("could not read the version from %s", strings.Join(c, " "))
+	}
+	return "", fmt.Errorf("%s is not installed or not on PATH", tool)
+}
+
+// toolInstalled reports whether any of the tool's commands is on PATH.
+func toolInstalled(tool string) bool {
+	cmds, ok := toolCommands[tool]
+	if !ok {
+		return commandExists(tool)
+	}
+	for _, c := range cmds {
+		if commandExists(c[0]) {
+			return true
+		}
+	}
+	return false
+}
+
+// compareVersions compares dotted version numbers numerically. A leading
+// "v" or "go" and any pre-release suffix are ignored; missing components
+// count as zero.
+func compareVersions(a, b string) int {
+	pa, pb := versionParts(a), versionParts(b)
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var x, y int
+		if i < len(pa) {
+			x = pa[i]
+		}
+		if i < len(pb) {
+			y = pb[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func versionParts(v string) []int {
+	v = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(v), "go"), "v")
+	if i := strings.IndexAny(v, "-+ "); i >= 0 {
+		v = v[:i]
+	}
+	var parts []int
+	for _, p := range strings.Split(v, ".") {
+		n, err := strconv.Atoi(p)
+		if err != nil {
+			break
+		}
+		parts = append(parts, n)
+	}
+	return parts
+}
+
+// minimumVersion turns a requirement such as ">=1.22", "^18" or "1.74" into
+// the lowest version that satisfies it.
+func minimumVersion(req string) string {
+	return strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(req), ">=^~v"))
+}
+
+// checkRequirements checks every tool against its minimum version and
+// returns a description of each one that is missing or too old.
+func checkRequirements(reqs map[string]string) []string {
+	var tools []string
+	for tool := range reqs {
+		tools = append(tools, tool)
+	}
+	sort.Strings(tools)
+
+	var problems []string
+	for _, tool := range tools {
+		want := minimumVersion(reqs[tool])
+		if want == "" {
+			// Not every tool has a version flag: dash, the usual /bin/sh,
+			// rejects --version.
+			if !toolInstalled(tool) {
+				problems = append(problems, fmt.Sprintf("%s is required: not installed or not on PATH", tool))
+			}
+			continue
+		}
+		have, err := toolVersion(tool)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s %s or newer is required: %v", tool, want, err))
+			continue
+		}
+		if compareVersions(have, want) < 0 {
+			problems = append(problems, fmt.Sprintf("%s %s or newer is required, found %s", tool, want, have))
+		}
+	}
+	return problems
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCheckRequirementsWithoutVersion(t *testing.T) {
+	// sh may be dash, which has no --version; presence is enough.
+	if problems := checkRequirements(map[string]string{"sh": ""}); len(problems) != 0 {
+		t.Errorf("sh with no version required: %v", problems)
+	}
+	problems := checkRequirements(map[string]string{"ghpm-no-such-tool": ""})
+	if len(problems) != 1 || !strings.Contains(problems[0], "ghpm-no-such-tool is required") {
+		t.Errorf("missing tool reported as %v", problems)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.3", "1.2.3", 0},
+		{"1.2", "1.2.0", 0},
+		{"v1.2.3", "1.2.3", 0},
+		{"go1.22.1", "1.22", 1},
+		{"1.10", "1.9", 1},
+		{"1.9.9", "1.10", -1},
+		{"2", "10", -1},
+		{"1.2.3-rc1", "1.2.3", 0},
+		{"1.2.3+build", "1.2.4", -1},
+		{"", "0", 0},
+		{"", "0.1", -1},
+		{"1.x", "1", 0},
+	}
+	for _, tt := range tests {
+		if got := compareVersions(tt.a, tt.b); got != tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+		if got := compareVersions(tt.b, tt.a); got != -tt.want {
+			t.Errorf("compareVersions(%q, %q) = %d, want %d", tt.b, tt.a, got, -tt.want)
+		}
+	}
+}
+
+func TestMinimumVersion(t *testing.T) {
+	for in, want := range map[string]string{">=1.22": "1.22", "^18": "18", "~ 0.3": "0.3", "v1.74": "1.74", "": ""} {
+		if got := minimumVersion(in); got != want {
+			t.Errorf("minimumVersion(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
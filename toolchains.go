@@ -0,0 +1,577 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ghpm can fetch Go, Node and Rust itself and keep them under
+// ~/.ghpm/toolchains/<tool>/<version>, much like asdf or mise. When the
+// "toolchains" setting is on, a build that declares a version for one of
+// these tools gets that exact version on PATH; nothing outside the build
+// sees it.
+
+const (
+	defaultGoMirror   = "https://go.dev/dl"
+	defaultNodeMirror = "https://nodejs.org/dist"
+	defaultRustMirror = "https://static.rust-lang.org/dist"
+)
+
+// checksumSources are where each project publishes the SHA-256 of its
+// release archives. They are always fetched from the project, never from a
+// configured mirror, so a mirror cannot swap an archive unnoticed.
+var checksumSources = map[string]string{
+	"go":   "https://go.dev/dl/?mode=json&include=all",
+	"node": defaultNodeMirror,
+	"rust": defaultRustMirror,
+}
+
+// downloadClient has no overall timeout, since toolchain archives are large;
+// it only gives up on servers that do not answer.
+var downloadClient = &http.Client{Transport: &http.Transport{
+	Proxy:                 http.ProxyFromEnvironment,
+	ResponseHeaderTimeout: 30 * time.Second,
+}}
+
+// managedTools maps each toolchain ghpm can install to the requirement
+// names it satisfies.
+var managedTools = map[string][]string{
+	"go":   {"go"},
+	"node": {"node", "npm"},
+	"rust": {"rust", "rustc", "cargo"},
+}
+
+func toolchainsDir() string {
+	return filepath.Join(baseDir, "toolchains")
+}
+
+func toolchainDir(tool, version string) string {
+	return filepath.Join(toolchainsDir(), tool, version)
+}
+
+// managedToolFor returns the managed toolchain that provides the required
+// tool name, or "".
+func managedToolFor(name string) string {
+	for tool, provides := range managedTools {
+		for _, p := range provides {
+			if p == name {
+				return tool
+			}
+		}
+	}
+	return ""
+}
+
+func mirrorFor(tool string, cfg Config) string {
+	var mirror, def string
+	switch tool {
+	case "go":
+		mirror, def = cfg.GoMirror, defaultGoMirror
+	case "node":
+		mirror, def = cfg.NodeMirror, defaultNodeMirror
+	case "rust":
+		mirror, def = cfg.RustMirror, defaultRustMirror
+	}
+	if mirror == "" {
+		mirror = def
+	}
+	return strings.TrimSuffix(mirror, "/")
+}
+
+// pinnedVersion turns a declared minimum such as "1.23", "18" or "1.74" into
+// the release to fetch. Complete versions are used as they are.
+func pinnedVersion(tool, declared string, cfg Config) (string, error) {
+	v := strings.TrimPrefix(minimumVersion(declared), "go")
+	parts := versionParts(v)
+	if len(parts) == 0 {
+		return "", fmt.Errorf("cannot read a %s version from %q", tool, declared)
+	}
+	switch tool {
+	case "go":
+		// Releases before 1.21 were named go1.20, go1.20.1, ...
+		if len(parts) == 2 && compareVersions(v, "1.21") >= 0 {
+			return v + ".0", nil
+		}
+		return v, nil
+	case "rust":
+		if len(parts) == 2 {
+			return v + ".0", nil
+		}
+		return v, nil
+	case "node":
+		if len(parts) == 3 {
+			return v, nil
+		}
+		return latestNodeRelease(v, mirrorFor("node", cfg))
+	}
+	return "", fmt.Errorf("%s is not a managed toolchain", tool)
+}
+
+// latestNodeRelease picks the newest release in the line prefix names ("18"
+// or "18.2") from the mirror's index.json.
+func latestNodeRelease(prefix, mirror string) (string, error) {
+	resp, err := httpClient.Get(mirror + "/index.json")
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s/index.json: %s", mirror, resp.Status)
+	}
+	var releases []struct {
+		Version string `json:"version"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&releases); err != nil {
+		return "", err
+	}
+	best := ""
+	for _, r := range releases {
+		v := strings.TrimPrefix(r.Version, "v")
+		if (v == prefix || strings.HasPrefix(v, prefix+".")) && (best == "" || compareVersions(v, best) > 0) {
+			best = v
+		}
+	}
+	if best == "" {
+		return "", fmt.Errorf("no node release matches %s", prefix)
+	}
+	return best, nil
+}
+
+// toolchainURL returns the archive to download for a release on this
+// platform.
+func toolchainURL(tool, version string, cfg Config) (string, error) {
+	goos, arch := runtime.GOOS, runtime.GOARCH
+	if goos != "linux" && goos != "darwin" {
+		return "", fmt.Errorf("managed toolchains are not supported on %s", goos)
+	}
+	mirror := mirrorFor(tool, cfg)
+	switch tool {
+	case "go":
+		return fmt.Sprintf("%s/go%s.%s-%s.tar.gz", mirror, version, goos, arch), nil
+	case "node":
+		nodeArch := map[string]string{"amd64": "x64", "arm64": "arm64"}[arch]
+		if nodeArch == "" {
+			return "", fmt.Errorf("no node builds for %s", arch)
+		}
+		return fmt.Sprintf("%s/v%s/node-v%s-%s-%s.tar.gz", mirror, version, version, goos, nodeArch), nil
+	case "rust":
+		rustArch := map[string]string{"amd64": "x86_64", "arm64": "aarch64"}[arch]
+		if rustArch == "" {
+			return "", fmt.Errorf("no rust builds for %s", arch)
+		}
+		target := rustArch + "-unknown-linux-gnu"
+		if goos == "darwin" {
+			target = rustArch + "-apple-darwin"
+		}
+		return fmt.Sprintf("%s/rust-%s-%s.tar.gz", mirror, version, target), nil
+	}
+	return "", fmt.Errorf("%s is not a managed toolchain", tool)
+}
+
+// installToolchain downloads and unpacks a release unless it is already
+// present, and returns its bin directory.
+func installToolchain(tool, version string, cfg Config) (string, error) {
+	dest := toolchainDir(tool, version)
+	bin := filepath.Join(dest, "bin")
+	if _, err := os.Stat(bin); err == nil {
+		return bin, nil
+	}
+
+	url, err := toolchainURL(tool, version, cfg)
+	if err != nil {
+		return "", err
+	}
+	fmt.Println("Downloading", tool, version, "from", url)
+	resp, err := downloadClient.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: %s", url, resp.Status)
+	}
+
+	want, err := toolchainChecksum(tool, version, path.Base(url))
+	if err != nil {
+		return "", fmt.Errorf("cannot get the checksum of %s: %v", path.Base(url), err)
+	}
+
+	os.MkdirAll(filepath.Dir(dest), 0755)
+	tmp, err := os.MkdirTemp(filepath.Dir(dest), ".download-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmp)
+
+	// Every archive has a single top-level directory; strip it. Nothing
+	// unpacked is used before the whole download has been checked.
+	hash := sha256.New()
+	body := io.TeeReader(resp.Body, hash)
+	if err := extractTarGz(body, tmp, 1); err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(io.Discard, body); err != nil {
+		return "", err
+	}
+	if got := hex.EncodeToString(hash.Sum(nil)); got != want {
+		return "", verifyError("checksum mismatch for %s: got %s, want %s", url, got, want)
+	}
+
+	if tool == "rust" {
+		// The standalone installer lays out rustc, cargo and the standard
+		// library under a prefix of our choosing.
+		cmd := exec.Command("sh", filepath.Join(tmp, "install.sh"), "--prefix="+dest, "--disable-ldconfig")
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			os.RemoveAll(dest)
+			return "", fmt.Errorf("rust installer failed: %v", err)
+		}
+		return bin, nil
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		// Another build may have installed the same release meanwhile.
+		if _, statErr := os.Stat(bin); statErr == nil {
+			return bin, nil
+		}
+		return "", err
+	}
+	os.Chmod(dest, 0755)
+	return bin, nil
+}
+
+// toolchainChecksum returns the published SHA-256 of a release archive.
+func toolchainChecksum(tool, version, file string) (string, error) {
+	source := checksumSources[tool]
+	switch tool {
+	case "go":
+		var releases []struct {
+			Files []struct {
+				Filename string `json:"filename"`
+				SHA256   string `json:"sha256"`
+			} `json:"files"`
+		}
+		if err := getJSON(source, &releases); err != nil {
+			return "", err
+		}
+		for _, r := range releases {
+			for _, f := range r.Files {
+				if f.Filename == file && f.SHA256 != "" {
+					return strings.ToLower(f.SHA256), nil
+				}
+			}
+		}
+		return "", fmt.Errorf("%s is not listed", file)
+	case "node":
+		return checksumFromList(source+"/v"+version+"/SHASUMS256.txt", file)
+	case "rust":
+		return checksumFromList(source+"/"+file+".sha256", file)
+	}
+	return "", fmt.Errorf("%s is not a managed toolchain", tool)
+}
+
+// checksumFromList reads a sha256sum style list ("<hash>  <file>" lines)
+// and returns the hash of file.
+func checksumFromList(url, file string) (string, error) {
+	resp, err := httpClient.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && path.Base(strings.TrimPrefix(fields[1], "*")) == file && len(fields[0]) == sha256.Size*2 {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	return "", fmt.Errorf("%s is not listed in %s", file, url)
+}
+
+func getJSON(url string, v any) error {
+	resp, err := downloadClient.Get(url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s: %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
+
+// extractTarGz unpacks a gzipped tarball into dest, dropping the first strip
+// path components of every entry. Nothing may end up outside dest: symlinks
+// must point inside it, and no entry may be written through one.
+func extractTarGz(r io.Reader, dest string, strip int) error {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return err
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+	var links []string
+	made := map[string]bool{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		parts := strings.Split(strings.Trim(filepath.ToSlash(hdr.Name), "/"), "/")
+		if len(parts) <= strip {
+			continue
+		}
+		rel := filepath.FromSlash(strings.Join(parts[strip:], "/"))
+		target := filepath.Join(dest, rel)
+		if !strings.HasPrefix(target, filepath.Clean(dest)+string(os.PathSeparator)) {
+			return fmt.Errorf("archive entry %s escapes the destination", hdr.Name)
+		}
+		for dir := filepath.Clean(rel); dir != "."; dir = filepath.Dir(dir) {
+			if made[dir] {
+				return fmt.Errorf("archive entry %s goes through the symlink %s", hdr.Name, dir)
+			}
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0755); err != nil {
+				return err
+			}
+		case tar.TypeReg:
+			os.MkdirAll(filepath.Dir(target), 0755)
+			f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(hdr.Mode)&0777)
+			if err != nil {
+				return err
+			}
+			_, err = io.Copy(f, tr)
+			f.Close()
+			if err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			to := filepath.Join(filepath.Dir(rel), filepath.FromSlash(hdr.Linkname))
+			if filepath.IsAbs(hdr.Linkname) || to == ".." || strings.HasPrefix(to, ".."+string(os.PathSeparator)) {
+				return fmt.Errorf("archive entry %s links outside the destination: %s", hdr.Name, hdr.Linkname)
+			}
+			os.MkdirAll(filepath.Dir(target), 0755)
+			os.Remove(target)
+			if err := os.Symlink(hdr.Linkname, target); err != nil {
+				return err
+			}
+			made[filepath.Clean(rel)] = true
+			links = append(links, target)
+		}
+	}
+	// A link can still lead out through other links ("a" -> "." then
+	// "x" -> "a/../.."), which only shows once they all exist.
+	for _, link := range links {
+		if _, err := os.Stat(link); err == nil && !withinDirs(link, dest) {
+			return fmt.Errorf("archive link %s leads outside the destination", link)
+		}
+	}
+	return nil
+}
+
+// buildEnv holds the variables the active managed toolchains set, as
+// "KEY=value" entries, or nil when there are none. Only build commands get
+// them (see withBuildEnv); ghpm's own environment, and so its git and API
+// calls, stay as they were.
+var buildEnv []string
+
+// activateToolchains sets up the managed toolchain for every declared
+// version in versions, installing it first if needed, and puts it at the
+// front of the build commands' PATH. Call the returned function when the
+// build is done.
+func activateToolchains(versions map[string]string) func() {
+	cfg := loadConfig()
+	if !cfg.Toolchains {
+		return func() {}
+	}
+
+	var tools []string
+	for tool := range versions {
+		tools = append(tools, tool)
+	}
+	sort.Strings(tools)
+	var bins []string
+	managedGo := false
+	done := map[string]bool{}
+	for _, name := range tools {
+		tool := managedToolFor(name)
+		if tool == "" || done[tool] || versions[name] == "" {
+			continue
+		}
+		done[tool] = true
+		version, err := pinnedVersion(tool, versions[name], cfg)
+		if err == nil {
+			var bin string
+			if bin, err = installToolchain(tool, version, cfg); err == nil {
+				fmt.Println("Using managed", tool, version)
+				bins = append([]string{bin}, bins...)
+				if tool == "go" {
+					managedGo = true
+				}
+				continue
+			}
+		}
+		fmt.Println("Warning: could not set up", tool, versions[name]+":", err)
+	}
+	if len(bins) == 0 {
+		return func() {}
+	}
+
+	env := []string{"PATH=" + strings.Join(append(bins, os.Getenv("PATH")), string(os.PathListSeparator))}
+	if managedGo {
+		// Stop the go command from switching to yet another toolchain.
+		env = append(env, "GOTOOLCHAIN=local")
+	}
+	old := buildEnv
+	buildEnv = env
+	return func() { buildEnv = old }
+}
+
+// withBuildEnv gives cmd the environment of the active toolchains and finds
+// its program on their PATH, since exec.Command looked it up on ghpm's own.
+func withBuildEnv(cmd *exec.Cmd) *exec.Cmd {
+	if buildEnv == nil {
+		return cmd
+	}
+	if cmd.Env == nil {
+		cmd.Env = os.Environ()
+	}
+	// The last value of a repeated variable is the one used.
+	cmd.Env = append(cmd.Env, buildEnv...)
+	if name := cmd.Args[0]; !strings.ContainsRune(name, filepath.Separator) {
+		if p, err := buildLookPath(name); err == nil {
+			cmd.Path, cmd.Err = p, nil
+		}
+	}
+	return cmd
+}
+
+// buildLookPath is exec.LookPath on the PATH build commands get.
+func buildLookPath(name string) (string, error) {
+	dirs := ""
+	for _, kv := range buildEnv {
+		if v, ok := strings.CutPrefix(kv, "PATH="); ok {
+			dirs = v
+		}
+	}
+	if dirs == "" || strings.ContainsRune(name, filepath.Separator) {
+		return exec.LookPath(name)
+	}
+	for _, dir := range filepath.SplitList(dirs) {
+		if dir == "" {
+			dir = "."
+		}
+		p := filepath.Join(dir, name)
+		if info, err := os.Stat(p); err == nil && !info.IsDir() && info.Mode()&0111 != 0 {
+			return p, nil
+		}
+	}
+	return "", &exec.Error{Name: name, Err: exec.ErrNotFound}
+}
+
+// buildVersions collects the toolchain versions a build asks for: those
+// declared in the repo's own files, overridden by the recipe's requires.
+func buildVersions(repoPath string, recipe *Recipe) map[string]string {
+	versions := declaredVersions(func(name string) []byte {
+		data, err := os.ReadFile(filepath.Join(repoPath, name))
+		if err != nil {
+			return nil
+		}
+		return data
+	})
+	if recipe != nil {
+		for tool, req := range recipe.Requires {
+			if t := managedToolFor(tool); t != "" {
+				versions[t] = req
+			}
+		}
+	}
+	return versions
+}
+
+// toolchainsCommand implements "ghpm toolchains [install|remove <tool> <version>]".
+func toolchainsCommand(args []string) error {
+	if len(args) == 0 {
+		cfg := loadConfig()
+		state := "off"
+		if cfg.Toolchains {
+			state = "on"
+		}
+		fmt.Println("Managed toolchains:", state, "(ghpm config toolchains true|false)")
+		found := false
+		for _, tool := range []string{"go", "node", "rust"} {
+			entries, _ := os.ReadDir(filepath.Join(toolchainsDir(), tool))
+			for _, e := range entries {
+				if e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+					fmt.Printf("  %s %s\n", tool, e.Name())
+					found = true
+				}
+			}
+		}
+		if !found {
+			fmt.Println("  none installed")
+		}
+		return nil
+	}
+
+	if len(args) != 3 || (args[0] != "install" && args[0] != "remove") {
+		return usageError("Usage: ghpm toolchains [install|remove <go|node|rust> <version>]")
+	}
+	tool := args[1]
+	if _, ok := managedTools[tool]; !ok {
+		return usageError("unknown toolchain %s (go, node or rust)", tool)
+	}
+	cfg := loadConfig()
+	version, err := pinnedVersion(tool, args[2], cfg)
+	if err != nil {
+		return err
+	}
+
+	if args[0] == "remove" {
+		dir := toolchainDir(tool, version)
+		if _, err := os.Stat(dir); err != nil {
+			return notFoundError("%s %s is not installed", tool, version)
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			return fmt.Errorf("failed to remove %s: %v", dir, err)
+		}
+		fmt.Println("Removed", tool, version)
+		return nil
+	}
+
+	bin, err := installToolchain(tool, version, cfg)
+	if exitCode(err) == exitVerify {
+		return err
+	}
+	if err != nil {
+		return networkError("failed to install %s %s: %v", tool, version, err)
+	}
+	fmt.Println("Installed", tool, version, "in", filepath.Dir(bin))
+	return nil
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// tarGz builds a gzipped tarball from entries in order.
+func tarGz(t *testing.T, entries []tar.Header, contents map[string]string) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gz)
+	for _, hdr := range entries {
+		hdr := hdr
+		data := contents[hdr.Name]
+		hdr.Size = int64(len(data))
+		if err := tw.WriteHeader(&hdr); err != nil {
+			t.Fatal(err)
+		}
+		tw.Write([]byte(data))
+	}
+	tw.Close()
+	gz.Close()
+	return buf.Bytes()
+}
+
+func TestInstallToolchainChecksum(t *testing.T) {
+	if runtime.GOOS != "linux" || (runtime.GOARCH != "amd64" && runtime.GOARCH != "arm64") {
+		t.Skip("no node builds for this platform")
+	}
+	testHome(t)
+	nodeArch := map[string]string{"amd64": "x64", "arm64": "arm64"}[runtime.GOARCH]
+	file := fmt.Sprintf("node-v20.1.0-linux-%s.tar.gz", nodeArch)
+	archive := tarGz(t, []tar.Header{
+		{Name: "node/", Typeflag: tar.TypeDir, Mode: 0755},
+		{Name: "node/bin/node", Typeflag: tar.TypeReg, Mode: 0755},
+	}, map[string]string{"node/bin/node": "#!/bin/sh\n"})
+	sum := sha256.Sum256(archive)
+
+	published := hex.EncodeToString(sum[:])
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/mirror/v20.1.0/" + file:
+			w.Write(archive)
+		case "/official/v20.1.0/SHASUMS256.txt":
+			fmt.Fprintf(w, "%s  node-v20.1.0.tar.gz\n%s  %s\n", hex.EncodeToString(sum[:]), published, file)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+	old := checksumSources["node"]
+	checksumSources["node"] = srv.URL + "/official"
+	defer func() { checksumSources["node"] = old }()
+	cfg := Config{NodeMirror: srv.URL + "/mirror"}
+
+	published = hex.EncodeToString(make([]byte, 32))
+	_, err := installToolchain("node", "20.1.0", cfg)
+	if exitCode(err) != exitVerify {
+		t.Fatalf("tampered archive: %v", err)
+	}
+	if _, err := os.Stat(toolchainDir("node", "20.1.0")); !os.IsNotExist(err) {
+		t.Error("tampered archive was installed")
+	}
+
+	published = hex.EncodeToString(sum[:])
+	bin, err := installToolchain("node", "20.1.0", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(bin, "node")); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestExtractTarGz(t *testing.T) {
+	dir := func(name string) tar.Header { return tar.Header{Name: name, Typeflag: tar.TypeDir, Mode: 0755} }
+	file := func(name string) tar.Header { return tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644} }
+	link := func(name, to string) tar.Header {
+		return tar.Header{Name: name, Typeflag: tar.TypeSymlink, Linkname: to}
+	}
+	tests := []struct {
+		name    string
+		entries []tar.Header
+		wantErr bool
+	}{
+		{"plain", []tar.Header{dir("top/"), dir("top/bin/"), file("top/bin/tool"), file("top/lib/x")}, false},
+		{"link inside", []tar.Header{file("top/lib/cli.js"), link("top/bin/cli", "../lib/cli.js")}, false},
+		{"dot dot entry", []tar.Header{file("top/../../evil")}, true},
+		{"absolute link", []tar.Header{link("top/evil", "/etc/passwd")}, true},
+		{"relative link out", []tar.Header{link("top/bin/evil", "../../x")}, true},
+		{"write through link", []tar.Header{link("top/d", "sub"), dir("top/sub/"), file("top/d/f")}, true},
+		{"replace link with file", []tar.Header{link("top/f", "g"), file("top/f")}, true},
+		{"chained links", []tar.Header{link("top/s/a", "."), link("top/s/x", "a/../..")}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			root := t.TempDir()
+			dest := filepath.Join(root, "dest")
+			os.Mkdir(dest, 0755)
+			data := tarGz(t, tt.entries, nil)
+			err := extractTarGz(bytes.NewReader(data), dest, 1)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, want error %v", err, tt.wantErr)
+			}
+			entries, _ := os.ReadDir(root)
+			if len(entries) != 1 {
+				t.Errorf("wrote outside dest: %v", entries)
+			}
+		})
+	}
+}
+
+func TestActivateToolchainsOnlyForBuilds(t *testing.T) {
+	testHome(t)
+	if err := os.WriteFile(configPath(), []byte(`{"toolchains": true}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// An installed release is used without downloading anything.
+	bin := filepath.Join(toolchainDir("go", "1.22.0"), "bin")
+	os.MkdirAll(bin, 0755)
+	marker := filepath.Join(t.TempDir(), "ran")
+	script := "#!/bin/sh\necho \"$GOTOOLCHAIN\" > " + marker + "\n"
+	if err := os.WriteFile(filepath.Join(bin, "go-managed-test"), []byte(script), 0755); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", "/usr/bin:/bin")
+	t.Setenv("GOTOOLCHAIN", "auto")
+
+	restore := activateToolchains(map[string]string{"go": "1.22"})
+	if os.Getenv("PATH") != "/usr/bin:/bin" || os.Getenv("GOTOOLCHAIN") != "auto" {
+		t.Errorf("ghpm's own environment changed: PATH=%s GOTOOLCHAIN=%s", os.Getenv("PATH"), os.Getenv("GOTOOLCHAIN"))
+	}
+	if !commandExists("go-managed-test") {
+		t.Error("the managed toolchain is not on the build PATH")
+	}
+	if err := runLogged(exec.Command("go-managed-test")); err != nil {
+		t.Fatal(err)
+	}
+	if out, _ := os.ReadFile(marker); string(out) != "local\n" {
+		t.Errorf("build saw GOTOOLCHAIN=%q", out)
+	}
+
+	restore()
+	if commandExists("go-managed-test") {
+		t.Error("the managed toolchain is still on the build PATH")
+	}
+}
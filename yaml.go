@@ -0,0 +1,345 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// ghpm stays dependency free, so recipes and .ghpm.yml files are read with
+// this small YAML subset parser. It handles block mappings and sequences,
+// flow [lists] and {maps}, quoted and plain scalars, "|" and ">" block
+// scalars and comments. Anchors, tags and multi-document files are not
+// supported.
+
+// decodeYAML parses data and stores the result in v via its JSON tags.
+func decodeYAML(data []byte, v any) error {
+	node, err := parseYAML(data)
+	if err != nil {
+		return err
+	}
+	raw, err := json.Marshal(node)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, v)
+}
+
+type yamlLine struct {
+	num    int
+	indent int
+	text   string
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	pos   int
+}
+
+func parseYAML(data []byte) (any, error) {
+	p := &yamlParser{}
+	for i, raw := range strings.Split(strings.ReplaceAll(string(data), "\r\n", "\n"), "\n") {
+		if strings.TrimSpace(raw) == "---" && i == 0 {
+			continue
+		}
+		text := strings.TrimLeft(raw, " ")
+		p.lines = append(p.lines, yamlLine{num: i + 1, indent: len(raw) - len(text), text: strings.TrimRight(text, " \t")})
+	}
+	if p.peek() == nil {
+		return map[string]any{}, nil
+	}
+	return p.parseBlock(p.peek().indent)
+}
+
+// peek returns the next line with content, skipping blanks and comments.
+func (p *yamlParser) peek() *yamlLine {
+	for p.pos < len(p.lines) {
+		l := &p.lines[p.pos]
+		if l.text != "" && !strings.HasPrefix(l.text, "#") {
+			return l
+		}
+		p.pos++
+	}
+	return nil
+}
+
+func isSeqItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+func (p *yamlParser) parseBlock(indent int) (any, error) {
+	l := p.peek()
+	if l == nil {
+		return nil, nil
+	}
+	if isSeqItem(l.text) {
+		return p.parseSeq(l.indent)
+	}
+	return p.parseMap(indent)
+}
+
+func (p *yamlParser) parseSeq(indent int) (any, error) {
+	var items []any
+	for {
+		l := p.peek()
+		if l == nil || l.indent != indent || !isSeqItem(l.text) {
+			return items, nil
+		}
+		rest := strings.TrimSpace(strings.TrimPrefix(l.text, "-"))
+		if rest == "" {
+			p.pos++
+			next := p.peek()
+			if next == nil || next.indent <= indent {
+				items = append(items, nil)
+				continue
+			}
+			v, err := p.parseBlock(next.indent)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+			continue
+		}
+		if _, _, ok := splitYAMLKey(rest); ok && !strings.HasPrefix(rest, "{") && !strings.HasPrefix(rest, "[") {
+			// "- key: value" starts a mapping nested in the item; reparse
+			// the line as if the key sat on its own at the deeper indent.
+			offset := len(l.text) - len(strings.TrimLeft(l.text[1:], " "))
+			l.indent += offset
+			l.text = rest
+			v, err := p.parseMap(l.indent)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+			continue
+		}
+		p.pos++
+		if strings.HasPrefix(rest, "|") || strings.HasPrefix(rest, ">") {
+			v, err := p.blockScalar(indent, rest[0] == '>', strings.HasSuffix(rest, "-"))
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+			continue
+		}
+		v, err := parseYAMLScalar(rest)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", l.num, err)
+		}
+		items = append(items, v)
+	}
+}
+
+func (p *yamlParser) parseMap(indent int) (any, error) {
+	m := map[string]any{}
+	for {
+		l := p.peek()
+		if l == nil || l.indent < indent {
+			return m, nil
+		}
+		if l.indent > indent {
+			return nil, fmt.Errorf("line %d: unexpected indentation", l.num)
+		}
+		if isSeqItem(l.text) {
+			return m, nil
+		}
+		key, value, ok := splitYAMLKey(l.text)
+		if !ok {
+			return nil, fmt.Errorf("line %d: expected \"key: value\"", l.num)
+		}
+		p.pos++
+
+		switch {
+		case value == "":
+			next := p.peek()
+			if next != nil && (next.indent > indent || (next.indent == indent && isSeqItem(next.text))) {
+				v, err := p.parseBlock(next.indent)
+				if err != nil {
+					return nil, err
+				}
+				m[key] = v
+			} else {
+				m[key] = nil
+			}
+		case strings.HasPrefix(value, "|") || strings.HasPrefix(value, ">"):
+			v, err := p.blockScalar(indent, value[0] == '>', strings.HasSuffix(value, "-"))
+			if err != nil {
+				return nil, err
+			}
+			m[key] = v
+		default:
+			v, err := parseYAMLScalar(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", l.num, err)
+			}
+			m[key] = v
+		}
+	}
+}
+
+// blockScalar collects the raw lines indented deeper than parent. Its first
+// line sets the indentation; a later line indented less is an error.
+func (p *yamlParser) blockScalar(parent int, folded, strip bool) (string, error) {
+	var lines []string
+	indent := -1
+	for p.pos < len(p.lines) {
+		l := p.lines[p.pos]
+		if l.text != "" && l.indent <= parent {
+			break
+		}
+		if l.text != "" && indent < 0 {
+			indent = l.indent
+		}
+		if l.text != "" && l.indent < indent {
+			return "", fmt.Errorf("line %d: block scalar line indented less than its first line", l.num)
+		}
+		line := ""
+		if l.text != "" {
+			line = strings.Repeat(" ", l.indent-indent) + l.text
+		}
+		lines = append(lines, line)
+		p.pos++
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+
+	sep := "\n"
+	if folded {
+		sep = " "
+	}
+	out := strings.Join(lines, sep)
+	if !strip && out != "" {
+		out += "\n"
+	}
+	return out, nil
+}
+
+// splitYAMLKey splits "key: value" at the first colon outside quotes that is
+// followed by a space or the end of the line.
+func splitYAMLKey(text string) (string, string, bool) {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ':' && (i+1 == len(text) || text[i+1] == ' '):
+			key := strings.TrimSpace(text[:i])
+			if unq, err := parseYAMLScalar(key); err == nil {
+				if s, ok := unq.(string); ok {
+					key = s
+				}
+			}
+			return key, stripYAMLComment(strings.TrimSpace(text[i+1:])), true
+		}
+	}
+	return "", "", false
+}
+
+func stripYAMLComment(text string) string {
+	var quote byte
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '#' && (i == 0 || text[i-1] == ' '):
+			return strings.TrimSpace(text[:i])
+		}
+	}
+	return text
+}
+
+// parseYAMLScalar parses an inline value. Plain scalars stay strings apart
+// from booleans and null, which keeps versions like 1.20 intact.
+func parseYAMLScalar(text string) (any, error) {
+	text = strings.TrimSpace(stripYAMLComment(text))
+	switch {
+	case text == "" || text == "~" || text == "null":
+		return nil, nil
+	case text == "true":
+		return true, nil
+	case text == "false":
+		return false, nil
+	case strings.HasPrefix(text, "\""):
+		var s string
+		if err := json.Unmarshal([]byte(text), &s); err != nil {
+			return nil, fmt.Errorf("bad quoted string %s", text)
+		}
+		return s, nil
+	case strings.HasPrefix(text, "'"):
+		if len(text) < 2 || !strings.HasSuffix(text, "'") {
+			return nil, fmt.Errorf("bad quoted string %s", text)
+		}
+		return strings.ReplaceAll(text[1:len(text)-1], "''", "'"), nil
+	case strings.HasPrefix(text, "["):
+		if !strings.HasSuffix(text, "]") {
+			return nil, fmt.Errorf("unterminated flow sequence %s", text)
+		}
+		items := []any{}
+		for _, part := range splitFlow(text[1 : len(text)-1]) {
+			v, err := parseYAMLScalar(part)
+			if err != nil {
+				return nil, err
+			}
+			items = append(items, v)
+		}
+		return items, nil
+	case strings.HasPrefix(text, "{"):
+		if !strings.HasSuffix(text, "}") {
+			return nil, fmt.Errorf("unterminated flow mapping %s", text)
+		}
+		m := map[string]any{}
+		for _, part := range splitFlow(text[1 : len(text)-1]) {
+			key, value, ok := splitYAMLKey(part)
+			if !ok {
+				return nil, fmt.Errorf("bad flow mapping entry %s", part)
+			}
+			v, err := parseYAMLScalar(value)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = v
+		}
+		return m, nil
+	}
+	return text, nil
+}
+
+// splitFlow splits the inside of a flow collection on top-level commas.
+func splitFlow(text string) []string {
+	var parts []string
+	var quote byte
+	depth, start := 0, 0
+	for i := 0; i < len(text); i++ {
+		c := text[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '{':
+			depth++
+		case c == ']' || c == '}':
+			depth--
+		case c == ',' && depth == 0:
+			parts = append(parts, strings.TrimSpace(text[start:i]))
+			start = i + 1
+		}
+	}
+	if last := strings.TrimSpace(text[start:]); last != "" {
+		parts = append(parts, last)
+	}
+	return parts
+}
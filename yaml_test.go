@@ -0,0 +1,170 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseYAML(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want any
+	}{
+		{"empty", "", map[string]any{}},
+		{"only comments", "# nothing\n\n  # here\n", map[string]any{}},
+		{"document marker", "---\nname: tool\n", map[string]any{"name": "tool"}},
+		{
+			name: "plain scalars stay strings",
+			in:   "version: 1.20\ncount: 3\nname: my tool\nurl: https://example.com/a:b\n",
+			want: map[string]any{"version": "1.20", "count": "3", "name": "my tool", "url": "https://example.com/a:b"},
+		},
+		{
+			name: "booleans and null",
+			in:   "a: true\nb: false\nc: null\nd: ~\ne:\n",
+			want: map[string]any{"a": true, "b": false, "c": nil, "d": nil, "e": nil},
+		},
+		{
+			name: "quoted scalars",
+			in:   "a: \"x: y # not a comment\"\nb: 'it''s'\nc: \"tab\\there\"\nd: \"true\"\n\"quoted key\": 1\n",
+			want: map[string]any{"a": "x: y # not a comment", "b": "it's", "c": "tab\there", "d": "true", "quoted key": "1"},
+		},
+		{
+			name: "comments",
+			in:   "# header\nname: tool # trailing\nurl: a#b\n  # indented comment\nbin: x\n",
+			want: map[string]any{"name": "tool", "url": "a#b", "bin": "x"},
+		},
+		{
+			name: "block sequence",
+			in:   "build:\n  - make\n  - make install\n",
+			want: map[string]any{"build": []any{"make", "make install"}},
+		},
+		{
+			name: "sequence at the same indent as its key",
+			in:   "depends:\n- own/a@>=1.0\n- own/b\nname: x\n",
+			want: map[string]any{"depends": []any{"own/a@>=1.0", "own/b"}, "name": "x"},
+		},
+		{
+			name: "top-level sequence",
+			in:   "- a\n- 'b'\n-\n",
+			want: []any{"a", "b", nil},
+		},
+		{
+			name: "flow collections",
+			in:   "bin: [a, \"b,c\", [d, e]]\nenv: {GOFLAGS: -mod=vendor, CGO: '0'}\nnone: []\n",
+			want: map[string]any{
+				"bin":  []any{"a", "b,c", []any{"d", "e"}},
+				"env":  map[string]any{"GOFLAGS": "-mod=vendor", "CGO": "0"},
+				"none": []any{},
+			},
+		},
+		{
+			name: "nested maps",
+			in:   "toolchain:\n  go: \"1.22\"\n  node:\n    version: 20\n    npm: true\nname: x\n",
+			want: map[string]any{
+				"toolchain": map[string]any{"go": "1.22", "node": map[string]any{"version": "20", "npm": true}},
+				"name":      "x",
+			},
+		},
+		{
+			name: "maps in a sequence",
+			in:   "steps:\n  - run: make\n    dir: src\n  - run: make install\n",
+			want: map[string]any{"steps": []any{
+				map[string]any{"run": "make", "dir": "src"},
+				map[string]any{"run": "make install"},
+			}},
+		},
+		{
+			name: "item holding a nested block",
+			in:   "steps:\n  -\n    - a\n    - b\n",
+			want: map[string]any{"steps": []any{[]any{"a", "b"}}},
+		},
+		{
+			name: "literal block scalar",
+			in:   "script: |\n  echo one\n    indented\n\n  echo two\nnext: x\n",
+			want: map[string]any{"script": "echo one\n  indented\n\necho two\n", "next": "x"},
+		},
+		{
+			name: "folded block scalar with strip",
+			in:   "about: >-\n  one\n  two\n",
+			want: map[string]any{"about": "one two"},
+		},
+		{
+			name: "block scalar in a sequence",
+			in:   "build:\n  - |\n    make\n  - ls\n",
+			want: map[string]any{"build": []any{"make\n", "ls"}},
+		},
+		{
+			name: "windows line endings",
+			in:   "a: 1\r\nb: 2\r\n",
+			want: map[string]any{"a": "1", "b": "2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseYAML([]byte(tt.in))
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v\nwant %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		err  string
+	}{
+		{"line without a key", "name: x\njust text\n", "line 2: expected \"key: value\""},
+		{"unexpected indentation", "a: 1\n    b: 2\n", "line 2: unexpected indentation"},
+		{"unterminated double quote", "a: \"open\n", "line 1: bad quoted string"},
+		{"unterminated single quote", "a: 'open\n", "line 1: bad quoted string"},
+		{"unterminated flow sequence", "a: [x, y\n", "line 1: unterminated flow sequence"},
+		{"unterminated flow mapping", "a: {x: 1\n", "line 1: unterminated flow mapping"},
+		{"bad flow mapping entry", "a: {x}\n", "bad flow mapping entry x"},
+		{"bad scalar in a sequence", "a:\n  - \"open\n", "line 2: bad quoted string"},
+		{"block scalar dedented", "build: |\n    make\n  install\n", "line 3: block scalar line indented less"},
+		{"block scalar in a sequence dedented", "a:\n  - |\n      x\n    y\n", "line 4: block scalar line indented less"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := parseYAML([]byte(tt.in))
+			if err == nil {
+				t.Fatalf("expected an error containing %q", tt.err)
+			}
+			if !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("error %q does not contain %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestDecodeYAML(t *testing.T) {
+	var v struct {
+		Build   []string          `json:"build"`
+		Bin     []string          `json:"bin"`
+		Depends []string          `json:"depends"`
+		Env     map[string]string `json:"env"`
+		Skip    bool              `json:"skip"`
+	}
+	in := "build:\n  - make\nbin: [tool]\ndepends:\n- own/a@^1.2\nenv: {CC: clang}\nskip: true\n"
+	if err := decodeYAML([]byte(in), &v); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(v.Build, []string{"make"}) || !reflect.DeepEqual(v.Bin, []string{"tool"}) ||
+		!reflect.DeepEqual(v.Depends, []string{"own/a@^1.2"}) || v.Env["CC"] != "clang" || !v.Skip {
+		t.Errorf("decoded %+v", v)
+	}
+
+	var n struct {
+		Count int `json:"count"`
+	}
+	if err := decodeYAML([]byte("count: [1]\n"), &n); err == nil {
+		t.Error("expected a type error decoding a list into an int")
+	}
+}